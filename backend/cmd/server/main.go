@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"greenroute/internal/auth"
 	"greenroute/internal/database"
+	"greenroute/internal/elevation"
+	"greenroute/internal/emissions"
 	"greenroute/internal/external"
 	"greenroute/internal/routes"
 	"greenroute/internal/services"
@@ -20,36 +25,133 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Initialize external clients
-	mapsClient, err := external.NewMapsClient()
+	routingProvider, err := external.NewRoutingProvider()
+	if err != nil {
+		log.Fatalf("Failed to create routing provider: %v", err)
+	}
+
+	transitRouter, err := external.NewGTFSRouter()
+	if err != nil {
+		log.Fatalf("Failed to load GTFS feeds: %v", err)
+	}
+	if transitRouter != nil {
+		routingProvider = external.WithTransit(routingProvider, transitRouter)
+		if transitRouter.HasRealtime() {
+			interval := 30 * time.Second
+			if value := os.Getenv("GTFS_RT_INTERVAL"); value != "" {
+				if interval, err = time.ParseDuration(value); err != nil {
+					log.Fatalf("Invalid GTFS_RT_INTERVAL: %v", err)
+				}
+			}
+			if interval > 0 {
+				transitRouter.StartRealtime(context.Background(), interval)
+			} else if err := transitRouter.RefreshRealtime(context.Background()); err != nil {
+				log.Printf("GTFS-Realtime refresh failed: %v", err)
+			}
+		}
+	}
+
+	hubFinder, err := external.NewHubFinder(transitRouter)
+	if err != nil {
+		log.Fatalf("Failed to create transit hub finder: %v", err)
+	}
+	if hubFinder == nil {
+		log.Println("No transit hub source configured, multimodal journeys are disabled")
+	}
+
+	var sharedVehicles external.SharedVehicleFinder
+	if gbfsClient := external.NewGBFSClient(); gbfsClient != nil {
+		interval := time.Minute
+		if value := os.Getenv("GBFS_REFRESH_INTERVAL"); value != "" {
+			if interval, err = time.ParseDuration(value); err != nil || interval <= 0 {
+				log.Fatalf("Invalid GBFS_REFRESH_INTERVAL: %s", value)
+			}
+		}
+		gbfsClient.StartRefresh(context.Background(), interval)
+		sharedVehicles = gbfsClient
+	}
+
+	terrain, err := elevation.NewDEM()
+	if err != nil {
+		log.Fatalf("Failed to load elevation model: %v", err)
+	}
+	if terrain != nil {
+		log.Printf("Loaded elevation model (%d tiles)", terrain.Tiles())
+	}
+
+	gridSource, err := emissions.NewGridIntensitySource()
+	if err != nil {
+		log.Fatalf("Failed to load grid carbon intensity: %v", err)
+	}
+
+	emissionModel, err := emissions.NewModel(gridSource)
 	if err != nil {
-		log.Fatalf("Failed to create maps client: %v", err)
+		log.Fatalf("Failed to load emission factors: %v", err)
+	}
+
+	stationFinder, err := newStationFinder()
+	if err != nil {
+		log.Fatalf("Failed to create charging station finder: %v", err)
+	}
+
+	tokens, err := auth.NewTokenManager()
+	if err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
 	}
 
 	// Initialize databases
-	postgres, err := database.NewPostgresDB()
+	store, err := database.Open()
 	if err != nil {
-		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+		log.Fatalf("Failed to open database: %v", err)
 	}
+	defer store.Close()
 
-	mongodb, err := database.NewMongoDB()
+	trafficHistory, err := services.NewTrafficHistory()
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		log.Fatalf("Failed to configure traffic history: %v", err)
 	}
-	defer mongodb.Close()
 
 	// Initialize services
-	routeService := services.NewRouteService(mapsClient, postgres, mongodb)
+	routeService := services.NewRouteService(routingProvider, hubFinder, sharedVehicles, terrain, emissionModel, stationFinder, store, store, trafficHistory)
+
+	preferenceService := services.NewPreferenceService(store)
+	authService := services.NewAuthService(store, tokens)
+	apiKeyService, err := services.NewAPIKeyService(store)
+	if err != nil {
+		log.Fatalf("Failed to configure API keys: %v", err)
+	}
+	tripService, err := services.NewScheduledTripService(store, routeService, preferenceService)
+	if err != nil {
+		log.Fatalf("Failed to configure scheduled trips: %v", err)
+	}
+	tripService.Start(context.Background())
 
 	// Initialize handlers
-	routeHandler := routes.NewRouteHandler(routeService)
+	routeHandler := routes.NewRouteHandler(routeService, preferenceService, apiKeyService)
+	preferenceHandler := routes.NewPreferenceHandler(preferenceService)
+	authHandler := routes.NewAuthHandler(authService)
+	apiKeyHandler := routes.NewAPIKeyHandler(apiKeyService)
+	tripHandler := routes.NewScheduledTripHandler(tripService)
 
 	// Initialize router with CORS middleware
 	router := gin.Default()
 	router.Use(corsMiddleware())
+	router.Use(routes.Authenticate(tokens))
 
 	// Register routes
 	routeHandler.RegisterRoutes(router)
+	preferenceHandler.RegisterRoutes(router)
+	authHandler.RegisterRoutes(router)
+	apiKeyHandler.RegisterRoutes(router)
+	tripHandler.RegisterRoutes(router)
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
@@ -71,11 +173,45 @@ func main() {
 	}
 }
 
+// newStationFinder serves station lookups from the local store when one is
+// configured, refreshing it in the background, and from OpenChargeMap otherwise
+func newStationFinder() (external.StationFinder, error) {
+	store, err := external.NewStationStore()
+	if err != nil {
+		return nil, err
+	}
+
+	chargingClient, clientErr := external.NewChargingClient()
+	if store == nil {
+		if clientErr != nil {
+			return nil, clientErr
+		}
+		return chargingClient, nil
+	}
+
+	log.Printf("Serving charging stations from local store (%d stations)", store.Len())
+	if clientErr != nil {
+		log.Printf("Station store refresh disabled: %v", clientErr)
+		return store, nil
+	}
+
+	interval := 24 * time.Hour
+	if value := os.Getenv("STATION_REFRESH_INTERVAL"); value != "" {
+		if interval, err = time.ParseDuration(value); err != nil {
+			return nil, err
+		}
+	}
+	if interval > 0 {
+		store.StartRefresh(context.Background(), chargingClient, interval)
+	}
+	return store, nil
+}
+
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
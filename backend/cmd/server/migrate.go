@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"greenroute/internal/database"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up [version]     apply pending migrations, up to version if given
+  down [steps]     revert the last migration, or the last steps migrations
+  status           list migrations and whether they have been applied
+  force <version>  mark migrations up to version as applied without running them`
+
+// runMigrate implements the migrate subcommand
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	if driver := os.Getenv("DB_DRIVER"); driver != "" && driver != "postgres" {
+		return fmt.Errorf("migrate only applies to PostgreSQL, DB_DRIVER=%s needs no migration step", driver)
+	}
+
+	postgres, err := database.OpenPostgresDB()
+	if err != nil {
+		return err
+	}
+	migrator, err := database.NewMigrator(postgres)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		target, err := intArg(args, 0)
+		if err != nil {
+			return err
+		}
+		applied, err := migrator.Up(target)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+	case "down":
+		steps, err := intArg(args, 1)
+		if err != nil {
+			return err
+		}
+		reverted, err := migrator.Down(steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+	case "status":
+		status, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-24s %s\n", s.Version, s.Name, applied)
+		}
+
+	case "force":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		version, err := intArg(args, 0)
+		if err != nil {
+			return err
+		}
+		if err := migrator.Force(version); err != nil {
+			return err
+		}
+		fmt.Printf("schema version set to %d\n", version)
+
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
+
+// intArg parses the optional numeric argument of a migrate command
+func intArg(args []string, fallback int) (int, error) {
+	if len(args) < 2 {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number %q\n\n%s", args[1], migrateUsage)
+	}
+	return n, nil
+}
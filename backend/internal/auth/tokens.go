@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, expired, signed
+// with another key or of the wrong type
+var ErrInvalidToken = errors.New("invalid token")
+
+const (
+	accessTokenType  = "access"
+	refreshTokenType = "refresh"
+
+	defaultAccessTTL  = 15 * time.Minute
+	defaultRefreshTTL = 30 * 24 * time.Hour
+
+	issuer = "greenroute"
+)
+
+// TokenManager issues and verifies signed JWT access and refresh tokens
+type TokenManager struct {
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// TokenPair is the result of a login or refresh
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // access token lifetime in seconds
+}
+
+// claims are the JWT claims of both token types
+type claims struct {
+	Type string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// NewTokenManager creates a TokenManager signing with JWT_SECRET. JWT_ACCESS_TTL
+// and JWT_REFRESH_TTL override the token lifetimes, e.g. "15m" and "720h".
+func NewTokenManager() (*TokenManager, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("JWT_SECRET must be set to at least 32 characters")
+	}
+
+	m := &TokenManager{
+		secret:     []byte(secret),
+		accessTTL:  defaultAccessTTL,
+		refreshTTL: defaultRefreshTTL,
+	}
+	for key, ttl := range map[string]*time.Duration{
+		"JWT_ACCESS_TTL":  &m.accessTTL,
+		"JWT_REFRESH_TTL": &m.refreshTTL,
+	} {
+		if value := os.Getenv(key); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid %s: %q", key, value)
+			}
+			*ttl = d
+		}
+	}
+
+	return m, nil
+}
+
+// Issue creates a new access and refresh token for a user
+func (m *TokenManager) Issue(userID uint) (*TokenPair, error) {
+	access, err := m.sign(userID, accessTokenType, m.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := m.sign(userID, refreshTokenType, m.refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(m.accessTTL.Seconds()),
+	}, nil
+}
+
+func (m *TokenManager) sign(userID uint, tokenType string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		Type: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	})
+
+	signed, err := token.SignedString(m.secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %v", err)
+	}
+	return signed, nil
+}
+
+// VerifyAccess returns the user ID of a valid access token
+func (m *TokenManager) VerifyAccess(token string) (uint, error) {
+	return m.verify(token, accessTokenType)
+}
+
+// VerifyRefresh returns the user ID of a valid refresh token
+func (m *TokenManager) VerifyRefresh(token string) (uint, error) {
+	return m.verify(token, refreshTokenType)
+}
+
+func (m *TokenManager) verify(token, tokenType string) (uint, error) {
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, func(*jwt.Token) (interface{}, error) {
+		return m.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || c.Type != tokenType {
+		return 0, ErrInvalidToken
+	}
+
+	userID, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil || userID == 0 {
+		return 0, ErrInvalidToken
+	}
+	return uint(userID), nil
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// APIKey is a credential for server-to-server access. Only the SHA-256 hash of
+// the key is stored; the prefix identifies it in listings.
+type APIKey struct {
+	gorm.Model
+	UserID             uint   `gorm:"index;not null"` // owner
+	Name               string `gorm:"not null"`
+	Prefix             string `gorm:"not null"`
+	KeyHash            string `gorm:"uniqueIndex;not null"` // hex-encoded SHA-256
+	RateLimitPerMinute int    `gorm:"not null"`
+	MonthlyQuota       int    `gorm:"not null"` // requests per calendar month, 0 for unlimited
+	LastUsedAt         *time.Time
+	RevokedAt          *time.Time
+}
+
+// APIKeyUsage counts the requests made with a key in one calendar month
+type APIKeyUsage struct {
+	ID       uint   `gorm:"primaryKey"`
+	APIKeyID uint   `gorm:"uniqueIndex:idx_api_key_usage_month;not null"`
+	Month    string `gorm:"uniqueIndex:idx_api_key_usage_month;not null"` // YYYY-MM, UTC
+	Requests int64  `gorm:"not null"`                                     // accepted requests
+	Rejected int64  `gorm:"not null"`                                     // requests refused for rate limit or quota
+}
+
+// CreateAPIKey stores a new API key
+func (db *sqlDB) CreateAPIKey(key *APIKey) error {
+	return db.db.Create(key).Error
+}
+
+// ListAPIKeys retrieves all keys of a user, including revoked ones
+func (db *sqlDB) ListAPIKeys(userID uint) ([]APIKey, error) {
+	var keys []APIKey
+	if err := db.db.Where("user_id = ?", userID).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetAPIKey retrieves a user's key by ID. It returns ErrNotFound if there is none.
+func (db *sqlDB) GetAPIKey(userID, id uint) (*APIKey, error) {
+	var key APIKey
+	err := db.db.Where("user_id = ?", userID).First(&key, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetAPIKeyByHash retrieves an active key by the hash of its secret. It
+// returns ErrNotFound for unknown and revoked keys.
+func (db *sqlDB) GetAPIKeyByHash(hash string) (*APIKey, error) {
+	var key APIKey
+	err := db.db.Where("key_hash = ? AND revoked_at IS NULL", hash).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey marks a user's key as revoked. It returns ErrNotFound if the
+// user has no active key with the ID.
+func (db *sqlDB) RevokeAPIKey(userID, id uint) error {
+	result := db.db.Model(&APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ConsumeAPIKeyQuota counts one request against a key's monthly quota. It
+// reports false, and counts the request as rejected, if the quota is used up.
+// A quota of 0 means unlimited.
+func (db *sqlDB) ConsumeAPIKeyQuota(keyID uint, month string, quota int) (bool, error) {
+	accepted := false
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		usage := APIKeyUsage{APIKeyID: keyID, Month: month}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&usage).Error; err != nil {
+			return err
+		}
+
+		// Increment only while under the quota so concurrent requests cannot overshoot it
+		query := tx.Model(&APIKeyUsage{}).Where("api_key_id = ? AND month = ?", keyID, month)
+		if quota > 0 {
+			query = query.Where("requests < ?", quota)
+		}
+		result := query.Update("requests", gorm.Expr("requests + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		accepted = result.RowsAffected > 0
+
+		if !accepted {
+			return recordRejected(tx, keyID, month)
+		}
+		return tx.Model(&APIKey{}).Where("id = ?", keyID).Update("last_used_at", time.Now()).Error
+	})
+	return accepted, err
+}
+
+// RecordAPIKeyRejection counts a request refused before reaching the quota check
+func (db *sqlDB) RecordAPIKeyRejection(keyID uint, month string) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		usage := APIKeyUsage{APIKeyID: keyID, Month: month}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&usage).Error; err != nil {
+			return err
+		}
+		return recordRejected(tx, keyID, month)
+	})
+}
+
+func recordRejected(tx *gorm.DB, keyID uint, month string) error {
+	return tx.Model(&APIKeyUsage{}).
+		Where("api_key_id = ? AND month = ?", keyID, month).
+		Update("rejected", gorm.Expr("rejected + 1")).Error
+}
+
+// GetAPIKeyUsage retrieves the monthly usage of a key, most recent month first
+func (db *sqlDB) GetAPIKeyUsage(keyID uint) ([]APIKeyUsage, error) {
+	var usage []APIKeyUsage
+	if err := db.db.Where("api_key_id = ?", keyID).Order("month DESC").Find(&usage).Error; err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
@@ -0,0 +1,650 @@
+package database
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryDB keeps all data in process memory. Nothing survives a restart, so
+// it is meant for development and tests.
+type MemoryDB struct {
+	mu sync.RWMutex
+
+	nextID      uint
+	users       map[uint]*User
+	routes      map[string]*SavedRoute
+	preferences map[uint]*RoutePreference
+	apiKeys     map[uint]*APIKey
+	usage       map[usageKey]*APIKeyUsage
+	trips       map[uint]*ScheduledTrip
+	traffic     map[TrafficKey]*TrafficPattern
+}
+
+type usageKey struct {
+	keyID uint
+	month string
+}
+
+// NewMemoryDB creates an empty in-memory store
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		users:       make(map[uint]*User),
+		routes:      make(map[string]*SavedRoute),
+		preferences: make(map[uint]*RoutePreference),
+		apiKeys:     make(map[uint]*APIKey),
+		usage:       make(map[usageKey]*APIKeyUsage),
+		trips:       make(map[uint]*ScheduledTrip),
+		traffic:     make(map[TrafficKey]*TrafficPattern),
+	}
+}
+
+// Close does nothing; the data is released with the store
+func (db *MemoryDB) Close() error {
+	return nil
+}
+
+// newID returns the next record ID. IDs are unique across all record types.
+func (db *MemoryDB) newID() uint {
+	db.nextID++
+	return db.nextID
+}
+
+// CreateUser creates a new user. It returns ErrAlreadyExists if the email is taken.
+func (db *MemoryDB) CreateUser(user *User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, existing := range db.users {
+		if existing.Email == user.Email {
+			return ErrAlreadyExists
+		}
+	}
+
+	now := time.Now()
+	user.ID = db.newID()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	stored := *user
+	stored.SavedRoutes, stored.RoutePreferences, stored.ScheduledTrips = nil, nil, nil
+	db.users[user.ID] = &stored
+	return nil
+}
+
+// GetUser retrieves a user by ID. It returns ErrNotFound if there is none.
+func (db *MemoryDB) GetUser(id uint) (*User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	user, ok := db.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// GetUserByEmail retrieves a user by email. It returns ErrNotFound if there is none.
+func (db *MemoryDB) GetUserByEmail(email string) (*User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, user := range db.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// SaveRoutes saves routes with their segments and charging stops. Either all
+// routes are saved or, if an ID is taken, none.
+func (db *MemoryDB) SaveRoutes(routes []*SavedRoute) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, route := range routes {
+		if _, ok := db.routes[route.ID]; ok {
+			return ErrAlreadyExists
+		}
+	}
+
+	for _, route := range routes {
+		if route.CreatedAt.IsZero() {
+			route.CreatedAt = time.Now()
+		}
+		for i := range route.Segments {
+			route.Segments[i].ID = db.newID()
+			route.Segments[i].RouteID = route.ID
+		}
+		for i := range route.ChargingStops {
+			route.ChargingStops[i].ID = db.newID()
+			route.ChargingStops[i].RouteID = route.ID
+		}
+		db.routes[route.ID] = copyRoute(route)
+	}
+	return nil
+}
+
+// GetRoute retrieves a saved route with its segments and charging stops.
+// It returns ErrNotFound if no route has the ID.
+func (db *MemoryDB) GetRoute(id string) (*SavedRoute, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	route, ok := db.routes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyRoute(route), nil
+}
+
+// GetUserRoutes retrieves one page of a user's saved routes, with the same
+// filters, order and cursors as the SQL stores
+func (db *MemoryDB) GetUserRoutes(filter RouteFilter) ([]SavedRoute, string, error) {
+	var cursor *routeCursor
+	if filter.Cursor != "" {
+		var err error
+		if cursor, err = decodeRouteCursor(filter.Cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	db.mu.RLock()
+	var matches []*SavedRoute
+	for _, route := range db.routes {
+		if filter.matches(route) {
+			matches = append(matches, route)
+		}
+	}
+	db.mu.RUnlock()
+
+	// compare orders two routes by the sort column, with the ID breaking ties
+	compare := func(a, b routeCursor) int {
+		if filter.Sort == SortByEmission {
+			if a.Emission != b.Emission {
+				if a.Emission < b.Emission {
+					return -1
+				}
+				return 1
+			}
+		} else if !a.CreatedAt.Equal(b.CreatedAt) {
+			if a.CreatedAt.Before(b.CreatedAt) {
+				return -1
+			}
+			return 1
+		}
+		switch {
+		case a.ID < b.ID:
+			return -1
+		case a.ID > b.ID:
+			return 1
+		}
+		return 0
+	}
+	key := func(route *SavedRoute) routeCursor {
+		return routeCursor{CreatedAt: route.CreatedAt, Emission: route.CO2Emission, ID: route.ID}
+	}
+	sign := 1
+	if filter.Descending {
+		sign = -1
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return sign*compare(key(matches[i]), key(matches[j])) < 0
+	})
+
+	limit := filter.pageSize()
+	var routes []SavedRoute
+	var next string
+	for _, route := range matches {
+		if cursor != nil && sign*compare(key(route), *cursor) <= 0 {
+			continue
+		}
+		if len(routes) == limit {
+			next = encodeRouteCursor(routes[limit-1])
+			break
+		}
+		routes = append(routes, *copyRoute(route))
+	}
+	return routes, next, nil
+}
+
+// matches reports whether a route passes the filter, ignoring the cursor
+func (filter RouteFilter) matches(route *SavedRoute) bool {
+	if route.UserID == nil || *route.UserID != filter.UserID {
+		return false
+	}
+	if filter.From != nil && route.CreatedAt.Before(*filter.From) {
+		return false
+	}
+	if filter.To != nil && !route.CreatedAt.Before(*filter.To) {
+		return false
+	}
+	if filter.RecommendedOnly && route.Rank != 1 {
+		return false
+	}
+	if b := filter.BBox; b != nil {
+		inside := func(lat, lng float64) bool {
+			return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
+		}
+		if !inside(route.StartLat, route.StartLng) && !inside(route.EndLat, route.EndLng) {
+			return false
+		}
+	}
+	if len(filter.Modes) > 0 {
+		for _, seg := range route.Segments {
+			for _, mode := range filter.Modes {
+				if seg.Mode == mode {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func copyRoute(route *SavedRoute) *SavedRoute {
+	copied := *route
+	copied.Segments = append([]SavedRouteSegment(nil), route.Segments...)
+	copied.ChargingStops = append([]SavedChargingStop(nil), route.ChargingStops...)
+	return &copied
+}
+
+// ListRoutePreferences retrieves all preference profiles of a user, by name
+func (db *MemoryDB) ListRoutePreferences(userID uint) ([]RoutePreference, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var prefs []RoutePreference
+	for _, pref := range db.preferences {
+		if pref.UserID == userID {
+			prefs = append(prefs, *pref)
+		}
+	}
+	sort.Slice(prefs, func(i, j int) bool {
+		return prefs[i].Name < prefs[j].Name
+	})
+	return prefs, nil
+}
+
+// GetRoutePreference retrieves a user's preference profile by name, or the
+// default profile if name is empty. It returns ErrNotFound if there is none.
+func (db *MemoryDB) GetRoutePreference(userID uint, name string) (*RoutePreference, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if pref := db.findPreference(userID, name); pref != nil {
+		copied := *pref
+		return &copied, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (db *MemoryDB) findPreference(userID uint, name string) *RoutePreference {
+	for _, pref := range db.preferences {
+		if pref.UserID != userID {
+			continue
+		}
+		if (name == "" && pref.IsDefault) || (name != "" && pref.Name == name) {
+			return pref
+		}
+	}
+	return nil
+}
+
+// CreateRoutePreference creates a preference profile. A user's first profile
+// becomes the default. It returns ErrAlreadyExists if the name is taken.
+func (db *MemoryDB) CreateRoutePreference(pref *RoutePreference) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	first := true
+	for _, existing := range db.preferences {
+		if existing.UserID == pref.UserID {
+			first = false
+			if existing.Name == pref.Name {
+				return ErrAlreadyExists
+			}
+		}
+	}
+	if first {
+		pref.IsDefault = true
+	}
+
+	now := time.Now()
+	pref.ID = db.newID()
+	pref.CreatedAt = now
+	pref.UpdatedAt = now
+	db.clearDefaultPreference(pref)
+	stored := *pref
+	db.preferences[pref.ID] = &stored
+	return nil
+}
+
+// UpdateRoutePreference updates a user's preference profile
+func (db *MemoryDB) UpdateRoutePreference(pref *RoutePreference) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.preferences[pref.ID]; !ok {
+		return ErrNotFound
+	}
+	pref.UpdatedAt = time.Now()
+	db.clearDefaultPreference(pref)
+	stored := *pref
+	db.preferences[pref.ID] = &stored
+	return nil
+}
+
+// clearDefaultPreference unsets the user's other default profile when pref becomes the default
+func (db *MemoryDB) clearDefaultPreference(pref *RoutePreference) {
+	if !pref.IsDefault {
+		return
+	}
+	for id, other := range db.preferences {
+		if other.UserID == pref.UserID && id != pref.ID {
+			other.IsDefault = false
+		}
+	}
+}
+
+// DeleteRoutePreference deletes a user's preference profile by name. It
+// returns ErrNotFound if there is none.
+func (db *MemoryDB) DeleteRoutePreference(userID uint, name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	pref := db.findPreference(userID, name)
+	if pref == nil || name == "" {
+		return ErrNotFound
+	}
+	delete(db.preferences, pref.ID)
+	return nil
+}
+
+// CreateAPIKey stores a new API key
+func (db *MemoryDB) CreateAPIKey(key *APIKey) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, existing := range db.apiKeys {
+		if existing.KeyHash == key.KeyHash {
+			return ErrAlreadyExists
+		}
+	}
+
+	now := time.Now()
+	key.ID = db.newID()
+	key.CreatedAt = now
+	key.UpdatedAt = now
+	stored := *key
+	db.apiKeys[key.ID] = &stored
+	return nil
+}
+
+// ListAPIKeys retrieves all keys of a user, including revoked ones
+func (db *MemoryDB) ListAPIKeys(userID uint) ([]APIKey, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var keys []APIKey
+	for _, key := range db.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, *key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// GetAPIKey retrieves a user's key by ID. It returns ErrNotFound if there is none.
+func (db *MemoryDB) GetAPIKey(userID, id uint) (*APIKey, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	key, ok := db.apiKeys[id]
+	if !ok || key.UserID != userID {
+		return nil, ErrNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+// GetAPIKeyByHash retrieves an active key by the hash of its secret. It
+// returns ErrNotFound for unknown and revoked keys.
+func (db *MemoryDB) GetAPIKeyByHash(hash string) (*APIKey, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, key := range db.apiKeys {
+		if key.KeyHash == hash && key.RevokedAt == nil {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// RevokeAPIKey marks a user's key as revoked. It returns ErrNotFound if the
+// user has no active key with the ID.
+func (db *MemoryDB) RevokeAPIKey(userID, id uint) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key, ok := db.apiKeys[id]
+	if !ok || key.UserID != userID || key.RevokedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	return nil
+}
+
+// ConsumeAPIKeyQuota counts one request against a key's monthly quota. It
+// reports false, and counts the request as rejected, if the quota is used up.
+// A quota of 0 means unlimited.
+func (db *MemoryDB) ConsumeAPIKeyQuota(keyID uint, month string, quota int) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	usage := db.monthlyUsage(keyID, month)
+	if quota > 0 && usage.Requests >= int64(quota) {
+		usage.Rejected++
+		return false, nil
+	}
+
+	usage.Requests++
+	if key, ok := db.apiKeys[keyID]; ok {
+		now := time.Now()
+		key.LastUsedAt = &now
+	}
+	return true, nil
+}
+
+// RecordAPIKeyRejection counts a request refused before reaching the quota check
+func (db *MemoryDB) RecordAPIKeyRejection(keyID uint, month string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.monthlyUsage(keyID, month).Rejected++
+	return nil
+}
+
+// monthlyUsage returns the usage record of a key for a month, creating it if needed
+func (db *MemoryDB) monthlyUsage(keyID uint, month string) *APIKeyUsage {
+	k := usageKey{keyID: keyID, month: month}
+	usage, ok := db.usage[k]
+	if !ok {
+		usage = &APIKeyUsage{ID: db.newID(), APIKeyID: keyID, Month: month}
+		db.usage[k] = usage
+	}
+	return usage
+}
+
+// GetAPIKeyUsage retrieves the monthly usage of a key, most recent month first
+func (db *MemoryDB) GetAPIKeyUsage(keyID uint) ([]APIKeyUsage, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var usage []APIKeyUsage
+	for _, u := range db.usage {
+		if u.APIKeyID == keyID {
+			usage = append(usage, *u)
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Month > usage[j].Month
+	})
+	return usage, nil
+}
+
+// CreateScheduledTrip stores a new scheduled trip
+func (db *MemoryDB) CreateScheduledTrip(trip *ScheduledTrip) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	trip.ID = db.newID()
+	trip.CreatedAt = now
+	trip.UpdatedAt = now
+	stored := *trip
+	db.trips[trip.ID] = &stored
+	return nil
+}
+
+// ListScheduledTrips retrieves all scheduled trips of a user
+func (db *MemoryDB) ListScheduledTrips(userID uint) ([]ScheduledTrip, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var trips []ScheduledTrip
+	for _, trip := range db.trips {
+		if trip.UserID == userID {
+			trips = append(trips, *trip)
+		}
+	}
+	sort.Slice(trips, func(i, j int) bool {
+		return trips[i].ID < trips[j].ID
+	})
+	return trips, nil
+}
+
+// GetScheduledTrip retrieves a user's scheduled trip by ID. It returns
+// ErrNotFound if there is none.
+func (db *MemoryDB) GetScheduledTrip(userID, id uint) (*ScheduledTrip, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	trip, ok := db.trips[id]
+	if !ok || trip.UserID != userID {
+		return nil, ErrNotFound
+	}
+	copied := *trip
+	return &copied, nil
+}
+
+// DeleteScheduledTrip removes a user's scheduled trip. It returns ErrNotFound
+// if the user has no trip with the ID.
+func (db *MemoryDB) DeleteScheduledTrip(userID, id uint) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	trip, ok := db.trips[id]
+	if !ok || trip.UserID != userID {
+		return ErrNotFound
+	}
+	delete(db.trips, id)
+	return nil
+}
+
+// GetDueScheduledTrips retrieves the trips whose next plan is due at now
+func (db *MemoryDB) GetDueScheduledTrips(now time.Time) ([]ScheduledTrip, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var trips []ScheduledTrip
+	for _, trip := range db.trips {
+		if !trip.NextPlanAt.After(now) {
+			trips = append(trips, *trip)
+		}
+	}
+	sort.Slice(trips, func(i, j int) bool {
+		return trips[i].NextPlanAt.Before(trips[j].NextPlanAt)
+	})
+	return trips, nil
+}
+
+// ClaimScheduledTrip moves a trip's next plan to next if the trip is unchanged
+// since it was read. It reports false if another planner claimed it first.
+func (db *MemoryDB) ClaimScheduledTrip(trip *ScheduledTrip, next time.Time) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, ok := db.trips[trip.ID]
+	if !ok || stored.Version != trip.Version {
+		return false, nil
+	}
+	stored.NextPlanAt = next
+	stored.Version++
+	stored.UpdatedAt = time.Now()
+	return true, nil
+}
+
+// RecordScheduledTripPlan stores the outcome of planning a trip for an
+// arrival: the route, or the error if routeID is empty
+func (db *MemoryDB) RecordScheduledTripPlan(id uint, plannedFor time.Time, routeID string, planErr string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	trip, ok := db.trips[id]
+	if !ok {
+		return nil // deleted while it was planned
+	}
+	trip.PlannedFor = &plannedFor
+	trip.LastError = planErr
+	if routeID != "" {
+		trip.LastRouteID = &routeID
+	}
+	trip.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateTrafficPattern updates the traffic pattern of a key
+func (db *MemoryDB) UpdateTrafficPattern(key TrafficKey, update func(pattern *TrafficPattern)) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	pattern := TrafficPattern{TrafficKey: key}
+	if stored, ok := db.traffic[key]; ok {
+		pattern = copyTrafficPattern(stored)
+	}
+	update(&pattern)
+	pattern.TrafficKey = key
+	pattern.Version++
+	db.traffic[key] = &pattern
+	return nil
+}
+
+// GetTrafficPattern retrieves historical traffic data for a cell pair and hour
+func (db *MemoryDB) GetTrafficPattern(key TrafficKey) (*TrafficPattern, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	pattern, ok := db.traffic[key]
+	if !ok {
+		return nil, nil
+	}
+	copied := copyTrafficPattern(pattern)
+	return &copied, nil
+}
+
+func copyTrafficPattern(pattern *TrafficPattern) TrafficPattern {
+	copied := *pattern
+	copied.Histogram = append([]float64(nil), pattern.Histogram...)
+	return copied
+}
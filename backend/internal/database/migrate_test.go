@@ -0,0 +1,122 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestMigrator(t *testing.T) *Migrator {
+	t.Helper()
+	t.Setenv("SQLITE_PATH", ":memory:")
+	db, err := NewSQLiteDB()
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := newMigrator(db.db, "sqlite")
+	if err != nil {
+		t.Fatalf("newMigrator: %v", err)
+	}
+	return m
+}
+
+func TestMigratorDownAndUpAgain(t *testing.T) {
+	m := newTestMigrator(t)
+	latest := m.Latest()
+
+	version, err := m.Version()
+	if err != nil || version != latest {
+		t.Fatalf("opened at version %d (%v), want %d", version, err, latest)
+	}
+
+	reverted, err := m.Down(latest)
+	if err != nil {
+		t.Fatalf("Down(%d): %v", latest, err)
+	}
+	if len(reverted) != latest || reverted[0].Version != latest {
+		t.Fatalf("Down reverted %d migrations starting at %d", len(reverted), reverted[0].Version)
+	}
+	if version, _ := m.Version(); version != 0 {
+		t.Fatalf("version after reverting everything = %d, want 0", version)
+	}
+
+	applied, err := m.Up(0)
+	if err != nil {
+		t.Fatalf("Up(0): %v", err)
+	}
+	if len(applied) != latest {
+		t.Fatalf("Up applied %d migrations, want %d", len(applied), latest)
+	}
+}
+
+func TestMigratorUp(t *testing.T) {
+	m := newTestMigrator(t)
+	latest := m.Latest()
+	if _, err := m.Down(3); err != nil {
+		t.Fatalf("Down(3): %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		target  int
+		applied int
+		err     string
+	}{
+		{name: "to a version", target: latest - 2, applied: 1},
+		{name: "to the current version", target: latest - 2, err: "already at version"},
+		{name: "below the current version", target: 1, err: "already at version"},
+		{name: "unknown version", target: latest + 1, err: "unknown migration version"},
+		{name: "negative version", target: -1, err: "unknown migration version"},
+		{name: "all pending", target: 0, applied: 2},
+		{name: "nothing pending", target: 0, applied: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied, err := m.Up(tt.target)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Up(%d) error = %v, want %q", tt.target, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Up(%d): %v", tt.target, err)
+			}
+			if len(applied) != tt.applied {
+				t.Fatalf("Up(%d) applied %d migrations, want %d", tt.target, len(applied), tt.applied)
+			}
+		})
+	}
+}
+
+func TestMigratorDownMoreThanApplied(t *testing.T) {
+	m := newTestMigrator(t)
+	if _, err := m.Down(2); err != nil {
+		t.Fatalf("Down(2): %v", err)
+	}
+
+	reverted, err := m.Down(m.Latest() + 5)
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if len(reverted) != m.Latest()-2 {
+		t.Fatalf("Down reverted %d migrations, want %d", len(reverted), m.Latest()-2)
+	}
+}
+
+func TestMigratorRefusesNewerSchema(t *testing.T) {
+	m := newTestMigrator(t)
+	newer := schemaMigration{Version: m.Latest() + 1, Name: "from_the_future", AppliedAt: time.Now()}
+	if err := m.db.Create(&newer).Error; err != nil {
+		t.Fatalf("recording a newer version: %v", err)
+	}
+
+	if _, err := m.Up(0); err == nil || !strings.Contains(err.Error(), "newer than") {
+		t.Errorf("Up error = %v, want a newer schema error", err)
+	}
+	if _, err := m.Down(1); err == nil || !strings.Contains(err.Error(), "newer than") {
+		t.Errorf("Down error = %v, want a newer schema error", err)
+	}
+}
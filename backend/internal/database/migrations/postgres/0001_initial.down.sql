@@ -0,0 +1,3 @@
+DROP TABLE route_preferences;
+DROP TABLE saved_routes;
+DROP TABLE users;
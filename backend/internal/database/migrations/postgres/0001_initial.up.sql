@@ -0,0 +1,49 @@
+-- Baseline: the schema created by GORM AutoMigrate before versioned migrations.
+-- Databases created that way can be adopted with `migrate force 1`.
+
+CREATE TABLE users (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    email      text NOT NULL,
+    name       text NOT NULL
+);
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE saved_routes (
+    id             bigserial PRIMARY KEY,
+    created_at     timestamptz,
+    updated_at     timestamptz,
+    deleted_at     timestamptz,
+    user_id        bigint NOT NULL,
+    start_lat      double precision NOT NULL,
+    start_lng      double precision NOT NULL,
+    end_lat        double precision NOT NULL,
+    end_lng        double precision NOT NULL,
+    distance       double precision NOT NULL,
+    duration       bigint NOT NULL,
+    co2_emission   double precision NOT NULL,
+    transport_mode text NOT NULL,
+    start_address  text,
+    end_address    text,
+    CONSTRAINT fk_users_saved_routes FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX idx_saved_routes_deleted_at ON saved_routes (deleted_at);
+
+CREATE TABLE route_preferences (
+    id                   bigserial PRIMARY KEY,
+    created_at           timestamptz,
+    updated_at           timestamptz,
+    deleted_at           timestamptz,
+    user_id              bigint NOT NULL,
+    preferred_modes      text NOT NULL,
+    avoid_highways       boolean NOT NULL,
+    max_walking_distance double precision NOT NULL,
+    prioritize_emission  boolean NOT NULL,
+    max_transfers        bigint NOT NULL,
+    CONSTRAINT fk_users_route_preference FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX idx_route_preferences_user_id ON route_preferences (user_id);
+CREATE INDEX idx_route_preferences_deleted_at ON route_preferences (deleted_at);
@@ -0,0 +1,22 @@
+-- Route IDs cannot be converted back to integers, so saved routes are dropped
+
+DROP TABLE saved_charging_stops;
+DROP TABLE saved_route_segments;
+
+DELETE FROM saved_routes;
+
+ALTER TABLE saved_routes DROP COLUMN warnings;
+ALTER TABLE saved_routes DROP COLUMN score;
+ALTER TABLE saved_routes DROP COLUMN rank;
+
+DROP INDEX idx_saved_routes_user_id;
+ALTER TABLE saved_routes ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE saved_routes ALTER COLUMN created_at DROP NOT NULL;
+
+ALTER TABLE saved_routes ADD COLUMN updated_at timestamptz;
+ALTER TABLE saved_routes ADD COLUMN deleted_at timestamptz;
+CREATE INDEX idx_saved_routes_deleted_at ON saved_routes (deleted_at);
+
+ALTER TABLE saved_routes ALTER COLUMN id TYPE bigint USING id::bigint;
+CREATE SEQUENCE saved_routes_id_seq OWNED BY saved_routes.id;
+ALTER TABLE saved_routes ALTER COLUMN id SET DEFAULT nextval('saved_routes_id_seq');
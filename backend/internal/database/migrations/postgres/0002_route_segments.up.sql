@@ -0,0 +1,74 @@
+-- Routes get a stable string ID, an optional owner, ranking details and
+-- ordered segments and charging stops
+
+DELETE FROM saved_routes WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE saved_routes ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE saved_routes ALTER COLUMN id TYPE text USING id::text;
+DROP SEQUENCE IF EXISTS saved_routes_id_seq;
+
+DROP INDEX idx_saved_routes_deleted_at;
+ALTER TABLE saved_routes DROP COLUMN updated_at;
+ALTER TABLE saved_routes DROP COLUMN deleted_at;
+
+UPDATE saved_routes SET created_at = now() WHERE created_at IS NULL;
+ALTER TABLE saved_routes ALTER COLUMN created_at SET NOT NULL;
+ALTER TABLE saved_routes ALTER COLUMN user_id DROP NOT NULL;
+CREATE INDEX idx_saved_routes_user_id ON saved_routes (user_id);
+
+ALTER TABLE saved_routes ADD COLUMN rank bigint NOT NULL DEFAULT 1;
+ALTER TABLE saved_routes ADD COLUMN score double precision NOT NULL DEFAULT 0;
+ALTER TABLE saved_routes ADD COLUMN warnings text;
+ALTER TABLE saved_routes ALTER COLUMN rank DROP DEFAULT;
+ALTER TABLE saved_routes ALTER COLUMN score DROP DEFAULT;
+
+CREATE TABLE saved_route_segments (
+    id                  bigserial PRIMARY KEY,
+    route_id            text NOT NULL,
+    position            bigint NOT NULL,
+    mode                text NOT NULL,
+    start_lat           double precision NOT NULL,
+    start_lng           double precision NOT NULL,
+    end_lat             double precision NOT NULL,
+    end_lng             double precision NOT NULL,
+    start_address       text,
+    end_address         text,
+    distance            double precision NOT NULL,
+    duration            bigint NOT NULL,
+    co2_emission        double precision NOT NULL,
+    emission_factor_set text,
+    polyline            text,
+    CONSTRAINT fk_saved_routes_segments FOREIGN KEY (route_id) REFERENCES saved_routes (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_saved_route_segments_route_id ON saved_route_segments (route_id);
+
+-- Older routes only kept totals and their primary mode; keep them as one segment
+INSERT INTO saved_route_segments (
+    route_id, position, mode,
+    start_lat, start_lng, end_lat, end_lng, start_address, end_address,
+    distance, duration, co2_emission
+)
+SELECT
+    id, 0, transport_mode,
+    start_lat, start_lng, end_lat, end_lng, start_address, end_address,
+    distance, duration, co2_emission
+FROM saved_routes;
+
+CREATE TABLE saved_charging_stops (
+    id              bigserial PRIMARY KEY,
+    route_id        text NOT NULL,
+    position        bigint NOT NULL,
+    station_id      bigint NOT NULL,
+    name            text,
+    lat             double precision NOT NULL,
+    lng             double precision NOT NULL,
+    address         text,
+    arrival_soc     double precision NOT NULL,
+    departure_soc   double precision NOT NULL,
+    energy_kwh      double precision NOT NULL,
+    connector       text,
+    power_kw        double precision NOT NULL,
+    charge_duration bigint NOT NULL,
+    CONSTRAINT fk_saved_routes_charging_stops FOREIGN KEY (route_id) REFERENCES saved_routes (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_saved_charging_stops_route_id ON saved_charging_stops (route_id);
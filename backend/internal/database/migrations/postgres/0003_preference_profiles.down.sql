@@ -0,0 +1,11 @@
+-- Only the default profile of each user is kept
+
+DELETE FROM route_preferences WHERE NOT is_default;
+
+DROP INDEX idx_route_preferences_user_name;
+CREATE UNIQUE INDEX idx_route_preferences_user_id ON route_preferences (user_id);
+
+ALTER TABLE route_preferences DROP COLUMN vehicle;
+ALTER TABLE route_preferences DROP COLUMN weights;
+ALTER TABLE route_preferences DROP COLUMN is_default;
+ALTER TABLE route_preferences DROP COLUMN name;
@@ -0,0 +1,12 @@
+-- Users can keep several named preference profiles, one of them the default
+
+ALTER TABLE route_preferences ADD COLUMN name text NOT NULL DEFAULT 'default';
+ALTER TABLE route_preferences ADD COLUMN is_default boolean NOT NULL DEFAULT true;
+ALTER TABLE route_preferences ALTER COLUMN name DROP DEFAULT;
+ALTER TABLE route_preferences ALTER COLUMN is_default DROP DEFAULT;
+
+ALTER TABLE route_preferences ADD COLUMN weights text;
+ALTER TABLE route_preferences ADD COLUMN vehicle text;
+
+DROP INDEX idx_route_preferences_user_id;
+CREATE UNIQUE INDEX idx_route_preferences_user_name ON route_preferences (user_id, name);
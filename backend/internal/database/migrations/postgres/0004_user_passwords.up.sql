@@ -0,0 +1,5 @@
+-- Users sign in with a password. Accounts created before this migration have
+-- no password and cannot sign in until one is set.
+
+ALTER TABLE users ADD COLUMN password_hash text NOT NULL DEFAULT '';
+ALTER TABLE users ALTER COLUMN password_hash DROP DEFAULT;
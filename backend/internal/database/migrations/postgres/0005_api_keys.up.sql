@@ -0,0 +1,30 @@
+-- Hashed API keys for server-to-server clients and their monthly usage
+
+CREATE TABLE api_keys (
+    id                    bigserial PRIMARY KEY,
+    created_at            timestamptz,
+    updated_at            timestamptz,
+    deleted_at            timestamptz,
+    user_id               bigint NOT NULL,
+    name                  text NOT NULL,
+    prefix                text NOT NULL,
+    key_hash              text NOT NULL,
+    rate_limit_per_minute bigint NOT NULL,
+    monthly_quota         bigint NOT NULL,
+    last_used_at          timestamptz,
+    revoked_at            timestamptz,
+    CONSTRAINT fk_users_api_keys FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_api_keys_key_hash ON api_keys (key_hash);
+CREATE INDEX idx_api_keys_user_id ON api_keys (user_id);
+CREATE INDEX idx_api_keys_deleted_at ON api_keys (deleted_at);
+
+CREATE TABLE api_key_usages (
+    id         bigserial PRIMARY KEY,
+    api_key_id bigint NOT NULL,
+    month      text NOT NULL,
+    requests   bigint NOT NULL,
+    rejected   bigint NOT NULL,
+    CONSTRAINT fk_api_keys_usage FOREIGN KEY (api_key_id) REFERENCES api_keys (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_api_key_usage_month ON api_key_usages (api_key_id, month);
@@ -0,0 +1 @@
+ALTER TABLE saved_route_segments DROP COLUMN eta;
@@ -0,0 +1,3 @@
+-- Saved segments keep the travel time estimate they were returned with
+
+ALTER TABLE saved_route_segments ADD COLUMN eta text;
@@ -0,0 +1,31 @@
+-- Recurring trips that are planned again before every occurrence
+
+CREATE TABLE scheduled_trips (
+    id            bigserial PRIMARY KEY,
+    created_at    timestamptz,
+    updated_at    timestamptz,
+    deleted_at    timestamptz,
+    user_id       bigint NOT NULL,
+    name          text NOT NULL,
+    start_lat     double precision NOT NULL,
+    start_lng     double precision NOT NULL,
+    end_lat       double precision NOT NULL,
+    end_lng       double precision NOT NULL,
+    start_address text,
+    end_address   text,
+    days          text NOT NULL,
+    arrive_by     text NOT NULL,
+    time_zone     text NOT NULL,
+    profile       text,
+    preferences   text,
+    next_plan_at  timestamptz NOT NULL,
+    version       bigint NOT NULL,
+    last_route_id text,
+    planned_for   timestamptz,
+    last_error    text,
+    CONSTRAINT fk_users_scheduled_trips FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_scheduled_trips_last_route FOREIGN KEY (last_route_id) REFERENCES saved_routes (id) ON DELETE SET NULL
+);
+CREATE INDEX idx_scheduled_trips_user_id ON scheduled_trips (user_id);
+CREATE INDEX idx_scheduled_trips_next_plan_at ON scheduled_trips (next_plan_at);
+CREATE INDEX idx_scheduled_trips_deleted_at ON scheduled_trips (deleted_at);
@@ -0,0 +1,3 @@
+-- Saved segments keep the vehicles boarded on timetabled transit
+
+ALTER TABLE saved_route_segments ADD COLUMN rides text;
@@ -0,0 +1,2 @@
+ALTER TABLE route_preferences DROP COLUMN avoid_steep_climbs;
+ALTER TABLE saved_route_segments DROP COLUMN elevation;
@@ -0,0 +1,7 @@
+-- Saved segments keep their elevation profile, and preference profiles can
+-- avoid steep climbs
+
+ALTER TABLE saved_route_segments ADD COLUMN elevation text;
+
+ALTER TABLE route_preferences ADD COLUMN avoid_steep_climbs boolean NOT NULL DEFAULT false;
+ALTER TABLE route_preferences ALTER COLUMN avoid_steep_climbs DROP DEFAULT;
@@ -0,0 +1,8 @@
+DROP TABLE traffic_patterns;
+DROP TABLE api_key_usages;
+DROP TABLE api_keys;
+DROP TABLE route_preferences;
+DROP TABLE saved_charging_stops;
+DROP TABLE saved_route_segments;
+DROP TABLE saved_routes;
+DROP TABLE users;
@@ -0,0 +1,132 @@
+-- SQLite schema for running the server without database servers. It matches
+-- the PostgreSQL schema and additionally holds traffic patterns.
+
+CREATE TABLE users (
+    id            integer PRIMARY KEY AUTOINCREMENT,
+    created_at    datetime,
+    updated_at    datetime,
+    deleted_at    datetime,
+    email         text NOT NULL,
+    name          text NOT NULL,
+    password_hash text NOT NULL
+);
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE saved_routes (
+    id             text PRIMARY KEY,
+    user_id        integer REFERENCES users (id),
+    start_lat      real NOT NULL,
+    start_lng      real NOT NULL,
+    end_lat        real NOT NULL,
+    end_lng        real NOT NULL,
+    start_address  text,
+    end_address    text,
+    distance       real NOT NULL,
+    duration       integer NOT NULL,
+    co2_emission   real NOT NULL,
+    transport_mode text NOT NULL,
+    rank           integer NOT NULL,
+    score          real NOT NULL,
+    warnings       text,
+    created_at     datetime NOT NULL
+);
+CREATE INDEX idx_saved_routes_user_id ON saved_routes (user_id);
+
+CREATE TABLE saved_route_segments (
+    id                  integer PRIMARY KEY AUTOINCREMENT,
+    route_id            text NOT NULL REFERENCES saved_routes (id) ON DELETE CASCADE,
+    position            integer NOT NULL,
+    mode                text NOT NULL,
+    start_lat           real NOT NULL,
+    start_lng           real NOT NULL,
+    end_lat             real NOT NULL,
+    end_lng             real NOT NULL,
+    start_address       text,
+    end_address         text,
+    distance            real NOT NULL,
+    duration            integer NOT NULL,
+    co2_emission        real NOT NULL,
+    emission_factor_set text,
+    polyline            text
+);
+CREATE INDEX idx_saved_route_segments_route_id ON saved_route_segments (route_id);
+
+CREATE TABLE saved_charging_stops (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    route_id        text NOT NULL REFERENCES saved_routes (id) ON DELETE CASCADE,
+    position        integer NOT NULL,
+    station_id      integer NOT NULL,
+    name            text,
+    lat             real NOT NULL,
+    lng             real NOT NULL,
+    address         text,
+    arrival_soc     real NOT NULL,
+    departure_soc   real NOT NULL,
+    energy_kwh      real NOT NULL,
+    connector       text,
+    power_kw        real NOT NULL,
+    charge_duration integer NOT NULL
+);
+CREATE INDEX idx_saved_charging_stops_route_id ON saved_charging_stops (route_id);
+
+CREATE TABLE route_preferences (
+    id                   integer PRIMARY KEY AUTOINCREMENT,
+    created_at           datetime,
+    updated_at           datetime,
+    deleted_at           datetime,
+    user_id              integer NOT NULL REFERENCES users (id),
+    name                 text NOT NULL,
+    is_default           numeric NOT NULL,
+    preferred_modes      text NOT NULL,
+    avoid_highways       numeric NOT NULL,
+    max_walking_distance real NOT NULL,
+    prioritize_emission  numeric NOT NULL,
+    max_transfers        integer NOT NULL,
+    weights              text,
+    vehicle              text
+);
+CREATE UNIQUE INDEX idx_route_preferences_user_name ON route_preferences (user_id, name);
+CREATE INDEX idx_route_preferences_deleted_at ON route_preferences (deleted_at);
+
+CREATE TABLE api_keys (
+    id                    integer PRIMARY KEY AUTOINCREMENT,
+    created_at            datetime,
+    updated_at            datetime,
+    deleted_at            datetime,
+    user_id               integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name                  text NOT NULL,
+    prefix                text NOT NULL,
+    key_hash              text NOT NULL,
+    rate_limit_per_minute integer NOT NULL,
+    monthly_quota         integer NOT NULL,
+    last_used_at          datetime,
+    revoked_at            datetime
+);
+CREATE UNIQUE INDEX idx_api_keys_key_hash ON api_keys (key_hash);
+CREATE INDEX idx_api_keys_user_id ON api_keys (user_id);
+CREATE INDEX idx_api_keys_deleted_at ON api_keys (deleted_at);
+
+CREATE TABLE api_key_usages (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    api_key_id integer NOT NULL REFERENCES api_keys (id) ON DELETE CASCADE,
+    month      text NOT NULL,
+    requests   integer NOT NULL,
+    rejected   integer NOT NULL
+);
+CREATE UNIQUE INDEX idx_api_key_usage_month ON api_key_usages (api_key_id, month);
+
+CREATE TABLE traffic_patterns (
+    id           integer PRIMARY KEY AUTOINCREMENT,
+    start_lat    real NOT NULL,
+    start_lng    real NOT NULL,
+    end_lat      real NOT NULL,
+    end_lng      real NOT NULL,
+    day_of_week  integer NOT NULL,
+    hour_of_day  integer NOT NULL,
+    duration     real NOT NULL,
+    timestamp    datetime NOT NULL,
+    sample_count integer NOT NULL
+);
+CREATE UNIQUE INDEX idx_traffic_patterns_key
+    ON traffic_patterns (start_lat, start_lng, end_lat, end_lng, day_of_week, hour_of_day);
@@ -0,0 +1,16 @@
+DROP TABLE traffic_patterns;
+
+CREATE TABLE traffic_patterns (
+    id           integer PRIMARY KEY AUTOINCREMENT,
+    start_lat    real NOT NULL,
+    start_lng    real NOT NULL,
+    end_lat      real NOT NULL,
+    end_lng      real NOT NULL,
+    day_of_week  integer NOT NULL,
+    hour_of_day  integer NOT NULL,
+    duration     real NOT NULL,
+    timestamp    datetime NOT NULL,
+    sample_count integer NOT NULL
+);
+CREATE UNIQUE INDEX idx_traffic_patterns_key
+    ON traffic_patterns (start_lat, start_lng, end_lat, end_lng, day_of_week, hour_of_day);
@@ -0,0 +1,20 @@
+ALTER TABLE saved_route_segments DROP COLUMN eta;
+
+DROP TABLE traffic_patterns;
+
+CREATE TABLE traffic_patterns (
+    id           integer PRIMARY KEY AUTOINCREMENT,
+    start_cell   text NOT NULL,
+    end_cell     text NOT NULL,
+    day_of_week  integer NOT NULL,
+    hour_of_day  integer NOT NULL,
+    start_lat    real NOT NULL,
+    start_lng    real NOT NULL,
+    end_lat      real NOT NULL,
+    end_lng      real NOT NULL,
+    duration     real NOT NULL,
+    timestamp    datetime NOT NULL,
+    sample_count integer NOT NULL
+);
+CREATE UNIQUE INDEX idx_traffic_patterns_key
+    ON traffic_patterns (start_cell, end_cell, day_of_week, hour_of_day);
@@ -0,0 +1,30 @@
+-- Traffic patterns keep decayed statistics instead of a running sum, and
+-- saved segments keep the travel time estimate they were returned with.
+-- Summed durations cannot be turned into statistics, so patterns are dropped.
+
+DROP TABLE traffic_patterns;
+
+CREATE TABLE traffic_patterns (
+    id           integer PRIMARY KEY AUTOINCREMENT,
+    start_cell   text NOT NULL,
+    end_cell     text NOT NULL,
+    day_of_week  integer NOT NULL,
+    hour_of_day  integer NOT NULL,
+    start_lat    real NOT NULL,
+    start_lng    real NOT NULL,
+    end_lat      real NOT NULL,
+    end_lng      real NOT NULL,
+    mean         real NOT NULL,
+    variance     real NOT NULL,
+    p50          real NOT NULL,
+    p90          real NOT NULL,
+    histogram    text,
+    weight       real NOT NULL,
+    sample_count integer NOT NULL,
+    timestamp    datetime NOT NULL,
+    version      integer NOT NULL
+);
+CREATE UNIQUE INDEX idx_traffic_patterns_key
+    ON traffic_patterns (start_cell, end_cell, day_of_week, hour_of_day);
+
+ALTER TABLE saved_route_segments ADD COLUMN eta text;
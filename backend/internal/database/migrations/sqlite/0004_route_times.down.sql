@@ -0,0 +1,3 @@
+ALTER TABLE saved_route_segments DROP COLUMN departure;
+ALTER TABLE saved_routes DROP COLUMN arrival_time;
+ALTER TABLE saved_routes DROP COLUMN departure_time;
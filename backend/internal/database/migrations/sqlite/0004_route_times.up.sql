@@ -0,0 +1,5 @@
+-- Routes keep when they leave and arrive, and transit segments their timetabled departure
+
+ALTER TABLE saved_routes ADD COLUMN departure_time datetime;
+ALTER TABLE saved_routes ADD COLUMN arrival_time datetime;
+ALTER TABLE saved_route_segments ADD COLUMN departure datetime;
@@ -0,0 +1,29 @@
+-- Recurring trips that are planned again before every occurrence
+
+CREATE TABLE scheduled_trips (
+    id            integer PRIMARY KEY AUTOINCREMENT,
+    created_at    datetime,
+    updated_at    datetime,
+    deleted_at    datetime,
+    user_id       integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name          text NOT NULL,
+    start_lat     real NOT NULL,
+    start_lng     real NOT NULL,
+    end_lat       real NOT NULL,
+    end_lng       real NOT NULL,
+    start_address text,
+    end_address   text,
+    days          text NOT NULL,
+    arrive_by     text NOT NULL,
+    time_zone     text NOT NULL,
+    profile       text,
+    preferences   text,
+    next_plan_at  datetime NOT NULL,
+    version       integer NOT NULL,
+    last_route_id text REFERENCES saved_routes (id) ON DELETE SET NULL,
+    planned_for   datetime,
+    last_error    text
+);
+CREATE INDEX idx_scheduled_trips_user_id ON scheduled_trips (user_id);
+CREATE INDEX idx_scheduled_trips_next_plan_at ON scheduled_trips (next_plan_at);
+CREATE INDEX idx_scheduled_trips_deleted_at ON scheduled_trips (deleted_at);
@@ -0,0 +1,3 @@
+-- Saved segments keep where shared bikes and scooters are picked up and left
+
+ALTER TABLE saved_route_segments ADD COLUMN shared text;
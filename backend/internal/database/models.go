@@ -4,29 +4,68 @@ import (
 	"time"
 )
 
-// SavedRoute represents a route stored in PostgreSQL
+// SavedRoute represents a calculated route stored under a stable ID
 type SavedRoute struct {
-	ID            string    `gorm:"primarykey"`
-	UserID        string    `gorm:"not null"`
-	StartLat      float64   `gorm:"not null"`
-	StartLng      float64   `gorm:"not null"`
-	EndLat        float64   `gorm:"not null"`
-	EndLng        float64   `gorm:"not null"`
-	Distance      float64   `gorm:"not null"`
-	Duration      int64     `gorm:"not null"` // stored in seconds
-	CO2Emission   float64   `gorm:"not null"`
-	CreatedAt     time.Time `gorm:"not null"`
+	ID            string  `gorm:"primaryKey"`
+	UserID        *uint   `gorm:"index"` // nil for anonymous requests
+	StartLat      float64 `gorm:"not null"`
+	StartLng      float64 `gorm:"not null"`
+	EndLat        float64 `gorm:"not null"`
+	EndLng        float64 `gorm:"not null"`
+	StartAddress  string
+	EndAddress    string
+	Distance      float64    `gorm:"not null"` // in meters
+	Duration      int64      `gorm:"not null"` // stored in seconds
+	CO2Emission   float64    `gorm:"not null"` // in grams
+	TransportMode string     `gorm:"not null"` // mode of the first segment
+	Rank          int        `gorm:"not null"`
+	Score         float64    `gorm:"not null"`
+	Warnings      string     // newline-separated
+	DepartureTime *time.Time // nil for routes saved before trips were timed
+	ArrivalTime   *time.Time
+	CreatedAt     time.Time           `gorm:"not null"`
+	Segments      []SavedRouteSegment `gorm:"foreignKey:RouteID;constraint:OnDelete:CASCADE"`
+	ChargingStops []SavedChargingStop `gorm:"foreignKey:RouteID;constraint:OnDelete:CASCADE"`
 }
 
-// TrafficPattern represents traffic data stored in MongoDB
-type TrafficPattern struct {
-	ID          string    `bson:"_id,omitempty"`
-	StartLat    float64   `bson:"start_lat"`
-	StartLng    float64   `bson:"start_lng"`
-	EndLat      float64   `bson:"end_lat"`
-	EndLng      float64   `bson:"end_lng"`
-	Duration    int64     `bson:"duration"` // in seconds
-	TimeOfDay   int       `bson:"time_of_day"` // hour of day (0-23)
-	DayOfWeek   int       `bson:"day_of_week"` // 0 = Sunday, 6 = Saturday
-	UpdatedAt   time.Time `bson:"updated_at"`
+// SavedRouteSegment is one segment of a saved route, kept in travel order
+type SavedRouteSegment struct {
+	ID                uint    `gorm:"primaryKey"`
+	RouteID           string  `gorm:"index;not null"`
+	Position          int     `gorm:"not null"`
+	Mode              string  `gorm:"not null"`
+	StartLat          float64 `gorm:"not null"`
+	StartLng          float64 `gorm:"not null"`
+	EndLat            float64 `gorm:"not null"`
+	EndLng            float64 `gorm:"not null"`
+	StartAddress      string
+	EndAddress        string
+	Distance          float64 `gorm:"not null"` // in meters
+	Duration          int64   `gorm:"not null"` // stored in seconds
+	CO2Emission       float64 `gorm:"not null"` // in grams
+	EmissionFactorSet string
+	Polyline          string     `gorm:"type:text"`
+	ETA               string     `gorm:"type:text"` // JSON-encoded travel time estimate, empty for none
+	Departure         *time.Time // timetabled departure, transit only
+	Rides             string     `gorm:"type:text"` // JSON-encoded transit rides, empty for none
+	Shared            string     `gorm:"type:text"` // JSON-encoded shared vehicle rental, empty for none
+	Elevation         string     `gorm:"type:text"` // JSON-encoded elevation profile, empty for none
+}
+
+// SavedChargingStop is one charging stop of a saved route, kept in travel order
+type SavedChargingStop struct {
+	ID             uint   `gorm:"primaryKey"`
+	RouteID        string `gorm:"index;not null"`
+	Position       int    `gorm:"not null"`
+	StationID      int    `gorm:"not null"`
+	Name           string
+	Lat            float64 `gorm:"not null"`
+	Lng            float64 `gorm:"not null"`
+	Address        string
+	ArrivalSoC     float64 `gorm:"column:arrival_soc;not null"`
+	DepartureSoC   float64 `gorm:"column:departure_soc;not null"`
+	EnergyKWh      float64 `gorm:"column:energy_kwh;not null"`
+	Connector      string
+	PowerKW        float64 `gorm:"not null"`
+	ChargeDuration int64   `gorm:"not null"` // stored in seconds
 }
@@ -38,75 +38,85 @@ func NewMongoDB() (*MongoDB, error) {
 	}
 
 	db := client.Database("greenroute")
+
+	// Patterns are looked up by cell pair and hour. Documents from before
+	// patterns were keyed by cells have no start_cell and are left out.
+	_, err = db.Collection("traffic_patterns").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "start_cell", Value: 1},
+			{Key: "end_cell", Value: 1},
+			{Key: "day_of_week", Value: 1},
+			{Key: "hour_of_day", Value: 1},
+		},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"start_cell": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create traffic pattern index: %v", err)
+	}
+
 	return &MongoDB{
 		client: client,
 		db:     db,
 	}, nil
 }
 
-// TrafficPattern represents historical traffic data for a route segment
-type TrafficPattern struct {
-	StartLat    float64   `bson:"start_lat"`
-	StartLng    float64   `bson:"start_lng"`
-	EndLat      float64   `bson:"end_lng"`
-	EndLng      float64   `bson:"end_lat"`
-	DayOfWeek   int       `bson:"day_of_week"` // 0 = Sunday, 6 = Saturday
-	HourOfDay   int       `bson:"hour_of_day"` // 0-23
-	Duration    float64   `bson:"duration"`     // Average duration in seconds
-	Timestamp   time.Time `bson:"timestamp"`
-	SampleCount int       `bson:"sample_count"`
-}
-
-// SaveTrafficPattern saves a traffic pattern to MongoDB
-func (m *MongoDB) SaveTrafficPattern(pattern *TrafficPattern) error {
+// UpdateTrafficPattern updates the traffic pattern of a key in MongoDB. The
+// version field guards against lost updates: a replace only succeeds if the
+// document is unchanged since it was read.
+func (m *MongoDB) UpdateTrafficPattern(key TrafficKey, update func(pattern *TrafficPattern)) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	collection := m.db.Collection("traffic_patterns")
-	
-	// Try to update existing pattern or insert new one
-	filter := bson.M{
-		"start_lat":   pattern.StartLat,
-		"start_lng":   pattern.StartLng,
-		"end_lat":     pattern.EndLat,
-		"end_lng":     pattern.EndLng,
-		"day_of_week": pattern.DayOfWeek,
-		"hour_of_day": pattern.HourOfDay,
-	}
 
-	update := bson.M{
-		"$inc": bson.M{
-			"sample_count": 1,
-			"duration":     pattern.Duration,
-		},
-		"$set": bson.M{
-			"timestamp": time.Now(),
-		},
-	}
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		pattern := TrafficPattern{TrafficKey: key}
+		err := collection.FindOne(ctx, trafficKeyFilter(key)).Decode(&pattern)
+		found := err == nil
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		version := pattern.Version
+		update(&pattern)
+		pattern.TrafficKey = key
+		pattern.Version = version + 1
+
+		if !found {
+			_, err := collection.InsertOne(ctx, pattern)
+			if mongo.IsDuplicateKeyError(err) {
+				continue // inserted concurrently
+			}
+			return err
+		}
 
-	opts := options.Update().SetUpsert(true)
-	_, err := collection.UpdateOne(ctx, filter, update, opts)
-	return err
+		filter := trafficKeyFilter(key)
+		filter["version"] = version
+		if version == 0 {
+			// Documents written before versioning have no version field
+			filter["version"] = bson.M{"$in": bson.A{0, nil}}
+		}
+		result, err := collection.ReplaceOne(ctx, filter, pattern)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount > 0 {
+			return nil
+		}
+	}
+	return ErrUpdateConflict
 }
 
-// GetTrafficPattern retrieves historical traffic data for a route segment
-func (m *MongoDB) GetTrafficPattern(
-	startLat, startLng, endLat, endLng float64,
-	dayOfWeek, hourOfDay int,
-) (*TrafficPattern, error) {
+// GetTrafficPattern retrieves historical traffic data for a cell pair and hour
+func (m *MongoDB) GetTrafficPattern(key TrafficKey) (*TrafficPattern, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	collection := m.db.Collection("traffic_patterns")
 
-	filter := bson.M{
-		"start_lat":   startLat,
-		"start_lng":   startLng,
-		"end_lat":     endLat,
-		"end_lng":     endLng,
-		"day_of_week": dayOfWeek,
-		"hour_of_day": hourOfDay,
-	}
+	filter := trafficKeyFilter(key)
 
 	var pattern TrafficPattern
 	err := collection.FindOne(ctx, filter).Decode(&pattern)
@@ -120,6 +130,15 @@ func (m *MongoDB) GetTrafficPattern(
 	return &pattern, nil
 }
 
+func trafficKeyFilter(key TrafficKey) bson.M {
+	return bson.M{
+		"start_cell":  key.StartCell,
+		"end_cell":    key.EndCell,
+		"day_of_week": key.DayOfWeek,
+		"hour_of_day": key.HourOfDay,
+	}
+}
+
 // Close closes the MongoDB connection
 func (m *MongoDB) Close() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -1,20 +1,76 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// ErrNotFound is returned when a requested record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ErrAlreadyExists is returned when a record with the same unique key exists
+var ErrAlreadyExists = errors.New("record already exists")
+
+// sqlDB implements the user, route, preference and API key repositories on a
+// SQL database through GORM. It is shared by PostgresDB and SQLiteDB.
+type sqlDB struct {
+	db *gorm.DB
+}
+
+// Close closes the database connection
+func (db *sqlDB) Close() error {
+	conn, err := db.db.DB()
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
 // PostgresDB handles PostgreSQL database operations
 type PostgresDB struct {
-	db *gorm.DB
+	sqlDB
 }
 
-// NewPostgresDB creates a new PostgreSQL database connection
+// NewPostgresDB creates a new PostgreSQL database connection and checks that
+// its schema is up to date. With DB_AUTO_MIGRATE=true pending migrations are
+// applied instead; otherwise they have to be run with the migrate command.
 func NewPostgresDB() (*PostgresDB, error) {
+	pg, err := OpenPostgresDB()
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := NewMigrator(pg)
+	if err != nil {
+		return nil, err
+	}
+
+	if os.Getenv("DB_AUTO_MIGRATE") == "true" {
+		if _, err := migrator.Up(0); err != nil {
+			return nil, fmt.Errorf("failed to migrate database: %v", err)
+		}
+		return pg, nil
+	}
+
+	version, err := migrator.Version()
+	if err != nil {
+		return nil, err
+	}
+	if version != migrator.Latest() {
+		return nil, fmt.Errorf("database schema is at version %d but %d is required, run the migrate command",
+			version, migrator.Latest())
+	}
+
+	return pg, nil
+}
+
+// OpenPostgresDB connects to PostgreSQL without checking the schema
+func OpenPostgresDB() (*PostgresDB, error) {
 	host := os.Getenv("DB_HOST")
 	port := os.Getenv("DB_PORT")
 	dbname := os.Getenv("DB_NAME")
@@ -29,94 +85,206 @@ func NewPostgresDB() (*PostgresDB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
 
-	// Auto-migrate the schema
-	if err := db.AutoMigrate(
-		&User{},
-		&SavedRoute{},
-		&RoutePreference{},
-	); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %v", err)
-	}
-
 	return &PostgresDB{
-		db: db,
+		sqlDB: sqlDB{db: db},
 	}, nil
 }
 
 // User represents a user in the system
 type User struct {
 	gorm.Model
-	Email           string           `gorm:"uniqueIndex;not null"`
-	Name            string           `gorm:"not null"`
-	SavedRoutes     []SavedRoute     `gorm:"foreignKey:UserID"`
-	RoutePreference RoutePreference  `gorm:"foreignKey:UserID"`
+	Email            string            `gorm:"uniqueIndex;not null"`
+	Name             string            `gorm:"not null"`
+	PasswordHash     string            `gorm:"not null"` // bcrypt
+	SavedRoutes      []SavedRoute      `gorm:"foreignKey:UserID"`
+	RoutePreferences []RoutePreference `gorm:"foreignKey:UserID"`
+	ScheduledTrips   []ScheduledTrip   `gorm:"foreignKey:UserID"`
 }
 
-// SavedRoute represents a saved route in the system
-type SavedRoute struct {
-	gorm.Model
-	UserID         uint    `gorm:"not null"`
-	StartLat       float64 `gorm:"not null"`
-	StartLng       float64 `gorm:"not null"`
-	EndLat         float64 `gorm:"not null"`
-	EndLng         float64 `gorm:"not null"`
-	Distance       float64 `gorm:"not null"` // in meters
-	Duration       int64   `gorm:"not null"` // in seconds
-	CO2Emission    float64 `gorm:"not null"` // in grams
-	TransportMode  string  `gorm:"not null"`
-	StartAddress   string
-	EndAddress     string
-}
-
-// RoutePreference represents user preferences for route calculation
+// RoutePreference represents a named profile of route preferences, such as
+// "commute" or "weekend". At most one profile per user is the default.
 type RoutePreference struct {
 	gorm.Model
-	UserID             uint    `gorm:"uniqueIndex;not null"`
+	UserID             uint    `gorm:"uniqueIndex:idx_route_preferences_user_name;not null"`
+	Name               string  `gorm:"uniqueIndex:idx_route_preferences_user_name;not null"`
+	IsDefault          bool    `gorm:"not null"`
 	PreferredModes     string  `gorm:"not null"` // Comma-separated list
 	AvoidHighways      bool    `gorm:"not null"`
 	MaxWalkingDistance float64 `gorm:"not null"` // in meters
 	PrioritizeEmission bool    `gorm:"not null"`
 	MaxTransfers       int     `gorm:"not null"`
+	AvoidSteepClimbs   bool    `gorm:"not null"`
+	Weights            string  `gorm:"type:text"` // JSON-encoded ranking weights, empty for none
+	Vehicle            string  `gorm:"type:text"` // JSON-encoded vehicle profile, empty for none
+}
+
+// CreateUser creates a new user in the database. It returns ErrAlreadyExists
+// if the email is taken.
+func (db *sqlDB) CreateUser(user *User) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&User{}).Where("email = ?", user.Email).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrAlreadyExists
+		}
+		return tx.Create(user).Error
+	})
 }
 
-// CreateUser creates a new user in the database
-func (db *PostgresDB) CreateUser(user *User) error {
-	return db.db.Create(user).Error
+// GetUser retrieves a user by ID. It returns ErrNotFound if there is none.
+func (db *sqlDB) GetUser(id uint) (*User, error) {
+	var user User
+	err := db.db.First(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
-// GetUser retrieves a user by ID
-func (db *PostgresDB) GetUser(id uint) (*User, error) {
+// GetUserByEmail retrieves a user by email. It returns ErrNotFound if there is none.
+func (db *sqlDB) GetUserByEmail(email string) (*User, error) {
 	var user User
-	if err := db.db.First(&user, id).Error; err != nil {
+	err := db.db.Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-// SaveRoute saves a route to the database
-func (db *PostgresDB) SaveRoute(route *SavedRoute) error {
-	return db.db.Create(route).Error
+// SaveRoutes saves routes with their segments and charging stops in one
+// transaction. Creation times are stored in UTC, which SQLite needs to order
+// and page them, as it compares times as text.
+func (db *sqlDB) SaveRoutes(routes []*SavedRoute) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		for _, route := range routes {
+			if route.CreatedAt.IsZero() {
+				route.CreatedAt = time.Now()
+			}
+			route.CreatedAt = route.CreatedAt.UTC()
+			if err := tx.Create(route).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-// GetUserRoutes retrieves all routes for a user
-func (db *PostgresDB) GetUserRoutes(userID uint) ([]SavedRoute, error) {
-	var routes []SavedRoute
-	if err := db.db.Where("user_id = ?", userID).Find(&routes).Error; err != nil {
+// GetRoute retrieves a saved route with its segments and charging stops.
+// It returns ErrNotFound if no route has the ID.
+func (db *sqlDB) GetRoute(id string) (*SavedRoute, error) {
+	var route SavedRoute
+	err := db.db.
+		Preload("Segments", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		Preload("ChargingStops", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		First(&route, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
 		return nil, err
 	}
-	return routes, nil
+	return &route, nil
 }
 
-// UpdateRoutePreference updates a user's route preferences
-func (db *PostgresDB) UpdateRoutePreference(pref *RoutePreference) error {
-	return db.db.Save(pref).Error
+// ListRoutePreferences retrieves all preference profiles of a user, by name
+func (db *sqlDB) ListRoutePreferences(userID uint) ([]RoutePreference, error) {
+	var prefs []RoutePreference
+	if err := db.db.Where("user_id = ?", userID).Order("name").Find(&prefs).Error; err != nil {
+		return nil, err
+	}
+	return prefs, nil
 }
 
-// GetRoutePreference retrieves a user's route preferences
-func (db *PostgresDB) GetRoutePreference(userID uint) (*RoutePreference, error) {
+// GetRoutePreference retrieves a user's preference profile by name, or the
+// default profile if name is empty. It returns ErrNotFound if there is none.
+func (db *sqlDB) GetRoutePreference(userID uint, name string) (*RoutePreference, error) {
+	query := db.db.Where("user_id = ?", userID)
+	if name == "" {
+		query = query.Where("is_default")
+	} else {
+		query = query.Where("name = ?", name)
+	}
+
 	var pref RoutePreference
-	if err := db.db.Where("user_id = ?", userID).First(&pref).Error; err != nil {
+	err := query.First(&pref).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
 		return nil, err
 	}
 	return &pref, nil
 }
+
+// CreateRoutePreference creates a preference profile. A user's first profile
+// becomes the default. It returns ErrAlreadyExists if the name is taken.
+func (db *sqlDB) CreateRoutePreference(pref *RoutePreference) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&RoutePreference{}).Where("user_id = ?", pref.UserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			pref.IsDefault = true
+		}
+
+		var existing int64
+		if err := tx.Model(&RoutePreference{}).
+			Where("user_id = ? AND name = ?", pref.UserID, pref.Name).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrAlreadyExists
+		}
+
+		if err := clearDefaultPreference(tx, pref); err != nil {
+			return err
+		}
+		return tx.Create(pref).Error
+	})
+}
+
+// UpdateRoutePreference updates a user's preference profile
+func (db *sqlDB) UpdateRoutePreference(pref *RoutePreference) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := clearDefaultPreference(tx, pref); err != nil {
+			return err
+		}
+		return tx.Save(pref).Error
+	})
+}
+
+// clearDefaultPreference unsets the user's other default profile when pref becomes the default
+func clearDefaultPreference(tx *gorm.DB, pref *RoutePreference) error {
+	if !pref.IsDefault {
+		return nil
+	}
+	query := tx.Model(&RoutePreference{}).Where("user_id = ? AND is_default", pref.UserID)
+	if pref.ID != 0 {
+		query = query.Where("id <> ?", pref.ID)
+	}
+	return query.Update("is_default", false).Error
+}
+
+// DeleteRoutePreference deletes a user's preference profile by name. It
+// returns ErrNotFound if there is none.
+func (db *sqlDB) DeleteRoutePreference(userID uint, name string) error {
+	// Delete permanently so the name can be reused
+	result := db.db.Unscoped().Where("user_id = ? AND name = ?", userID, name).Delete(&RoutePreference{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	CreateUser(user *User) error
+	GetUser(id uint) (*User, error)
+	GetUserByEmail(email string) (*User, error)
+}
+
+// RouteRepository stores calculated routes
+type RouteRepository interface {
+	SaveRoutes(routes []*SavedRoute) error
+	GetRoute(id string) (*SavedRoute, error)
+	GetUserRoutes(filter RouteFilter) ([]SavedRoute, string, error)
+}
+
+// PreferenceRepository stores users' route preference profiles
+type PreferenceRepository interface {
+	ListRoutePreferences(userID uint) ([]RoutePreference, error)
+	GetRoutePreference(userID uint, name string) (*RoutePreference, error)
+	CreateRoutePreference(pref *RoutePreference) error
+	UpdateRoutePreference(pref *RoutePreference) error
+	DeleteRoutePreference(userID uint, name string) error
+}
+
+// APIKeyRepository stores API keys and their monthly usage
+type APIKeyRepository interface {
+	CreateAPIKey(key *APIKey) error
+	ListAPIKeys(userID uint) ([]APIKey, error)
+	GetAPIKey(userID, id uint) (*APIKey, error)
+	GetAPIKeyByHash(hash string) (*APIKey, error)
+	RevokeAPIKey(userID, id uint) error
+	ConsumeAPIKeyQuota(keyID uint, month string, quota int) (bool, error)
+	RecordAPIKeyRejection(keyID uint, month string) error
+	GetAPIKeyUsage(keyID uint) ([]APIKeyUsage, error)
+}
+
+// ScheduledTripRepository stores users' recurring trips and the state of their
+// planning. Due trips are claimed before they are planned, so that each
+// occurrence is planned once even with several servers.
+type ScheduledTripRepository interface {
+	CreateScheduledTrip(trip *ScheduledTrip) error
+	ListScheduledTrips(userID uint) ([]ScheduledTrip, error)
+	GetScheduledTrip(userID, id uint) (*ScheduledTrip, error)
+	DeleteScheduledTrip(userID, id uint) error
+	GetDueScheduledTrips(now time.Time) ([]ScheduledTrip, error)
+	ClaimScheduledTrip(trip *ScheduledTrip, next time.Time) (bool, error)
+	RecordScheduledTripPlan(id uint, plannedFor time.Time, routeID string, planErr string) error
+}
+
+// TrafficRepository stores historical traffic patterns. GetTrafficPattern
+// returns nil without an error when there is no history. UpdateTrafficPattern
+// applies update to the stored pattern of a key, or to an empty one, and saves
+// the result atomically; update runs again if a concurrent update got there first.
+type TrafficRepository interface {
+	GetTrafficPattern(key TrafficKey) (*TrafficPattern, error)
+	UpdateTrafficPattern(key TrafficKey, update func(pattern *TrafficPattern)) error
+}
+
+// maxUpdateAttempts bounds the retries of optimistic updates
+const maxUpdateAttempts = 5
+
+// ErrUpdateConflict is returned when an optimistic update keeps losing to concurrent updates
+var ErrUpdateConflict = errors.New("too many concurrent updates")
+
+// Store provides all repositories of the server
+type Store interface {
+	UserRepository
+	RouteRepository
+	PreferenceRepository
+	APIKeyRepository
+	ScheduledTripRepository
+	TrafficRepository
+	Close() error
+}
+
+var (
+	_ Store = (*serverStore)(nil)
+	_ Store = (*SQLiteDB)(nil)
+	_ Store = (*MemoryDB)(nil)
+)
+
+// Open opens the store selected by DB_DRIVER:
+//   - postgres (default): PostgreSQL, with traffic patterns in MongoDB
+//   - sqlite: a single SQLite file at SQLITE_PATH
+//   - memory: in-process maps that are lost on exit
+func Open() (Store, error) {
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", "postgres":
+		postgres, err := NewPostgresDB()
+		if err != nil {
+			return nil, err
+		}
+		mongodb, err := NewMongoDB()
+		if err != nil {
+			postgres.Close()
+			return nil, err
+		}
+		return &serverStore{PostgresDB: postgres, MongoDB: mongodb}, nil
+	case "sqlite":
+		return NewSQLiteDB()
+	case "memory":
+		return NewMemoryDB(), nil
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q", driver)
+	}
+}
+
+// serverStore combines PostgreSQL and MongoDB
+type serverStore struct {
+	*PostgresDB
+	*MongoDB
+}
+
+// Close closes both connections
+func (s *serverStore) Close() error {
+	mongoErr := s.MongoDB.Close()
+	if err := s.PostgresDB.Close(); err != nil {
+		return err
+	}
+	return mongoErr
+}
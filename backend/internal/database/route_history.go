@@ -0,0 +1,163 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// RouteSort selects the order of a route history
+type RouteSort string
+
+const (
+	SortByDate     RouteSort = "date"
+	SortByEmission RouteSort = "emission"
+)
+
+const (
+	defaultRoutePageSize = 20
+	maxRoutePageSize     = 100
+)
+
+// BoundingBox is a latitude/longitude rectangle
+type BoundingBox struct {
+	MinLat float64
+	MinLng float64
+	MaxLat float64
+	MaxLng float64
+}
+
+// RouteFilter selects a page of a user's saved routes
+type RouteFilter struct {
+	UserID          uint
+	From            *time.Time   // created at or after
+	To              *time.Time   // created before
+	Modes           []string     // routes with at least one segment in any of these modes
+	BBox            *BoundingBox // routes starting or ending inside the box
+	RecommendedOnly bool         // skip alternatives that were not ranked first
+	Sort            RouteSort
+	Descending      bool
+	Cursor          string // from the previous page, empty for the first
+	Limit           int
+}
+
+// pageSize returns the requested page size within the allowed range
+func (filter RouteFilter) pageSize() int {
+	if filter.Limit <= 0 {
+		return defaultRoutePageSize
+	}
+	if filter.Limit > maxRoutePageSize {
+		return maxRoutePageSize
+	}
+	return filter.Limit
+}
+
+// routeCursor is the sort key of the last route of a page
+type routeCursor struct {
+	CreatedAt time.Time `json:"c,omitempty"`
+	Emission  float64   `json:"e,omitempty"`
+	ID        string    `json:"i"`
+}
+
+func encodeRouteCursor(route SavedRoute) string {
+	data, _ := json.Marshal(routeCursor{
+		CreatedAt: route.CreatedAt,
+		Emission:  route.CO2Emission,
+		ID:        route.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeRouteCursor(value string) (*routeCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor routeCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// GetUserRoutes retrieves one page of a user's saved routes with their segments
+// and charging stops. It returns the cursor of the next page, or an empty
+// string on the last page.
+func (db *sqlDB) GetUserRoutes(filter RouteFilter) ([]SavedRoute, string, error) {
+	limit := filter.pageSize()
+
+	query := db.db.Model(&SavedRoute{}).Where("user_id = ?", filter.UserID)
+	// Creation times are stored in UTC, so compare against UTC
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", filter.From.UTC())
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", filter.To.UTC())
+	}
+	if len(filter.Modes) > 0 {
+		query = query.Where(
+			"EXISTS (SELECT 1 FROM saved_route_segments s WHERE s.route_id = saved_routes.id AND s.mode IN ?)",
+			filter.Modes,
+		)
+	}
+	if b := filter.BBox; b != nil {
+		query = query.Where(
+			"((start_lat BETWEEN ? AND ? AND start_lng BETWEEN ? AND ?) OR (end_lat BETWEEN ? AND ? AND end_lng BETWEEN ? AND ?))",
+			b.MinLat, b.MaxLat, b.MinLng, b.MaxLng,
+			b.MinLat, b.MaxLat, b.MinLng, b.MaxLng,
+		)
+	}
+	if filter.RecommendedOnly {
+		query = query.Where("rank = 1")
+	}
+
+	// Keyset pagination on the sort column, with the ID breaking ties
+	column := "created_at"
+	if filter.Sort == SortByEmission {
+		column = "co2_emission"
+	}
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeRouteCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		var value interface{} = cursor.CreatedAt.UTC()
+		if filter.Sort == SortByEmission {
+			value = cursor.Emission
+		}
+		query = query.Where(
+			"("+column+" "+comparison+" ? OR ("+column+" = ? AND id "+comparison+" ?))",
+			value, value, cursor.ID,
+		)
+	}
+
+	var routes []SavedRoute
+	err := query.
+		Order(column+" "+direction).
+		Order("id "+direction).
+		Limit(limit+1).
+		Preload("Segments", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		Preload("ChargingStops", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		Find(&routes).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(routes) > limit {
+		routes = routes[:limit]
+		next = encodeRouteCursor(routes[limit-1])
+	}
+	return routes, next, nil
+}
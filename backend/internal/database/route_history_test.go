@@ -0,0 +1,146 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetUserRoutesPaging(t *testing.T) {
+	base := time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)
+	east := time.FixedZone("UTC+2", 2*60*60)
+	west := time.FixedZone("UTC-7", -7*60*60)
+
+	// Routes share creation times and emissions so that pages break inside
+	// ties, and are saved with different offsets; by creation time they are
+	// r1, r2 and r3 together, r4, r5 and r6 together, then r7
+	type fixture struct {
+		id       string
+		created  time.Time
+		emission float64
+		mode     string
+	}
+	fixtures := []fixture{
+		{id: "r5", created: base.Add(2 * time.Hour).In(west), emission: 300, mode: "car"},
+		{id: "r1", created: base, emission: 300, mode: "car"},
+		{id: "r7", created: base.Add(26 * time.Hour).In(east), emission: 0, mode: "bicycle"},
+		{id: "r3", created: base.In(east), emission: 120, mode: "public_transit"},
+		{id: "r6", created: base.Add(2 * time.Hour), emission: 120, mode: "car"},
+		{id: "r2", created: base.In(west), emission: 80, mode: "public_transit"},
+		{id: "r4", created: base.Add(90 * time.Minute).In(east), emission: 300, mode: "car"},
+	}
+
+	tests := []struct {
+		name   string
+		filter RouteFilter
+		want   []string
+	}{
+		{
+			name:   "oldest first",
+			filter: RouteFilter{Sort: SortByDate},
+			want:   []string{"r1", "r2", "r3", "r4", "r5", "r6", "r7"},
+		},
+		{
+			name:   "newest first",
+			filter: RouteFilter{Sort: SortByDate, Descending: true},
+			want:   []string{"r7", "r6", "r5", "r4", "r3", "r2", "r1"},
+		},
+		{
+			name:   "lowest emission first",
+			filter: RouteFilter{Sort: SortByEmission},
+			want:   []string{"r7", "r2", "r3", "r6", "r1", "r4", "r5"},
+		},
+		{
+			name:   "highest emission first",
+			filter: RouteFilter{Sort: SortByEmission, Descending: true},
+			want:   []string{"r5", "r4", "r1", "r6", "r3", "r2", "r7"},
+		},
+		{
+			name: "within a time range given in another zone",
+			filter: RouteFilter{
+				Sort: SortByDate,
+				From: timePtr(base.Add(time.Hour).In(west)),
+				To:   timePtr(base.Add(2 * time.Hour).In(east)),
+			},
+			want: []string{"r4"},
+		},
+		{
+			name: "from a time shared by several routes",
+			filter: RouteFilter{
+				Sort:       SortByDate,
+				Descending: true,
+				From:       timePtr(base.Add(2 * time.Hour).In(east)),
+			},
+			want: []string{"r7", "r6", "r5"},
+		},
+		{
+			name:   "by mode",
+			filter: RouteFilter{Sort: SortByEmission, Modes: []string{"public_transit", "bicycle"}},
+			want:   []string{"r7", "r2", "r3"},
+		},
+	}
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			userID := createTestUser(t, store, "history@example.com")
+			otherID := createTestUser(t, store, "other@example.com")
+			var routes []*SavedRoute
+			for _, f := range fixtures {
+				routes = append(routes, &SavedRoute{
+					ID:            f.id,
+					UserID:        &userID,
+					CO2Emission:   f.emission,
+					TransportMode: f.mode,
+					Rank:          1,
+					CreatedAt:     f.created,
+					Segments:      []SavedRouteSegment{{Mode: f.mode}},
+				})
+			}
+			routes = append(routes, &SavedRoute{ID: "other", UserID: &otherID, TransportMode: "car", Rank: 1, CreatedAt: base})
+			if err := store.SaveRoutes(routes); err != nil {
+				t.Fatalf("SaveRoutes: %v", err)
+			}
+
+			for _, tt := range tests {
+				for _, limit := range []int{1, 2, 3, 10} {
+					t.Run(fmt.Sprintf("%s by %d", tt.name, limit), func(t *testing.T) {
+						filter := tt.filter
+						filter.UserID = userID
+						filter.Limit = limit
+
+						var got []string
+						for page := 0; page <= len(fixtures); page++ {
+							routes, next, err := store.GetUserRoutes(filter)
+							if err != nil {
+								t.Fatalf("GetUserRoutes: %v", err)
+							}
+							if len(routes) > limit {
+								t.Fatalf("page of %d routes, want at most %d", len(routes), limit)
+							}
+							for _, route := range routes {
+								got = append(got, route.ID)
+							}
+							if next == "" {
+								break
+							}
+							filter.Cursor = next
+						}
+						if !reflect.DeepEqual(got, tt.want) {
+							t.Errorf("routes = %v, want %v", got, tt.want)
+						}
+					})
+				}
+			}
+
+			if _, _, err := store.GetUserRoutes(RouteFilter{UserID: userID, Cursor: "not a cursor"}); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("GetUserRoutes with a bad cursor error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
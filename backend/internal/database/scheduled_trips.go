@@ -0,0 +1,113 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ScheduledTrip is a recurring trip, such as a commute arriving at 09:00 on
+// weekdays, that is planned again before every occurrence
+type ScheduledTrip struct {
+	gorm.Model
+	UserID       uint    `gorm:"index;not null"` // owner
+	Name         string  `gorm:"not null"`
+	StartLat     float64 `gorm:"not null"`
+	StartLng     float64 `gorm:"not null"`
+	EndLat       float64 `gorm:"not null"`
+	EndLng       float64 `gorm:"not null"`
+	StartAddress string
+	EndAddress   string
+	Days         string     `gorm:"not null"` // comma-separated weekdays, e.g. "mon,tue"
+	ArriveBy     string     `gorm:"not null"` // local time of day, HH:MM
+	TimeZone     string     `gorm:"not null"` // IANA name
+	Profile      string     // preference profile, empty for the default
+	Preferences  string     `gorm:"type:text"`      // JSON-encoded route preferences, empty to use the profile
+	NextPlanAt   time.Time  `gorm:"index;not null"` // when the next occurrence is planned
+	Version      int        `gorm:"not null"`       // incremented when a planner claims the trip
+	LastRouteID  *string    // most recently planned route
+	PlannedFor   *time.Time // arrival the last plan was made for
+	LastError    string     // why the last plan failed, empty if it succeeded
+}
+
+// CreateScheduledTrip stores a new scheduled trip. Plan times are stored in
+// UTC since SQLite keeps times as text with their offset and compares them as
+// strings
+func (db *sqlDB) CreateScheduledTrip(trip *ScheduledTrip) error {
+	trip.NextPlanAt = trip.NextPlanAt.UTC()
+	return db.db.Create(trip).Error
+}
+
+// ListScheduledTrips retrieves all scheduled trips of a user
+func (db *sqlDB) ListScheduledTrips(userID uint) ([]ScheduledTrip, error) {
+	var trips []ScheduledTrip
+	if err := db.db.Where("user_id = ?", userID).Order("id").Find(&trips).Error; err != nil {
+		return nil, err
+	}
+	return trips, nil
+}
+
+// GetScheduledTrip retrieves a user's scheduled trip by ID. It returns
+// ErrNotFound if there is none.
+func (db *sqlDB) GetScheduledTrip(userID, id uint) (*ScheduledTrip, error) {
+	var trip ScheduledTrip
+	err := db.db.Where("user_id = ?", userID).First(&trip, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &trip, nil
+}
+
+// DeleteScheduledTrip removes a user's scheduled trip. It returns ErrNotFound
+// if the user has no trip with the ID.
+func (db *sqlDB) DeleteScheduledTrip(userID, id uint) error {
+	result := db.db.Where("user_id = ?", userID).Delete(&ScheduledTrip{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetDueScheduledTrips retrieves the trips whose next plan is due at now
+func (db *sqlDB) GetDueScheduledTrips(now time.Time) ([]ScheduledTrip, error) {
+	var trips []ScheduledTrip
+	if err := db.db.Where("next_plan_at <= ?", now.UTC()).Order("next_plan_at").Find(&trips).Error; err != nil {
+		return nil, err
+	}
+	return trips, nil
+}
+
+// ClaimScheduledTrip moves a trip's next plan to next if the trip is unchanged
+// since it was read. It reports false if another planner claimed it first.
+func (db *sqlDB) ClaimScheduledTrip(trip *ScheduledTrip, next time.Time) (bool, error) {
+	result := db.db.Model(&ScheduledTrip{}).
+		Where("id = ? AND version = ?", trip.ID, trip.Version).
+		Updates(map[string]interface{}{
+			"next_plan_at": next.UTC(),
+			"version":      trip.Version + 1,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RecordScheduledTripPlan stores the outcome of planning a trip for an
+// arrival: the route, or the error if routeID is empty
+func (db *sqlDB) RecordScheduledTripPlan(id uint, plannedFor time.Time, routeID string, planErr string) error {
+	updates := map[string]interface{}{
+		"planned_for": plannedFor.UTC(),
+		"last_error":  planErr,
+	}
+	if routeID != "" {
+		updates["last_route_id"] = routeID
+	}
+	return db.db.Model(&ScheduledTrip{}).Where("id = ?", id).Updates(updates).Error
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduledTripsDueAcrossTimeZones(t *testing.T) {
+	zones := []*time.Location{
+		time.FixedZone("UTC-5", -5*60*60),
+		time.FixedZone("UTC+5:30", 5*60*60+30*60),
+		time.FixedZone("UTC+9", 9*60*60),
+	}
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			userID := createTestUser(t, store, "trips@example.com")
+			for _, zone := range zones {
+				planAt := time.Date(2026, 3, 10, 5, 0, 0, 0, zone)
+				trip := &ScheduledTrip{
+					UserID:     userID,
+					Name:       zone.String(),
+					Days:       "tue",
+					ArriveBy:   "09:00",
+					TimeZone:   zone.String(),
+					NextPlanAt: planAt,
+				}
+				if err := store.CreateScheduledTrip(trip); err != nil {
+					t.Fatalf("CreateScheduledTrip: %v", err)
+				}
+
+				due := func(now time.Time) bool {
+					trips, err := store.GetDueScheduledTrips(now)
+					if err != nil {
+						t.Fatalf("GetDueScheduledTrips: %v", err)
+					}
+					for _, d := range trips {
+						if d.ID == trip.ID {
+							return true
+						}
+					}
+					return false
+				}
+				if due(planAt.Add(-time.Minute).UTC()) {
+					t.Errorf("%s: due a minute before %v", zone, planAt)
+				}
+				if !due(planAt.UTC()) {
+					t.Errorf("%s: not due at %v", zone, planAt)
+				}
+				if !due(planAt.Add(time.Minute).In(time.FixedZone("UTC-8", -8*60*60))) {
+					t.Errorf("%s: not due a minute after %v, asked in another zone", zone, planAt)
+				}
+
+				// Claiming moves the next plan on a week, in the trip's zone
+				stored, err := store.GetScheduledTrip(userID, trip.ID)
+				if err != nil {
+					t.Fatalf("GetScheduledTrip: %v", err)
+				}
+				if !stored.NextPlanAt.Equal(planAt) {
+					t.Errorf("%s: next plan at %v, want %v", zone, stored.NextPlanAt, planAt)
+				}
+				next := planAt.AddDate(0, 0, 7)
+				claimed, err := store.ClaimScheduledTrip(stored, next)
+				if err != nil || !claimed {
+					t.Fatalf("ClaimScheduledTrip = %v, %v", claimed, err)
+				}
+				if claimed, _ := store.ClaimScheduledTrip(stored, next); claimed {
+					t.Errorf("%s: claimed twice with the same version", zone)
+				}
+				if due(next.Add(-time.Minute).UTC()) {
+					t.Errorf("%s: due a minute before the claimed %v", zone, next)
+				}
+				if !due(next.UTC()) {
+					t.Errorf("%s: not due at the claimed %v", zone, next)
+				}
+
+				arrival := time.Date(2026, 3, 10, 9, 0, 0, 0, zone)
+				if err := store.RecordScheduledTripPlan(trip.ID, arrival, "", "no route"); err != nil {
+					t.Fatalf("RecordScheduledTripPlan: %v", err)
+				}
+				stored, err = store.GetScheduledTrip(userID, trip.ID)
+				if err != nil {
+					t.Fatalf("GetScheduledTrip: %v", err)
+				}
+				if stored.PlannedFor == nil || !stored.PlannedFor.Equal(arrival) {
+					t.Errorf("%s: planned for %v, want %v", zone, stored.PlannedFor, arrival)
+				}
+				if stored.LastError != "no route" {
+					t.Errorf("%s: last error %q, want %q", zone, stored.LastError, "no route")
+				}
+
+				if err := store.DeleteScheduledTrip(userID, trip.ID); err != nil {
+					t.Fatalf("DeleteScheduledTrip: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SQLiteDB stores everything, including traffic patterns, in one SQLite file.
+// It needs no database server, which suits development and tests.
+type SQLiteDB struct {
+	sqlDB
+}
+
+// sqliteTrafficPattern is a row of the traffic_patterns table
+type sqliteTrafficPattern struct {
+	ID uint `gorm:"primaryKey"`
+	TrafficPattern
+}
+
+func (sqliteTrafficPattern) TableName() string {
+	return "traffic_patterns"
+}
+
+// NewSQLiteDB opens the SQLite database at SQLITE_PATH, greenroute.db by
+// default, and applies pending migrations. ":memory:" gives a private
+// database that is lost on exit.
+func NewSQLiteDB() (*SQLiteDB, error) {
+	path := os.Getenv("SQLITE_PATH")
+	if path == "" {
+		path = "greenroute.db"
+	}
+
+	db, err := gorm.Open(sqlite.Open(path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	if path == ":memory:" {
+		// Every connection would get its own empty database
+		conn, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		conn.SetMaxOpenConns(1)
+	}
+
+	migrator, err := newMigrator(db, "sqlite")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrator.Up(0); err != nil {
+		return nil, fmt.Errorf("failed to migrate SQLite database: %v", err)
+	}
+
+	return &SQLiteDB{
+		sqlDB: sqlDB{db: db},
+	}, nil
+}
+
+// UpdateTrafficPattern updates the traffic pattern of a key. Like MongoDB it
+// relies on the version column rather than locks: an update only succeeds if
+// the row is unchanged since it was read.
+func (db *SQLiteDB) UpdateTrafficPattern(key TrafficKey, update func(pattern *TrafficPattern)) error {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		var rows []sqliteTrafficPattern
+		err := db.db.Where(
+			"start_cell = ? AND end_cell = ? AND day_of_week = ? AND hour_of_day = ?",
+			key.StartCell, key.EndCell, key.DayOfWeek, key.HourOfDay,
+		).Limit(1).Find(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		row := sqliteTrafficPattern{TrafficPattern: TrafficPattern{TrafficKey: key}}
+		if len(rows) > 0 {
+			row = rows[0]
+		}
+		version := row.Version
+		update(&row.TrafficPattern)
+		row.TrafficKey = key
+		row.Version = version + 1
+
+		var result *gorm.DB
+		if row.ID == 0 {
+			result = db.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+		} else {
+			result = db.db.Model(&sqliteTrafficPattern{}).
+				Where("id = ? AND version = ?", row.ID, version).
+				Select("*").
+				Updates(&row)
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+	}
+	return ErrUpdateConflict
+}
+
+// GetTrafficPattern retrieves historical traffic data for a cell pair and hour
+func (db *SQLiteDB) GetTrafficPattern(key TrafficKey) (*TrafficPattern, error) {
+	// Find rather than First: a missing pattern is the common case, not an error
+	var rows []sqliteTrafficPattern
+	err := db.db.Where(
+		"start_cell = ? AND end_cell = ? AND day_of_week = ? AND hour_of_day = ?",
+		key.StartCell, key.EndCell, key.DayOfWeek, key.HourOfDay,
+	).Limit(1).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0].TrafficPattern, nil
+}
@@ -0,0 +1,288 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+// testStores returns an empty SQLite and in-memory store, by name
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	t.Setenv("SQLITE_PATH", ":memory:")
+	sqlite, err := NewSQLiteDB()
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]Store{"sqlite": sqlite, "memory": NewMemoryDB()}
+}
+
+// createTestUser stores a user to own test records
+func createTestUser(t *testing.T, store Store, email string) uint {
+	t.Helper()
+	user := &User{Email: email, Name: "Test", PasswordHash: "hash"}
+	if err := store.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user.ID
+}
+
+func TestStoreUsers(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			id := createTestUser(t, store, "ada@example.com")
+
+			if err := store.CreateUser(&User{Email: "ada@example.com", Name: "Other", PasswordHash: "hash"}); !errors.Is(err, ErrAlreadyExists) {
+				t.Errorf("CreateUser with a taken email error = %v, want ErrAlreadyExists", err)
+			}
+
+			user, err := store.GetUser(id)
+			if err != nil || user.Email != "ada@example.com" {
+				t.Errorf("GetUser = %+v, %v", user, err)
+			}
+			user, err = store.GetUserByEmail("ada@example.com")
+			if err != nil || user.ID != id {
+				t.Errorf("GetUserByEmail = %+v, %v; want user %d", user, err, id)
+			}
+			if _, err := store.GetUser(id + 100); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetUser of an unknown ID error = %v, want ErrNotFound", err)
+			}
+			if _, err := store.GetUserByEmail("grace@example.com"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetUserByEmail of an unknown email error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestStoreRoutes(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			userID := createTestUser(t, store, "routes@example.com")
+			route := &SavedRoute{
+				ID:            "route-1",
+				UserID:        &userID,
+				Distance:      1200,
+				Duration:      300,
+				CO2Emission:   150,
+				TransportMode: "car",
+				Rank:          1,
+				Segments: []SavedRouteSegment{
+					{Position: 0, Mode: "walking", Distance: 200},
+					{Position: 1, Mode: "car", Distance: 1000},
+				},
+				ChargingStops: []SavedChargingStop{{Position: 0, StationID: 42, PowerKW: 150}},
+			}
+			if err := store.SaveRoutes([]*SavedRoute{route}); err != nil {
+				t.Fatalf("SaveRoutes: %v", err)
+			}
+
+			got, err := store.GetRoute("route-1")
+			if err != nil {
+				t.Fatalf("GetRoute: %v", err)
+			}
+			if got.UserID == nil || *got.UserID != userID || got.CO2Emission != 150 || got.CreatedAt.IsZero() {
+				t.Errorf("GetRoute = %+v", got)
+			}
+			if len(got.Segments) != 2 || got.Segments[0].Mode != "walking" || got.Segments[1].Mode != "car" {
+				t.Errorf("segments = %+v, want walking then car", got.Segments)
+			}
+			if len(got.ChargingStops) != 1 || got.ChargingStops[0].StationID != 42 {
+				t.Errorf("charging stops = %+v, want station 42", got.ChargingStops)
+			}
+
+			// A batch with a taken ID saves none of its routes
+			batch := []*SavedRoute{
+				{ID: "route-2", UserID: &userID, TransportMode: "car", Rank: 1},
+				{ID: "route-1", UserID: &userID, TransportMode: "car", Rank: 2},
+			}
+			if err := store.SaveRoutes(batch); err == nil {
+				t.Errorf("SaveRoutes with a taken ID succeeded")
+			}
+			if _, err := store.GetRoute("route-2"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetRoute of a route from a failed batch error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestStorePreferenceDefaults(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			userID := createTestUser(t, store, "prefs@example.com")
+			otherID := createTestUser(t, store, "other@example.com")
+
+			defaultName := func(userID uint) string {
+				t.Helper()
+				pref, err := store.GetRoutePreference(userID, "")
+				if errors.Is(err, ErrNotFound) {
+					return ""
+				}
+				if err != nil {
+					t.Fatalf("GetRoutePreference: %v", err)
+				}
+				return pref.Name
+			}
+			if got := defaultName(userID); got != "" {
+				t.Fatalf("default profile before any = %q", got)
+			}
+
+			// The first profile becomes the default, later ones do not
+			commute := &RoutePreference{UserID: userID, Name: "commute", PreferredModes: "bicycle"}
+			weekend := &RoutePreference{UserID: userID, Name: "weekend", PreferredModes: "car"}
+			for _, pref := range []*RoutePreference{weekend, commute} {
+				if err := store.CreateRoutePreference(pref); err != nil {
+					t.Fatalf("CreateRoutePreference: %v", err)
+				}
+			}
+			if !weekend.IsDefault || commute.IsDefault {
+				t.Errorf("defaults after creation: weekend %v, commute %v; want weekend only", weekend.IsDefault, commute.IsDefault)
+			}
+			if got := defaultName(userID); got != "weekend" {
+				t.Errorf("default profile = %q, want weekend", got)
+			}
+
+			// Each user has a default of their own
+			if err := store.CreateRoutePreference(&RoutePreference{UserID: otherID, Name: "commute"}); err != nil {
+				t.Fatalf("CreateRoutePreference for another user: %v", err)
+			}
+			if got := defaultName(otherID); got != "commute" {
+				t.Errorf("other user's default profile = %q, want commute", got)
+			}
+
+			err := store.CreateRoutePreference(&RoutePreference{UserID: userID, Name: "commute"})
+			if !errors.Is(err, ErrAlreadyExists) {
+				t.Errorf("CreateRoutePreference with a taken name error = %v, want ErrAlreadyExists", err)
+			}
+
+			// Making another profile the default unsets the old one
+			commute.IsDefault = true
+			if err := store.UpdateRoutePreference(commute); err != nil {
+				t.Fatalf("UpdateRoutePreference: %v", err)
+			}
+			if got := defaultName(userID); got != "commute" {
+				t.Errorf("default profile after update = %q, want commute", got)
+			}
+			prefs, err := store.ListRoutePreferences(userID)
+			if err != nil {
+				t.Fatalf("ListRoutePreferences: %v", err)
+			}
+			if len(prefs) != 2 || prefs[0].Name != "commute" || prefs[1].Name != "weekend" {
+				t.Fatalf("ListRoutePreferences = %+v, want commute and weekend", prefs)
+			}
+			if !prefs[0].IsDefault || prefs[1].IsDefault {
+				t.Errorf("defaults after update: commute %v, weekend %v; want commute only", prefs[0].IsDefault, prefs[1].IsDefault)
+			}
+			if got := defaultName(otherID); got != "commute" {
+				t.Errorf("other user's default profile after update = %q, want commute", got)
+			}
+
+			// Deleting the default leaves the user without one, and frees the name
+			if err := store.DeleteRoutePreference(userID, "commute"); err != nil {
+				t.Fatalf("DeleteRoutePreference: %v", err)
+			}
+			if got := defaultName(userID); got != "" {
+				t.Errorf("default profile after deleting it = %q", got)
+			}
+			if err := store.DeleteRoutePreference(userID, "commute"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("DeleteRoutePreference twice error = %v, want ErrNotFound", err)
+			}
+			if err := store.CreateRoutePreference(&RoutePreference{UserID: userID, Name: "commute"}); err != nil {
+				t.Errorf("CreateRoutePreference with a deleted name: %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreAPIKeyQuota(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			userID := createTestUser(t, store, "keys@example.com")
+			key := &APIKey{UserID: userID, Name: "server", Prefix: "gr_abc", KeyHash: "hash-1", RateLimitPerMinute: 60, MonthlyQuota: 2}
+			if err := store.CreateAPIKey(key); err != nil {
+				t.Fatalf("CreateAPIKey: %v", err)
+			}
+			if got, err := store.GetAPIKeyByHash("hash-1"); err != nil || got.ID != key.ID {
+				t.Fatalf("GetAPIKeyByHash = %+v, %v; want key %d", got, err, key.ID)
+			}
+
+			var accepted []bool
+			for i := 0; i < 3; i++ {
+				ok, err := store.ConsumeAPIKeyQuota(key.ID, "2026-03", key.MonthlyQuota)
+				if err != nil {
+					t.Fatalf("ConsumeAPIKeyQuota: %v", err)
+				}
+				accepted = append(accepted, ok)
+			}
+			if !accepted[0] || !accepted[1] || accepted[2] {
+				t.Errorf("requests accepted = %v, want the first two", accepted)
+			}
+			if err := store.RecordAPIKeyRejection(key.ID, "2026-03"); err != nil {
+				t.Fatalf("RecordAPIKeyRejection: %v", err)
+			}
+			if ok, err := store.ConsumeAPIKeyQuota(key.ID, "2026-04", key.MonthlyQuota); err != nil || !ok {
+				t.Errorf("ConsumeAPIKeyQuota in a new month = %v, %v; want accepted", ok, err)
+			}
+
+			usage, err := store.GetAPIKeyUsage(key.ID)
+			if err != nil {
+				t.Fatalf("GetAPIKeyUsage: %v", err)
+			}
+			if len(usage) != 2 {
+				t.Fatalf("GetAPIKeyUsage = %+v, want two months", usage)
+			}
+			if usage[0].Month != "2026-04" || usage[0].Requests != 1 || usage[0].Rejected != 0 {
+				t.Errorf("April usage = %+v, want 1 request", usage[0])
+			}
+			if usage[1].Month != "2026-03" || usage[1].Requests != 2 || usage[1].Rejected != 2 {
+				t.Errorf("March usage = %+v, want 2 requests and 2 rejected", usage[1])
+			}
+
+			if err := store.RevokeAPIKey(userID+100, key.ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("RevokeAPIKey by another user error = %v, want ErrNotFound", err)
+			}
+			if err := store.RevokeAPIKey(userID, key.ID); err != nil {
+				t.Fatalf("RevokeAPIKey: %v", err)
+			}
+			if err := store.RevokeAPIKey(userID, key.ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("RevokeAPIKey twice error = %v, want ErrNotFound", err)
+			}
+			if _, err := store.GetAPIKeyByHash("hash-1"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetAPIKeyByHash of a revoked key error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestStoreTrafficPatterns(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			key := TrafficKey{StartCell: "a", EndCell: "b", DayOfWeek: 1, HourOfDay: 8}
+			if pattern, err := store.GetTrafficPattern(key); err != nil || pattern != nil {
+				t.Fatalf("GetTrafficPattern without history = %+v, %v; want nil", pattern, err)
+			}
+
+			for _, duration := range []float64{600, 900} {
+				err := store.UpdateTrafficPattern(key, func(pattern *TrafficPattern) {
+					pattern.SampleCount++
+					pattern.Mean += duration / 2
+				})
+				if err != nil {
+					t.Fatalf("UpdateTrafficPattern: %v", err)
+				}
+			}
+			pattern, err := store.GetTrafficPattern(key)
+			if err != nil || pattern == nil {
+				t.Fatalf("GetTrafficPattern = %+v, %v", pattern, err)
+			}
+			if pattern.TrafficKey != key || pattern.SampleCount != 2 || pattern.Mean != 750 || pattern.Version != 2 {
+				t.Errorf("pattern = %+v, want 2 samples averaging 750 at version 2", pattern)
+			}
+
+			other := key
+			other.HourOfDay = 9
+			if pattern, err := store.GetTrafficPattern(other); err != nil || pattern != nil {
+				t.Errorf("GetTrafficPattern of another hour = %+v, %v; want nil", pattern, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package database
+
+import "time"
+
+// TrafficKey identifies the traffic history of trips between two geohash
+// cells in one hour of the week. Trips starting and ending within the same
+// cells share their history.
+type TrafficKey struct {
+	StartCell string `bson:"start_cell"`
+	EndCell   string `bson:"end_cell"`
+	DayOfWeek int    `bson:"day_of_week"` // 0 = Sunday, 6 = Saturday
+	HourOfDay int    `bson:"hour_of_day"` // 0-23
+}
+
+// TrafficPattern holds exponentially decayed travel time statistics for trips
+// between two cells. Durations are in seconds; older samples count for less,
+// so Weight is the effective number of samples rather than a count.
+type TrafficPattern struct {
+	TrafficKey  `bson:",inline"`
+	StartLat    float64   `bson:"start_lat"` // start of the most recent sample
+	StartLng    float64   `bson:"start_lng"`
+	EndLat      float64   `bson:"end_lat"` // end of the most recent sample
+	EndLng      float64   `bson:"end_lng"`
+	Mean        float64   `bson:"mean"`
+	Variance    float64   `bson:"variance"`
+	P50         float64   `bson:"p50"`
+	P90         float64   `bson:"p90"`
+	Histogram   []float64 `bson:"histogram" gorm:"serializer:json"` // decayed sample weights per duration bin
+	Weight      float64   `bson:"weight"`
+	SampleCount int       `bson:"sample_count"` // samples ever recorded
+	Timestamp   time.Time `bson:"timestamp"`    // of the most recent sample
+	Version     int       `bson:"version"`      // incremented on every update
+}
@@ -0,0 +1,170 @@
+package elevation
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"greenroute/internal/geo"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxCachedSamples bounds the decoded pixels kept in memory, about 128 MB
+const maxCachedSamples = 32 << 20
+
+// ErrNoCoverage is returned for points outside every elevation tile
+var ErrNoCoverage = errors.New("no elevation data covers the path")
+
+// DEM is a digital elevation model made of GeoTIFF tiles in geographic
+// coordinates, such as SRTM. Only tile headers are read up front; pixel blocks
+// are decoded when first needed and the least recently used are evicted.
+type DEM struct {
+	tiles []*tile
+
+	mu      sync.Mutex
+	blocks  map[blockKey]*list.Element
+	recent  *list.List // of *cachedBlock, most recently used first
+	samples int
+}
+
+// blockKey identifies a pixel block of a tile
+type blockKey struct {
+	tile  *tile
+	block int
+}
+
+type cachedBlock struct {
+	key     blockKey
+	samples []float32
+}
+
+// NewDEM reads the GeoTIFF tiles (*.tif, *.tiff) in ELEVATION_DEM_DIR. It
+// returns nil when no directory is configured.
+func NewDEM() (*DEM, error) {
+	dir := os.Getenv("ELEVATION_DEM_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list elevation tiles: %v", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".tif", ".tiff":
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no GeoTIFF tiles found in %s", dir)
+	}
+	return Load(paths...)
+}
+
+// Load reads the headers of GeoTIFF elevation tiles. Where tiles overlap, the
+// one with the finest resolution is used.
+func Load(paths ...string) (*DEM, error) {
+	d := &DEM{
+		blocks: make(map[blockKey]*list.Element),
+		recent: list.New(),
+	}
+	for _, path := range paths {
+		t, err := readTile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read elevation tile %s: %v", filepath.Base(path), err)
+		}
+		d.tiles = append(d.tiles, t)
+	}
+	sort.SliceStable(d.tiles, func(i, j int) bool {
+		return d.tiles[i].scaleLng*d.tiles[i].scaleLat < d.tiles[j].scaleLng*d.tiles[j].scaleLat
+	})
+	return d, nil
+}
+
+// Tiles returns the number of tiles in the model
+func (d *DEM) Tiles() int {
+	return len(d.tiles)
+}
+
+// Elevation returns the height of a point above sea level in meters,
+// interpolated between the four nearest pixels. It returns NaN over voids and
+// ErrNoCoverage outside every tile.
+func (d *DEM) Elevation(p geo.Point) (float64, error) {
+	for _, t := range d.tiles {
+		x, y, ok := t.pixel(p.Lat, p.Lng)
+		if !ok {
+			continue
+		}
+		return d.interpolate(t, x, y)
+	}
+	return 0, ErrNoCoverage
+}
+
+// interpolate blends the pixels around a fractional position, ignoring voids
+// as long as one of them has a value
+func (d *DEM) interpolate(t *tile, x, y float64) (float64, error) {
+	x = math.Max(0, math.Min(x, float64(t.width-1)))
+	y = math.Max(0, math.Min(y, float64(t.height-1)))
+	x0, y0 := int(x), int(y)
+	x1, y1 := min(x0+1, t.width-1), min(y0+1, t.height-1)
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	var sum, weights float64
+	for _, c := range []struct {
+		x, y   int
+		weight float64
+	}{
+		{x0, y0, (1 - fx) * (1 - fy)},
+		{x1, y0, fx * (1 - fy)},
+		{x0, y1, (1 - fx) * fy},
+		{x1, y1, fx * fy},
+	} {
+		if c.weight == 0 {
+			continue
+		}
+		v, err := d.pixel(t, c.x, c.y)
+		if err != nil {
+			return 0, err
+		}
+		if !math.IsNaN(v) {
+			sum += v * c.weight
+			weights += c.weight
+		}
+	}
+	if weights == 0 {
+		return math.NaN(), nil
+	}
+	return sum / weights, nil
+}
+
+// pixel returns the value of one pixel, decoding its block if needed
+func (d *DEM) pixel(t *tile, x, y int) (float64, error) {
+	block, index := t.block(x, y)
+	key := blockKey{tile: t, block: block}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.blocks[key]; ok {
+		d.recent.MoveToFront(e)
+		return float64(e.Value.(*cachedBlock).samples[index]), nil
+	}
+
+	samples, err := t.readBlock(block)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read elevation tile %s: %v", filepath.Base(t.path), err)
+	}
+	d.blocks[key] = d.recent.PushFront(&cachedBlock{key: key, samples: samples})
+	d.samples += len(samples)
+	for d.samples > maxCachedSamples && d.recent.Len() > 1 {
+		oldest := d.recent.Remove(d.recent.Back()).(*cachedBlock)
+		delete(d.blocks, oldest.key)
+		d.samples -= len(oldest.samples)
+	}
+	return float64(samples[index]), nil
+}
@@ -0,0 +1,415 @@
+package elevation
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/tiff/lzw"
+)
+
+// TIFF and GeoTIFF tags read from the first image directory
+const (
+	tagImageWidth      = 256
+	tagImageLength     = 257
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagStripOffsets    = 273
+	tagSamplesPerPixel = 277
+	tagRowsPerStrip    = 278
+	tagStripByteCounts = 279
+	tagPredictor       = 317
+	tagTileWidth       = 322
+	tagTileLength      = 323
+	tagTileOffsets     = 324
+	tagTileByteCounts  = 325
+	tagSampleFormat    = 339
+	tagPixelScale      = 33550
+	tagTiepoint        = 33922
+	tagGeoKeys         = 34735
+	tagNoData          = 42113
+)
+
+// GeoTIFF keys
+const (
+	keyModelType  = 1024
+	keyRasterType = 1025
+
+	modelTypeProjected = 1
+	rasterPixelIsPoint = 2
+)
+
+const (
+	compressionNone    = 1
+	compressionLZW     = 5
+	compressionDeflate = 8
+	compressionZlib    = 32946
+
+	predictorNone       = 1
+	predictorHorizontal = 2
+
+	formatUnsigned = 1
+	formatSigned   = 2
+	formatFloat    = 3
+)
+
+// tile is one GeoTIFF raster in geographic coordinates. Pixels are stored in
+// blocks, strips or tiles in TIFF terms, which are decoded on first use.
+type tile struct {
+	path          string
+	order         binary.ByteOrder
+	width, height int
+
+	// Coordinates of the centre of the top-left pixel and the pixel size, in degrees
+	originLng, originLat float64
+	scaleLng, scaleLat   float64
+
+	compression  int
+	predictor    int
+	sampleFormat int
+	bitsPerPixel int
+	noData       float64 // NaN if the file sets none
+
+	blockWidth, blockHeight int
+	blocksAcross            int
+	offsets, byteCounts     []uint64
+}
+
+// ifdEntry is a raw image file directory entry
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// readTile reads the header of a GeoTIFF file without decoding its pixels
+func readTile(path string) (*tile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var header [8]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return nil, errors.New("not a TIFF file")
+	}
+	t := &tile{path: path, noData: math.NaN()}
+	switch string(header[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, errors.New("not a TIFF file")
+	}
+	switch t.order.Uint16(header[2:4]) {
+	case 42:
+	case 43:
+		return nil, errors.New("BigTIFF is not supported")
+	default:
+		return nil, errors.New("not a TIFF file")
+	}
+
+	entries, err := readIFD(f, t.order, int64(t.order.Uint32(header[4:8])))
+	if err != nil {
+		return nil, err
+	}
+	uints := func(tag uint16) []uint64 { return entryUints(entries[tag], t.order) }
+	first := func(tag uint16, fallback int) int {
+		if values := uints(tag); len(values) > 0 {
+			return int(values[0])
+		}
+		return fallback
+	}
+
+	t.width, t.height = first(tagImageWidth, 0), first(tagImageLength, 0)
+	if t.width == 0 || t.height == 0 {
+		return nil, errors.New("missing image size")
+	}
+	if first(tagSamplesPerPixel, 1) != 1 {
+		return nil, errors.New("only single band rasters are supported")
+	}
+	t.bitsPerPixel = first(tagBitsPerSample, 1)
+	t.sampleFormat = first(tagSampleFormat, formatUnsigned)
+	switch {
+	case t.sampleFormat == formatFloat && (t.bitsPerPixel == 32 || t.bitsPerPixel == 64):
+	case (t.sampleFormat == formatUnsigned || t.sampleFormat == formatSigned) &&
+		(t.bitsPerPixel == 8 || t.bitsPerPixel == 16 || t.bitsPerPixel == 32):
+	default:
+		return nil, fmt.Errorf("unsupported sample format %d with %d bits", t.sampleFormat, t.bitsPerPixel)
+	}
+
+	t.compression = first(tagCompression, compressionNone)
+	switch t.compression {
+	case compressionNone, compressionLZW, compressionDeflate, compressionZlib:
+	default:
+		return nil, fmt.Errorf("unsupported compression %d", t.compression)
+	}
+	t.predictor = first(tagPredictor, predictorNone)
+	if t.predictor != predictorNone && (t.predictor != predictorHorizontal || t.sampleFormat == formatFloat) {
+		return nil, fmt.Errorf("unsupported predictor %d", t.predictor)
+	}
+
+	if _, tiled := entries[tagTileWidth]; tiled {
+		t.blockWidth, t.blockHeight = first(tagTileWidth, 0), first(tagTileLength, 0)
+		t.offsets, t.byteCounts = uints(tagTileOffsets), uints(tagTileByteCounts)
+	} else {
+		t.blockWidth, t.blockHeight = t.width, min(first(tagRowsPerStrip, t.height), t.height)
+		t.offsets, t.byteCounts = uints(tagStripOffsets), uints(tagStripByteCounts)
+	}
+	if t.blockWidth <= 0 || t.blockHeight <= 0 {
+		return nil, errors.New("invalid block size")
+	}
+	t.blocksAcross = (t.width + t.blockWidth - 1) / t.blockWidth
+	blocks := t.blocksAcross * ((t.height + t.blockHeight - 1) / t.blockHeight)
+	if len(t.offsets) != blocks || len(t.byteCounts) != blocks {
+		return nil, errors.New("missing block offsets")
+	}
+
+	if err := t.readGeoreference(entries); err != nil {
+		return nil, err
+	}
+	if noData := strings.TrimSpace(strings.TrimRight(string(entries[tagNoData].data), "\x00")); noData != "" {
+		if t.noData, err = strconv.ParseFloat(noData, 64); err != nil {
+			return nil, fmt.Errorf("invalid nodata value %q", noData)
+		}
+	}
+	return t, nil
+}
+
+// readGeoreference reads the position and size of the pixels in degrees
+func (t *tile) readGeoreference(entries map[uint16]ifdEntry) error {
+	scale := entryFloats(entries[tagPixelScale], t.order)
+	tiepoint := entryFloats(entries[tagTiepoint], t.order)
+	if len(scale) < 2 || len(tiepoint) < 6 {
+		return errors.New("missing GeoTIFF pixel scale or tiepoint")
+	}
+	if scale[0] <= 0 || scale[1] <= 0 {
+		return errors.New("invalid GeoTIFF pixel scale")
+	}
+
+	// By default the tiepoint is the corner of its pixel, so centres are half a pixel in
+	offset := 0.5
+	keys := entryUints(entries[tagGeoKeys], t.order)
+	for i := 4; i+3 < len(keys); i += 4 {
+		if keys[i+1] != 0 {
+			continue // only keys held in the directory itself are needed
+		}
+		switch keys[i] {
+		case keyModelType:
+			if keys[i+3] == modelTypeProjected {
+				return errors.New("projected rasters are not supported, use geographic coordinates")
+			}
+		case keyRasterType:
+			if keys[i+3] == rasterPixelIsPoint {
+				offset = 0
+			}
+		}
+	}
+
+	t.scaleLng, t.scaleLat = scale[0], scale[1]
+	t.originLng = tiepoint[3] + (offset-tiepoint[0])*t.scaleLng
+	t.originLat = tiepoint[4] - (offset-tiepoint[1])*t.scaleLat
+	return nil
+}
+
+// readIFD reads the entries of an image file directory, loading values held
+// outside the entry
+func readIFD(f *os.File, order binary.ByteOrder, offset int64) (map[uint16]ifdEntry, error) {
+	var count [2]byte
+	if _, err := f.ReadAt(count[:], offset); err != nil {
+		return nil, fmt.Errorf("failed to read image directory: %v", err)
+	}
+	raw := make([]byte, 12*int(order.Uint16(count[:])))
+	if _, err := f.ReadAt(raw, offset+2); err != nil {
+		return nil, fmt.Errorf("failed to read image directory: %v", err)
+	}
+
+	entries := make(map[uint16]ifdEntry)
+	for i := 0; i < len(raw); i += 12 {
+		e := raw[i : i+12]
+		entry := ifdEntry{typ: order.Uint16(e[2:4]), count: order.Uint32(e[4:8])}
+		size := int64(typeSize(entry.typ)) * int64(entry.count)
+		if size == 0 {
+			continue // unknown type
+		}
+		if size <= 4 {
+			entry.data = e[8 : 8+size]
+		} else {
+			entry.data = make([]byte, size)
+			if _, err := f.ReadAt(entry.data, int64(order.Uint32(e[8:12]))); err != nil {
+				return nil, fmt.Errorf("failed to read tag %d: %v", order.Uint16(e[0:2]), err)
+			}
+		}
+		entries[order.Uint16(e[0:2])] = entry
+	}
+	return entries, nil
+}
+
+// typeSize returns the size in bytes of a TIFF field type, or 0 if unknown
+func typeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	default:
+		return 0
+	}
+}
+
+// entryUints returns the values of a SHORT or LONG entry
+func entryUints(entry ifdEntry, order binary.ByteOrder) []uint64 {
+	var values []uint64
+	switch entry.typ {
+	case 3:
+		for i := 0; i+2 <= len(entry.data); i += 2 {
+			values = append(values, uint64(order.Uint16(entry.data[i:])))
+		}
+	case 4:
+		for i := 0; i+4 <= len(entry.data); i += 4 {
+			values = append(values, uint64(order.Uint32(entry.data[i:])))
+		}
+	}
+	return values
+}
+
+// entryFloats returns the values of a DOUBLE entry
+func entryFloats(entry ifdEntry, order binary.ByteOrder) []float64 {
+	var values []float64
+	if entry.typ == 12 {
+		for i := 0; i+8 <= len(entry.data); i += 8 {
+			values = append(values, math.Float64frombits(order.Uint64(entry.data[i:])))
+		}
+	}
+	return values
+}
+
+// pixel returns the fractional pixel position of a point, and whether the
+// point lies on the raster
+func (t *tile) pixel(lat, lng float64) (x, y float64, ok bool) {
+	x = (lng - t.originLng) / t.scaleLng
+	y = (t.originLat - lat) / t.scaleLat
+	ok = x >= -0.5 && y >= -0.5 && x <= float64(t.width)-0.5 && y <= float64(t.height)-0.5
+	return x, y, ok
+}
+
+// block returns which block holds a pixel and its index within the block
+func (t *tile) block(x, y int) (block, index int) {
+	block = (y/t.blockHeight)*t.blocksAcross + x/t.blockWidth
+	index = (y%t.blockHeight)*t.blockWidth + x%t.blockWidth
+	return block, index
+}
+
+// readBlock decodes one block, with nodata pixels as NaN
+func (t *tile) readBlock(block int) ([]float32, error) {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	raw := make([]byte, t.byteCounts[block])
+	if _, err := f.ReadAt(raw, int64(t.offsets[block])); err != nil {
+		return nil, fmt.Errorf("failed to read block %d: %v", block, err)
+	}
+
+	var r io.Reader = bytes.NewReader(raw)
+	switch t.compression {
+	case compressionLZW:
+		lz := lzw.NewReader(r, lzw.MSB, 8)
+		defer lz.Close()
+		r = lz
+	case compressionDeflate, compressionZlib:
+		z, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress block %d: %v", block, err)
+		}
+		defer z.Close()
+		r = z
+	}
+
+	// Strips at the bottom of the image may be short, tiles are always padded
+	rows := t.blockHeight
+	if t.blockWidth == t.width {
+		rows = min(rows, t.height-(block/t.blocksAcross)*t.blockHeight)
+	}
+	size := t.bitsPerPixel / 8
+	data := make([]byte, t.blockWidth*rows*size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("failed to decompress block %d: %v", block, err)
+	}
+	if t.predictor == predictorHorizontal {
+		t.undoPredictor(data, t.blockWidth*size)
+	}
+
+	samples := make([]float32, t.blockWidth*t.blockHeight)
+	for i := range samples {
+		if i*size >= len(data) {
+			samples[i] = float32(math.NaN())
+			continue
+		}
+		v := t.sample(data[i*size:])
+		if v == t.noData {
+			v = math.NaN()
+		}
+		samples[i] = float32(v)
+	}
+	return samples, nil
+}
+
+// sample decodes one pixel value
+func (t *tile) sample(b []byte) float64 {
+	switch t.bitsPerPixel {
+	case 8:
+		if t.sampleFormat == formatSigned {
+			return float64(int8(b[0]))
+		}
+		return float64(b[0])
+	case 16:
+		if t.sampleFormat == formatSigned {
+			return float64(int16(t.order.Uint16(b)))
+		}
+		return float64(t.order.Uint16(b))
+	case 32:
+		switch t.sampleFormat {
+		case formatFloat:
+			return float64(math.Float32frombits(t.order.Uint32(b)))
+		case formatSigned:
+			return float64(int32(t.order.Uint32(b)))
+		}
+		return float64(t.order.Uint32(b))
+	default:
+		return math.Float64frombits(t.order.Uint64(b))
+	}
+}
+
+// undoPredictor reverses horizontal differencing, which stores each pixel as
+// the difference from the previous one in its row
+func (t *tile) undoPredictor(data []byte, rowBytes int) {
+	size := t.bitsPerPixel / 8
+	for row := 0; row+rowBytes <= len(data); row += rowBytes {
+		for i := row + size; i < row+rowBytes; i += size {
+			switch size {
+			case 1:
+				data[i] += data[i-1]
+			case 2:
+				t.order.PutUint16(data[i:], t.order.Uint16(data[i:])+t.order.Uint16(data[i-2:]))
+			case 4:
+				t.order.PutUint32(data[i:], t.order.Uint32(data[i:])+t.order.Uint32(data[i-4:]))
+			}
+		}
+	}
+}
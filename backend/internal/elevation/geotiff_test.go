@@ -0,0 +1,309 @@
+package elevation
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"greenroute/internal/geo"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Fixture tiles cover 40 by 30 pixels of 1/128 degree, so pixel centres are
+// exact in floating point, with the centre of the top-left pixel at 7 E, 46 N
+const (
+	fixtureWidth  = 40
+	fixtureHeight = 30
+	fixtureLng    = 7.0
+	fixtureLat    = 46.0
+	fixtureScale  = 1.0 / 128
+	fixtureVoid   = -32768
+)
+
+// fixtureHeightAt is the elevation of a fixture pixel, with a void at (5, 4)
+func fixtureHeightAt(col, row int) int16 {
+	if col == 5 && row == 4 {
+		return fixtureVoid
+	}
+	return int16(400 + 3*col - 7*row)
+}
+
+// fixture describes how a fixture tile is encoded
+type fixture struct {
+	tiled        bool
+	deflate      bool
+	predictor    bool
+	bigEndian    bool
+	pixelIsPoint bool
+	projected    bool
+	noData       string
+}
+
+// write encodes the fixture as an int16 GeoTIFF in dir
+func (f fixture) write(t *testing.T, dir string) string {
+	t.Helper()
+	var order binary.ByteOrder = binary.LittleEndian
+	if f.bigEndian {
+		order = binary.BigEndian
+	}
+	u16 := func(values ...int) []byte {
+		b := make([]byte, 2*len(values))
+		for i, v := range values {
+			order.PutUint16(b[2*i:], uint16(v))
+		}
+		return b
+	}
+	u32 := func(values ...int) []byte {
+		b := make([]byte, 4*len(values))
+		for i, v := range values {
+			order.PutUint32(b[4*i:], uint32(v))
+		}
+		return b
+	}
+	f64 := func(values ...float64) []byte {
+		b := make([]byte, 8*len(values))
+		for i, v := range values {
+			order.PutUint64(b[8*i:], math.Float64bits(v))
+		}
+		return b
+	}
+
+	// Strips of 7 rows, the last one shorter, or 16 by 16 tiles padded at the edges
+	blockWidth, blockHeight := fixtureWidth, 7
+	if f.tiled {
+		blockWidth, blockHeight = 16, 16
+	}
+	across := (fixtureWidth + blockWidth - 1) / blockWidth
+	down := (fixtureHeight + blockHeight - 1) / blockHeight
+
+	file := bytes.NewBuffer(make([]byte, 8)) // header, written last
+	var offsets, counts []int
+	for by := 0; by < down; by++ {
+		for bx := 0; bx < across; bx++ {
+			rows := blockHeight
+			if !f.tiled {
+				rows = min(blockHeight, fixtureHeight-by*blockHeight)
+			}
+			block := make([]byte, 2*blockWidth*rows)
+			for r := 0; r < rows; r++ {
+				var prev int16
+				for c := 0; c < blockWidth; c++ {
+					col, row := bx*blockWidth+c, by*blockHeight+r
+					var v int16
+					if col < fixtureWidth && row < fixtureHeight {
+						v = fixtureHeightAt(col, row)
+					}
+					stored := v
+					if f.predictor {
+						stored, prev = v-prev, v
+					}
+					order.PutUint16(block[2*(r*blockWidth+c):], uint16(stored))
+				}
+			}
+			if f.deflate {
+				var compressed bytes.Buffer
+				w := zlib.NewWriter(&compressed)
+				w.Write(block)
+				w.Close()
+				block = compressed.Bytes()
+			}
+			offsets = append(offsets, file.Len())
+			counts = append(counts, len(block))
+			file.Write(block)
+		}
+	}
+
+	compression, predictor := compressionNone, predictorNone
+	if f.deflate {
+		compression = compressionDeflate
+	}
+	if f.predictor {
+		predictor = predictorHorizontal
+	}
+	// The tiepoint anchors the centre of the top-left pixel either way
+	modelType, rasterType, tiepoint := 2, 1, 0.5
+	if f.pixelIsPoint {
+		rasterType, tiepoint = rasterPixelIsPoint, 0
+	}
+	if f.projected {
+		modelType = modelTypeProjected
+	}
+
+	type entry struct {
+		tag, typ uint16
+		count    int
+		data     []byte
+	}
+	entries := []entry{
+		{tagImageWidth, 4, 1, u32(fixtureWidth)},
+		{tagImageLength, 4, 1, u32(fixtureHeight)},
+		{tagBitsPerSample, 3, 1, u16(16)},
+		{tagCompression, 3, 1, u16(compression)},
+		{tagSamplesPerPixel, 3, 1, u16(1)},
+		{tagPredictor, 3, 1, u16(predictor)},
+		{tagSampleFormat, 3, 1, u16(formatSigned)},
+		{tagPixelScale, 12, 3, f64(fixtureScale, fixtureScale, 0)},
+		{tagTiepoint, 12, 6, f64(tiepoint, tiepoint, 0, fixtureLng, fixtureLat, 0)},
+		{tagGeoKeys, 3, 16, u16(1, 1, 0, 3, keyModelType, 0, 1, modelType, keyRasterType, 0, 1, rasterType, 2048, 0, 1, 4326)},
+	}
+	if f.tiled {
+		entries = append(entries,
+			entry{tagTileWidth, 3, 1, u16(blockWidth)},
+			entry{tagTileLength, 3, 1, u16(blockHeight)},
+			entry{tagTileOffsets, 4, len(offsets), u32(offsets...)},
+			entry{tagTileByteCounts, 4, len(counts), u32(counts...)},
+		)
+	} else {
+		entries = append(entries,
+			entry{tagStripOffsets, 4, len(offsets), u32(offsets...)},
+			entry{tagRowsPerStrip, 3, 1, u16(blockHeight)},
+			entry{tagStripByteCounts, 4, len(counts), u32(counts...)},
+		)
+	}
+	if f.noData != "" {
+		entries = append(entries, entry{tagNoData, 2, len(f.noData) + 1, append([]byte(f.noData), 0)})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	// Values longer than four bytes go before the directory, at even offsets
+	external := make([]int, len(entries))
+	for i, e := range entries {
+		if len(e.data) > 4 {
+			if file.Len()%2 == 1 {
+				file.WriteByte(0)
+			}
+			external[i] = file.Len()
+			file.Write(e.data)
+		}
+	}
+	if file.Len()%2 == 1 {
+		file.WriteByte(0)
+	}
+	directory := file.Len()
+	file.Write(u16(len(entries)))
+	for i, e := range entries {
+		file.Write(u16(int(e.tag), int(e.typ)))
+		file.Write(u32(e.count))
+		if len(e.data) > 4 {
+			file.Write(u32(external[i]))
+		} else {
+			value := make([]byte, 4)
+			copy(value, e.data)
+			file.Write(value)
+		}
+	}
+	file.Write(u32(0))
+
+	data := file.Bytes()
+	copy(data, "II")
+	if f.bigEndian {
+		copy(data, "MM")
+	}
+	order.PutUint16(data[2:], 42)
+	order.PutUint32(data[4:], uint32(directory))
+
+	path := filepath.Join(dir, "fixture.tif")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadTile(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture fixture
+	}{
+		{name: "strips", fixture: fixture{}},
+		{name: "tiles", fixture: fixture{tiled: true}},
+		{name: "deflate with predictor", fixture: fixture{tiled: true, deflate: true, predictor: true}},
+		{name: "big endian", fixture: fixture{bigEndian: true, deflate: true}},
+		{name: "pixel is point", fixture: fixture{pixelIsPoint: true}},
+		{name: "nodata", fixture: fixture{noData: "-32768"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.fixture.write(t, t.TempDir())
+			tile, err := readTile(path)
+			if err != nil {
+				t.Fatalf("readTile: %v", err)
+			}
+			if tile.width != fixtureWidth || tile.height != fixtureHeight {
+				t.Errorf("size = %dx%d, want %dx%d", tile.width, tile.height, fixtureWidth, fixtureHeight)
+			}
+			if math.Abs(tile.originLng-fixtureLng) > 1e-9 || math.Abs(tile.originLat-fixtureLat) > 1e-9 {
+				t.Errorf("top-left pixel centre = %v, %v; want %v, %v", tile.originLng, tile.originLat, fixtureLng, fixtureLat)
+			}
+			if tile.scaleLng != fixtureScale || tile.scaleLat != fixtureScale {
+				t.Errorf("pixel size = %v by %v, want %v", tile.scaleLng, tile.scaleLat, fixtureScale)
+			}
+			if tt.fixture.noData != "" && tile.noData != fixtureVoid {
+				t.Errorf("nodata = %v, want %v", tile.noData, fixtureVoid)
+			}
+			if tt.fixture.noData == "" && !math.IsNaN(tile.noData) {
+				t.Errorf("nodata = %v without a nodata tag", tile.noData)
+			}
+
+			dem, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			for _, p := range [][2]int{{0, 0}, {39, 0}, {17, 9}, {20, 20}, {0, 29}, {39, 29}} {
+				col, row := p[0], p[1]
+				point := geo.Point{Lat: fixtureLat - float64(row)*fixtureScale, Lng: fixtureLng + float64(col)*fixtureScale}
+				got, err := dem.Elevation(point)
+				if err != nil {
+					t.Fatalf("Elevation at pixel %d, %d: %v", col, row, err)
+				}
+				if want := float64(fixtureHeightAt(col, row)); math.Abs(got-want) > 1e-6 {
+					t.Errorf("Elevation at pixel %d, %d = %v, want %v", col, row, got, want)
+				}
+			}
+
+			void := geo.Point{Lat: fixtureLat - 4*fixtureScale, Lng: fixtureLng + 5*fixtureScale}
+			got, err := dem.Elevation(void)
+			if err != nil {
+				t.Fatalf("Elevation over the void: %v", err)
+			}
+			if tt.fixture.noData != "" && !math.IsNaN(got) {
+				t.Errorf("Elevation over the void = %v, want NaN", got)
+			}
+			if tt.fixture.noData == "" && got != fixtureVoid {
+				t.Errorf("Elevation over the void = %v without a nodata tag, want %v", got, fixtureVoid)
+			}
+
+			if _, err := dem.Elevation(geo.Point{Lat: fixtureLat + 1, Lng: fixtureLng}); err != ErrNoCoverage {
+				t.Errorf("Elevation outside the tile error = %v, want ErrNoCoverage", err)
+			}
+		})
+	}
+}
+
+func TestReadTileRejects(t *testing.T) {
+	dir := t.TempDir()
+	notTIFF := filepath.Join(dir, "not.tif")
+	if err := os.WriteFile(notTIFF, []byte("PK\x03\x04 not a tiff"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		err  string
+	}{
+		{name: "not a TIFF", path: notTIFF, err: "not a TIFF file"},
+		{name: "projected", path: fixture{projected: true}.write(t, dir), err: "projected rasters are not supported"},
+		{name: "missing file", path: filepath.Join(dir, "missing.tif"), err: "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readTile(tt.path); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("readTile error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
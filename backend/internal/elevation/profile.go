@@ -0,0 +1,167 @@
+package elevation
+
+import (
+	"greenroute/internal/geo"
+	"greenroute/internal/models"
+	"math"
+)
+
+const (
+	sampleSpacing   = 30.0  // about one SRTM pixel, in meters
+	smoothingRadius = 45.0  // either side of a sample, in meters
+	gradeWindow     = 100.0 // distance over which the steepest climb is measured, in meters
+
+	// maxProfilePoints limits the points returned with a segment
+	maxProfilePoints = 100
+)
+
+// Profile is the height of the terrain along a path, sampled at regular
+// intervals and smoothed to remove the noise of the elevation model
+type Profile struct {
+	Distances  []float64 // from the start of the path, in meters
+	Elevations []float64 // above sea level, in meters
+}
+
+// Profile samples the terrain along a path. Voids in the model are filled in
+// from the nearest samples on either side; a path leaving the model returns
+// ErrNoCoverage.
+func (d *DEM) Profile(path []geo.Point) (Profile, error) {
+	samples := geo.SamplePath(path, sampleSpacing)
+	if len(samples) == 0 {
+		return Profile{}, ErrNoCoverage
+	}
+
+	raw := make([]float64, len(samples))
+	distances := make([]float64, len(samples))
+	known := 0
+	for i, p := range samples {
+		if i > 0 {
+			distances[i] = distances[i-1] + geo.Haversine(samples[i-1], p)
+		}
+		elevation, err := d.Elevation(p)
+		if err != nil {
+			return Profile{}, err
+		}
+		raw[i] = elevation
+		if !math.IsNaN(elevation) {
+			known++
+		}
+	}
+	if known == 0 {
+		return Profile{}, ErrNoCoverage
+	}
+	fillVoids(raw, distances)
+
+	return Profile{Distances: distances, Elevations: smooth(raw, distances)}, nil
+}
+
+// fillVoids interpolates missing heights between the known ones around them
+func fillVoids(elevations, distances []float64) {
+	last := -1
+	for i, e := range elevations {
+		if math.IsNaN(e) {
+			continue
+		}
+		for j := last + 1; j < i; j++ {
+			if last < 0 {
+				elevations[j] = e
+				continue
+			}
+			fraction := (distances[j] - distances[last]) / (distances[i] - distances[last])
+			elevations[j] = elevations[last] + fraction*(e-elevations[last])
+		}
+		last = i
+	}
+	for j := last + 1; j < len(elevations); j++ {
+		elevations[j] = elevations[last]
+	}
+}
+
+// smooth averages each height with those within smoothingRadius of it
+func smooth(elevations, distances []float64) []float64 {
+	smoothed := make([]float64, len(elevations))
+	from, to := 0, 0
+	var sum float64
+	for i := range elevations {
+		for to < len(elevations) && distances[to] <= distances[i]+smoothingRadius {
+			sum += elevations[to]
+			to++
+		}
+		for distances[from] < distances[i]-smoothingRadius {
+			sum -= elevations[from]
+			from++
+		}
+		smoothed[i] = sum / float64(to-from)
+	}
+	return smoothed
+}
+
+// Length returns the distance covered by the profile in meters
+func (p Profile) Length() float64 {
+	if len(p.Distances) == 0 {
+		return 0
+	}
+	return p.Distances[len(p.Distances)-1]
+}
+
+// Climb returns the total ascent and descent in meters
+func (p Profile) Climb() (ascent, descent float64) {
+	for i := 1; i < len(p.Elevations); i++ {
+		if rise := p.Elevations[i] - p.Elevations[i-1]; rise > 0 {
+			ascent += rise
+		} else {
+			descent -= rise
+		}
+	}
+	return ascent, descent
+}
+
+// MaxGrade returns the steepest average climb over gradeWindow as a fraction,
+// or over the whole path if it is shorter, and 0 if the path never climbs
+func (p Profile) MaxGrade() float64 {
+	window := math.Min(gradeWindow, p.Length())
+	if window <= 0 {
+		return 0
+	}
+
+	var steepest float64
+	j := 0
+	for i := range p.Distances {
+		for j < len(p.Distances) && p.Distances[j]-p.Distances[i] < window-1e-6 {
+			j++
+		}
+		if j == len(p.Distances) {
+			break
+		}
+		grade := (p.Elevations[j] - p.Elevations[i]) / (p.Distances[j] - p.Distances[i])
+		steepest = math.Max(steepest, grade)
+	}
+	return steepest
+}
+
+// Summary returns the climb totals and up to maxProfilePoints heights along the path
+func (p Profile) Summary() *models.ElevationProfile {
+	ascent, descent := p.Climb()
+	summary := &models.ElevationProfile{
+		Ascent:   math.Round(ascent),
+		Descent:  math.Round(descent),
+		MaxGrade: math.Round(p.MaxGrade()*1000) / 1000,
+	}
+
+	last := len(p.Distances) - 1
+	step := max(1, (last+maxProfilePoints-2)/(maxProfilePoints-1))
+	for i := 0; i <= last; i += step {
+		summary.Points = append(summary.Points, p.point(i))
+	}
+	if last%step != 0 {
+		summary.Points = append(summary.Points, p.point(last))
+	}
+	return summary
+}
+
+func (p Profile) point(i int) models.ElevationPoint {
+	return models.ElevationPoint{
+		Distance:  math.Round(p.Distances[i]),
+		Elevation: math.Round(p.Elevations[i]*10) / 10,
+	}
+}
@@ -0,0 +1,40 @@
+package emissions
+
+import (
+	"greenroute/internal/models"
+	"time"
+)
+
+// Emissions in g CO2 per hour of a combustion engine idling or creeping in
+// stop-and-go traffic. An idling mid-size petrol car burns about 0.8 litres an
+// hour and a diesel about 0.7; hybrids switch the engine off much of the time.
+// Electric cars draw little power when stopped and are not counted.
+var idleGramsPerHour = map[models.FuelType]float64{
+	models.Petrol: 1850,
+	models.Diesel: 1880,
+	models.Hybrid: 600,
+	models.PHEV:   600,
+	models.BEV:    0,
+}
+
+// CongestionEmission returns the extra emissions of one car traveller spending
+// delay longer on a drive than it takes without congestion. Cars without a
+// profile are counted as petrol.
+func CongestionEmission(vehicle *models.VehicleProfile, delay time.Duration) float64 {
+	if delay <= 0 {
+		return 0
+	}
+
+	rate := idleGramsPerHour[models.Petrol]
+	if vehicle != nil {
+		if r, ok := idleGramsPerHour[vehicle.FuelType]; ok {
+			rate = r
+		}
+	}
+
+	grams := rate * delay.Hours()
+	if vehicle != nil && vehicle.Occupancy > 1 {
+		grams /= float64(vehicle.Occupancy)
+	}
+	return grams
+}
@@ -0,0 +1,96 @@
+package emissions
+
+import (
+	"greenroute/internal/models"
+	"math"
+)
+
+// Battery consumption in kWh/km at the reference speed by size class
+var baseConsumption = map[string]float64{
+	"small":   0.14,
+	"medium":  0.17,
+	"large":   0.22,
+	"average": 0.17,
+}
+
+// Vehicle mass in kg with occupants by size class, used for climbs
+var vehicleMass = map[string]float64{
+	"small":   1500,
+	"medium":  1900,
+	"large":   2500,
+	"average": 1900,
+}
+
+const (
+	// referenceSpeed is the speed in km/h at which base consumption applies
+	referenceSpeed = 50.0
+
+	// chargingEfficiency is the share of grid energy that ends up in the battery
+	chargingEfficiency = 0.9
+
+	gravity = 9.81 // m/s^2
+
+	// drivetrainEfficiency is the share of battery energy that lifts the car on climbs
+	drivetrainEfficiency = 0.9
+	// regenEfficiency is the share of the height lost on descents that
+	// regenerative braking returns to the battery
+	regenEfficiency = 0.6
+)
+
+// EnergyPerKm returns the battery energy an electric vehicle uses per km at an
+// average speed in km/h. Aerodynamic drag makes consumption grow with the
+// square of speed, while very low speeds are dominated by auxiliary loads.
+func EnergyPerKm(vehicle *models.VehicleProfile, speedKmh float64) float64 {
+	base := baseConsumption["average"]
+	if vehicle != nil {
+		if vehicle.ConsumptionKWhPerKm > 0 {
+			base = vehicle.ConsumptionKWhPerKm
+		} else if c, ok := baseConsumption[vehicle.SizeClass]; ok {
+			base = c
+		}
+	}
+
+	if speedKmh <= 0 {
+		speedKmh = referenceSpeed
+	}
+	return base * speedFactor(speedKmh)
+}
+
+// speedFactor scales consumption relative to the reference speed
+func speedFactor(speedKmh float64) float64 {
+	const drag = 0.00004 // per (km/h)^2
+	return (1 - drag*referenceSpeed*referenceSpeed) + drag*speedKmh*speedKmh
+}
+
+// ClimbEnergy returns the battery energy in kWh to lift a vehicle over a
+// segment's ascent, less what regenerative braking recovers on its descent.
+// It is negative when the segment mostly goes downhill.
+func ClimbEnergy(vehicle *models.VehicleProfile, ascentMeters, descentMeters float64) float64 {
+	mass := vehicleMass["average"]
+	if vehicle != nil {
+		if vehicle.MassKg > 0 {
+			mass = vehicle.MassKg
+		} else if m, ok := vehicleMass[vehicle.SizeClass]; ok {
+			mass = m
+		}
+	}
+
+	joules := mass * gravity * (ascentMeters/drivetrainEfficiency - descentMeters*regenEfficiency)
+	return joules / 3.6e6
+}
+
+// BatteryEnergy returns the battery energy in kWh an electric vehicle uses
+// over a distance, including climbs when the terrain is known. Long descents
+// are not counted as charging the battery.
+func BatteryEnergy(vehicle *models.VehicleProfile, distanceMeters, speedKmh float64, terrain *models.ElevationProfile) float64 {
+	energy := EnergyPerKm(vehicle, speedKmh) * distanceMeters / 1000.0
+	if terrain != nil {
+		energy += ClimbEnergy(vehicle, terrain.Ascent, terrain.Descent)
+	}
+	return math.Max(0, energy)
+}
+
+// GridEnergy returns the electricity drawn from the grid to cover a distance
+func GridEnergy(vehicle *models.VehicleProfile, distanceMeters, speedKmh float64, terrain *models.ElevationProfile) float64 {
+	return BatteryEnergy(vehicle, distanceMeters, speedKmh, terrain) / chargingEfficiency
+}
@@ -0,0 +1,156 @@
+package emissions
+
+import (
+	"encoding/csv"
+	"fmt"
+	"greenroute/internal/models"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// factor is one row of an emission factor table
+type factor struct {
+	mode        models.TransportMode
+	fuelType    models.FuelType       // empty matches any fuel type
+	sizeClass   string                // empty matches any size class
+	minYear     int                   // 0 for no lower bound
+	maxYear     int                   // 0 for no upper bound
+	transit     models.TransitVehicle // empty matches any transit vehicle
+	gramsPerKm  float64
+	specificity int
+}
+
+// FactorSet is a versioned table of emission factors loaded from one data file
+type FactorSet struct {
+	ID      string
+	factors []factor
+}
+
+// csvColumns lists the columns every factor file must provide
+var csvColumns = []string{"mode", "fuel_type", "size_class", "min_year", "max_year", "grams_per_km"}
+
+// transitColumn is the optional column giving the vehicle of a public transit factor
+const transitColumn = "transit_vehicle"
+
+// parseFactorSet reads a factor table in CSV format. Lines starting with '#' are comments.
+func parseFactorSet(id string, r io.Reader) (*FactorSet, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read factor set %s: %v", id, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("factor set %s is empty", id)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range csvColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("factor set %s is missing column %s", id, name)
+		}
+	}
+
+	set := &FactorSet{ID: id}
+	for line, record := range records[1:] {
+		value := func(name string) string {
+			return strings.TrimSpace(record[columns[name]])
+		}
+
+		f := factor{
+			mode:      models.TransportMode(value("mode")),
+			fuelType:  models.FuelType(value("fuel_type")),
+			sizeClass: value("size_class"),
+		}
+		if f.minYear, err = parseOptionalInt(value("min_year")); err != nil {
+			return nil, fmt.Errorf("factor set %s line %d: invalid min_year: %v", id, line+2, err)
+		}
+		if f.maxYear, err = parseOptionalInt(value("max_year")); err != nil {
+			return nil, fmt.Errorf("factor set %s line %d: invalid max_year: %v", id, line+2, err)
+		}
+		if f.gramsPerKm, err = strconv.ParseFloat(value("grams_per_km"), 64); err != nil {
+			return nil, fmt.Errorf("factor set %s line %d: invalid grams_per_km: %v", id, line+2, err)
+		}
+		if _, ok := columns[transitColumn]; ok {
+			f.transit = models.TransitVehicle(value(transitColumn))
+		}
+
+		// More specific rows win over generic ones
+		if f.transit != "" {
+			f.specificity += 8
+		}
+		if f.fuelType != "" {
+			f.specificity += 4
+		}
+		if f.sizeClass != "" {
+			f.specificity += 2
+		}
+		if f.minYear != 0 || f.maxYear != 0 {
+			f.specificity++
+		}
+
+		set.factors = append(set.factors, f)
+	}
+
+	return set, nil
+}
+
+func parseOptionalInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// lookup returns the most specific factor matching the mode and vehicle, or
+// for public transit the transit vehicle
+func (s *FactorSet) lookup(mode models.TransportMode, vehicle *models.VehicleProfile, transit models.TransitVehicle) (float64, bool) {
+	var fuelType models.FuelType
+	sizeClass := "average"
+	modelYear := 0
+	if vehicle != nil {
+		fuelType = vehicle.FuelType
+		if vehicle.SizeClass != "" {
+			sizeClass = vehicle.SizeClass
+		}
+		modelYear = vehicle.ModelYear
+	}
+
+	var best *factor
+	for i := range s.factors {
+		f := &s.factors[i]
+		if f.mode != mode {
+			continue
+		}
+		if f.fuelType != "" && f.fuelType != fuelType {
+			continue
+		}
+		if f.sizeClass != "" && f.sizeClass != sizeClass {
+			continue
+		}
+		if f.transit != "" && f.transit != transit {
+			continue
+		}
+		if f.minYear != 0 || f.maxYear != 0 {
+			if modelYear == 0 ||
+				(f.minYear != 0 && modelYear < f.minYear) ||
+				(f.maxYear != 0 && modelYear > f.maxYear) {
+				continue
+			}
+		}
+		if best == nil || f.specificity > best.specificity {
+			best = f
+		}
+	}
+
+	if best == nil {
+		return 0, false
+	}
+	return best.gramsPerKm, true
+}
@@ -0,0 +1,158 @@
+package emissions
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GridIntensitySource provides the carbon intensity of electricity
+type GridIntensitySource interface {
+	// ID identifies the data source in emission factor references
+	ID() string
+	// Intensity returns grams of CO2 per kWh for a grid region at a time
+	Intensity(ctx context.Context, region string, at time.Time) (float64, error)
+}
+
+// NewGridIntensitySource creates the source configured by GRID_INTENSITY_FILE.
+// It returns nil when no source is configured.
+func NewGridIntensitySource() (GridIntensitySource, error) {
+	path := os.Getenv("GRID_INTENSITY_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	source, err := NewFileIntensitySource(path)
+	if err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// FileIntensitySource serves typical hourly grid intensities per region from a
+// local CSV or JSON file, for offline use
+type FileIntensitySource struct {
+	id     string
+	hourly map[string][24]float64
+	known  map[string][24]bool
+}
+
+// intensityRecord is one region-hour entry of an intensity file
+type intensityRecord struct {
+	Region      string  `json:"region"`
+	Hour        int     `json:"hour"` // hour of day, 0-23, in the time zone of the query
+	GramsPerKWh float64 `json:"grams_per_kwh"`
+}
+
+// NewFileIntensitySource loads a file of region, hour and grams_per_kwh records.
+// Files ending in .json hold an array of objects; anything else is read as CSV
+// with a header row.
+func NewFileIntensitySource(path string) (*FileIntensitySource, error) {
+	var records []intensityRecord
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		records, err = readIntensityJSON(path)
+	} else {
+		records, err = readIntensityCSV(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	source := &FileIntensitySource{
+		id:     setID(path),
+		hourly: make(map[string][24]float64),
+		known:  make(map[string][24]bool),
+	}
+	for _, r := range records {
+		if r.Hour < 0 || r.Hour > 23 {
+			return nil, fmt.Errorf("invalid hour %d for region %s", r.Hour, r.Region)
+		}
+		region := strings.ToUpper(r.Region)
+		hourly, known := source.hourly[region], source.known[region]
+		hourly[r.Hour] = r.GramsPerKWh
+		known[r.Hour] = true
+		source.hourly[region], source.known[region] = hourly, known
+	}
+
+	return source, nil
+}
+
+func readIntensityJSON(path string) ([]intensityRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grid intensity file: %v", err)
+	}
+
+	var records []intensityRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode grid intensity file: %v", err)
+	}
+	return records, nil
+}
+
+func readIntensityCSV(path string) ([]intensityRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grid intensity file: %v", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode grid intensity file: %v", err)
+	}
+
+	var records []intensityRecord
+	for i, row := range rows {
+		if i == 0 {
+			continue // header
+		}
+		if len(row) < 3 {
+			return nil, fmt.Errorf("grid intensity file line %d: expected region,hour,grams_per_kwh", i+1)
+		}
+		hour, err := strconv.Atoi(row[1])
+		if err != nil {
+			return nil, fmt.Errorf("grid intensity file line %d: invalid hour: %v", i+1, err)
+		}
+		grams, err := strconv.ParseFloat(row[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("grid intensity file line %d: invalid grams_per_kwh: %v", i+1, err)
+		}
+		records = append(records, intensityRecord{Region: row[0], Hour: hour, GramsPerKWh: grams})
+	}
+	return records, nil
+}
+
+// ID returns the file name the intensities were loaded from
+func (s *FileIntensitySource) ID() string {
+	return s.id
+}
+
+// Intensity returns the intensity for the hour of at. Hours missing from the
+// file fall back to the nearest earlier hour with data.
+func (s *FileIntensitySource) Intensity(ctx context.Context, region string, at time.Time) (float64, error) {
+	region = strings.ToUpper(region)
+	known, ok := s.known[region]
+	if !ok {
+		return 0, fmt.Errorf("no grid intensity data for region %s", region)
+	}
+
+	hourly := s.hourly[region]
+	for offset := 0; offset < 24; offset++ {
+		hour := (at.Hour() - offset + 24) % 24
+		if known[hour] {
+			return hourly[hour], nil
+		}
+	}
+	return 0, fmt.Errorf("no grid intensity data for region %s", region)
+}
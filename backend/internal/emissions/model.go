@@ -0,0 +1,215 @@
+package emissions
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"greenroute/internal/models"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultFactorSet is the factor set shipped with the binary
+const DefaultFactorSet = "greenroute-2025"
+
+//go:embed data/*.csv
+var builtinData embed.FS
+
+// evEnergyModel versions the electric vehicle energy model in factor references
+const evEnergyModel = "ev-energy-v2"
+
+// Model estimates CO2 emissions for route segments from versioned factor tables,
+// and from energy use and grid carbon intensity for battery electric vehicles
+type Model struct {
+	sets   map[string]*FactorSet
+	active *FactorSet
+	grid   GridIntensitySource
+}
+
+// Estimate is the emission of a distance travelled with one factor set
+type Estimate struct {
+	Grams     float64
+	FactorSet string
+}
+
+// NewModel loads the built-in factor sets plus any CSV files in EMISSION_FACTORS_DIR.
+// Each file is a factor set named after the file, e.g. defra-2025.csv becomes
+// "defra-2025". EMISSION_FACTOR_SET selects the active set. grid may be nil, in
+// which case electric vehicles use the table factors.
+func NewModel(grid GridIntensitySource) (*Model, error) {
+	m := &Model{
+		sets: make(map[string]*FactorSet),
+		grid: grid,
+	}
+
+	entries, err := builtinData.ReadDir("data")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read built-in factor sets: %v", err)
+	}
+	for _, entry := range entries {
+		f, err := builtinData.Open("data/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to open built-in factor set: %v", err)
+		}
+		set, err := parseFactorSet(setID(entry.Name()), f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		m.sets[set.ID] = set
+	}
+
+	if dir := os.Getenv("EMISSION_FACTORS_DIR"); dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list factor sets: %v", err)
+		}
+		for _, path := range paths {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open factor set: %v", err)
+			}
+			set, err := parseFactorSet(setID(path), f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			m.sets[set.ID] = set
+		}
+	}
+
+	active := os.Getenv("EMISSION_FACTOR_SET")
+	if active == "" {
+		active = DefaultFactorSet
+	}
+	set, ok := m.sets[active]
+	if !ok {
+		return nil, fmt.Errorf("emission factor set %s not found", active)
+	}
+	m.active = set
+
+	return m, nil
+}
+
+// setID derives a factor set ID from its file name
+func setID(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// FactorSets returns the IDs of all loaded factor sets
+func (m *Model) FactorSets() []string {
+	ids := make([]string, 0, len(m.sets))
+	for id := range m.sets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Estimate calculates the emissions of one traveller covering a distance with a mode.
+// Car emissions are shared between the vehicle's occupants.
+func (m *Model) Estimate(mode models.TransportMode, vehicle *models.VehicleProfile, distanceMeters float64) Estimate {
+	if mode != models.Car {
+		vehicle = nil
+	}
+
+	gramsPerKm, ok := m.active.lookup(mode, vehicle, "")
+	if !ok {
+		return Estimate{FactorSet: m.active.ID}
+	}
+
+	grams := gramsPerKm * distanceMeters / 1000.0
+	if mode == models.Car && vehicle != nil && vehicle.Occupancy > 1 {
+		grams /= float64(vehicle.Occupancy)
+	}
+
+	return Estimate{
+		Grams:     grams,
+		FactorSet: m.active.ID,
+	}
+}
+
+// EstimateTransit calculates the emissions of one traveller riding a public
+// transit vehicle. Vehicles without a factor of their own use the generic
+// public transit factor.
+func (m *Model) EstimateTransit(vehicle models.TransitVehicle, distanceMeters float64) Estimate {
+	gramsPerKm, ok := m.active.lookup(models.PublicTransit, nil, vehicle)
+	if !ok {
+		return Estimate{FactorSet: m.active.ID}
+	}
+
+	return Estimate{
+		Grams:     gramsPerKm * distanceMeters / 1000.0,
+		FactorSet: m.active.ID,
+	}
+}
+
+// EstimateElectric calculates the emissions of a battery electric drive from its
+// energy use, including climbs if the terrain is known, and the carbon
+// intensity of the grid when the battery is charged
+func (m *Model) EstimateElectric(
+	ctx context.Context,
+	vehicle *models.VehicleProfile,
+	distanceMeters float64,
+	duration time.Duration,
+	terrain *models.ElevationProfile,
+	departure time.Time,
+) (Estimate, error) {
+	if m.grid == nil || vehicle == nil || vehicle.GridRegion == "" {
+		return Estimate{}, errors.New("no grid intensity available")
+	}
+
+	chargeTime := departure
+	if vehicle.ChargeTime != nil {
+		chargeTime = *vehicle.ChargeTime
+	}
+	intensity, err := m.grid.Intensity(ctx, vehicle.GridRegion, chargeTime)
+	if err != nil {
+		return Estimate{}, err
+	}
+
+	var speedKmh float64
+	if duration > 0 {
+		speedKmh = distanceMeters / 1000.0 / duration.Hours()
+	}
+
+	grams := GridEnergy(vehicle, distanceMeters, speedKmh, terrain) * intensity
+	if vehicle.Occupancy > 1 {
+		grams /= float64(vehicle.Occupancy)
+	}
+
+	return Estimate{
+		Grams:     grams,
+		FactorSet: fmt.Sprintf("%s+%s:%s", evEnergyModel, m.grid.ID(), strings.ToUpper(vehicle.GridRegion)),
+	}, nil
+}
+
+// Apply sets the emission fields of a segment. Battery electric drives use the
+// grid intensity model when possible and fall back to the factor table.
+// Transit segments with known rides add up the factor of each ride's vehicle.
+func (m *Model) Apply(ctx context.Context, segment *models.RouteSegment, vehicle *models.VehicleProfile, departure time.Time) {
+	if segment.Mode == models.PublicTransit && len(segment.Rides) > 0 {
+		segment.CO2Emission = 0
+		for i := range segment.Rides {
+			ride := &segment.Rides[i]
+			ride.CO2Emission = m.EstimateTransit(ride.Vehicle, ride.Distance).Grams
+			segment.CO2Emission += ride.CO2Emission
+		}
+		segment.EmissionFactorSet = m.active.ID
+		return
+	}
+
+	estimate := m.Estimate(segment.Mode, vehicle, segment.Distance)
+	if segment.Mode == models.Car && vehicle != nil && vehicle.FuelType == models.BEV {
+		if electric, err := m.EstimateElectric(ctx, vehicle, segment.Distance, segment.Duration, segment.Elevation, departure); err == nil {
+			estimate = electric
+		}
+	}
+
+	segment.CO2Emission = estimate.Grams
+	segment.EmissionFactorSet = estimate.FactorSet
+}
@@ -1,10 +1,36 @@
 package external
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"greenroute/internal/geo"
+	"greenroute/internal/models"
 	"net/http"
+	"net/url"
 	"os"
+	"time"
+)
+
+// StationFinder looks up charging stations, either live or from a local store.
+// FindStationsAlongRoute returns at least every station within corridorKm of
+// the path, and may return some further away.
+type StationFinder interface {
+	FindNearbyStations(ctx context.Context, lat, lng, radiusKm float64, profile *models.ConnectorProfile) ([]ChargingStation, error)
+	FindStationsAlongRoute(ctx context.Context, path []geo.Point, corridorKm float64, profile *models.ConnectorProfile) ([]ChargingStation, error)
+}
+
+const (
+	// lookupTimeout bounds a station lookup made while planning a route
+	lookupTimeout = 10 * time.Second
+	// clientTimeout bounds every request, including bulk refresh downloads
+	clientTimeout = 2 * time.Minute
+
+	// corridorMaxResults caps the stations returned by one corridor search
+	corridorMaxResults = 1000
+	// corridorTolerance is how far, as a share of the corridor width, the
+	// simplified path sent to OpenChargeMap may stray from the route
+	corridorTolerance = 0.5
 )
 
 // ChargingClient handles interactions with EV charging station APIs
@@ -31,6 +57,28 @@ type ChargingStation struct {
 	UsageType struct {
 		Title string `json:"Title"`
 	} `json:"UsageType"`
+	DateCreated          string `json:"DateCreated,omitempty"`
+	DateLastStatusUpdate string `json:"DateLastStatusUpdate,omitempty"`
+}
+
+// ocmTimeLayouts are the timestamp formats found in OpenChargeMap data
+var ocmTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+// LastModified returns when the station record last changed, or the zero time
+// if the record carries no timestamps
+func (s *ChargingStation) LastModified() time.Time {
+	var latest time.Time
+	for _, value := range []string{s.DateCreated, s.DateLastStatusUpdate} {
+		for _, layout := range ocmTimeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				if t.After(latest) {
+					latest = t
+				}
+				break
+			}
+		}
+	}
+	return latest
 }
 
 // NewChargingClient creates a new instance of ChargingClient
@@ -42,18 +90,74 @@ func NewChargingClient() (*ChargingClient, error) {
 
 	return &ChargingClient{
 		apiKey: apiKey,
-		client: &http.Client{},
+		client: &http.Client{Timeout: clientTimeout},
 	}, nil
 }
 
-// FindNearbyStations finds charging stations near a location within a radius
-func (c *ChargingClient) FindNearbyStations(lat, lng float64, radiusKm float64) ([]ChargingStation, error) {
-	url := fmt.Sprintf(
-		"https://api.openchargemap.io/v3/poi?output=json&latitude=%f&longitude=%f&distance=%f&distanceunit=km&maxresults=10",
-		lat, lng, radiusKm,
-	)
+// FindNearbyStations finds charging stations near a location within a radius.
+// A non-nil profile keeps only stations the vehicle can charge at.
+func (c *ChargingClient) FindNearbyStations(ctx context.Context, lat, lng float64, radiusKm float64, profile *models.ConnectorProfile) ([]ChargingStation, error) {
+	maxResults := 10
+	if profile != nil {
+		// Fetch more candidates since some are filtered out locally
+		maxResults = 50
+	}
+
+	query := url.Values{}
+	query.Set("latitude", fmt.Sprintf("%f", lat))
+	query.Set("longitude", fmt.Sprintf("%f", lng))
+	query.Set("distance", fmt.Sprintf("%f", radiusKm))
+	query.Set("maxresults", fmt.Sprintf("%d", maxResults))
+	return c.lookup(ctx, query, profile)
+}
+
+// FindStationsAlongRoute finds charging stations along a route within a
+// corridor, in a single request. The path is simplified to keep the request
+// short and the corridor widened by the same tolerance, so stations near the
+// route are not missed. A non-nil profile keeps only stations the vehicle can
+// charge at.
+func (c *ChargingClient) FindStationsAlongRoute(ctx context.Context, path []geo.Point, corridorKm float64, profile *models.ConnectorProfile) ([]ChargingStation, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	if len(path) == 1 {
+		return c.FindNearbyStations(ctx, path[0].Lat, path[0].Lng, corridorKm, profile)
+	}
+
+	simplified := geo.Simplify(path, corridorKm*corridorTolerance*1000)
+	query := url.Values{}
+	query.Set("polyline", geo.EncodePolyline(simplified))
+	query.Set("distance", fmt.Sprintf("%f", corridorKm*(1+corridorTolerance)))
+	query.Set("maxresults", fmt.Sprintf("%d", corridorMaxResults))
+
+	stations, err := c.lookup(ctx, query, profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stations along route: %v", err)
+	}
+	return stations, nil
+}
+
+// lookup runs a station search and keeps the stations a profile can use
+func (c *ChargingClient) lookup(ctx context.Context, query url.Values, profile *models.ConnectorProfile) ([]ChargingStation, error) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
 
-	req, err := http.NewRequest("GET", url, nil)
+	query.Set("output", "json")
+	query.Set("distanceunit", "km")
+	if profile != nil && profile.MinPowerKW > 0 {
+		query.Set("minpowerkw", fmt.Sprintf("%f", profile.MinPowerKW))
+	}
+
+	stations, err := c.get(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return FilterStations(stations, profile), nil
+}
+
+// get sends a query to the OpenChargeMap POI endpoint
+func (c *ChargingClient) get(ctx context.Context, query url.Values) ([]ChargingStation, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.openchargemap.io/v3/poi?"+query.Encode(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
@@ -78,26 +182,13 @@ func (c *ChargingClient) FindNearbyStations(lat, lng float64, radiusKm float64)
 	return stations, nil
 }
 
-// FindStationsAlongRoute finds charging stations along a route within a corridor
-func (c *ChargingClient) FindStationsAlongRoute(waypoints []struct{ Lat, Lng float64 }, corridorKm float64) ([]ChargingStation, error) {
-	var allStations []ChargingStation
-	seenStations := make(map[int]bool)
-
-	// Search for stations near each waypoint
-	for _, wp := range waypoints {
-		stations, err := c.FindNearbyStations(wp.Lat, wp.Lng, corridorKm)
-		if err != nil {
-			continue
-		}
-
-		// Deduplicate stations
-		for _, station := range stations {
-			if !seenStations[station.ID] {
-				allStations = append(allStations, station)
-				seenStations[station.ID] = true
-			}
-		}
-	}
+// FetchModifiedSince downloads every station added or changed after since, for
+// refreshing a local StationStore
+func (c *ChargingClient) FetchModifiedSince(ctx context.Context, since time.Time) ([]ChargingStation, error) {
+	query := url.Values{}
+	query.Set("output", "json")
+	query.Set("maxresults", "100000")
+	query.Set("modifiedsince", since.UTC().Format("2006-01-02T15:04:05"))
 
-	return allStations, nil
+	return c.get(ctx, query)
 }
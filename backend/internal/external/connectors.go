@@ -0,0 +1,95 @@
+package external
+
+import (
+	"greenroute/internal/models"
+	"strings"
+)
+
+// ConnectorTypeFromTitle maps an OpenChargeMap connection type title to a
+// connector standard. It returns an empty type for unrecognised titles.
+func ConnectorTypeFromTitle(title string) models.ConnectorType {
+	t := strings.ToLower(title)
+	switch {
+	case strings.Contains(t, "nacs"), strings.Contains(t, "tesla"):
+		return models.NACS
+	case strings.Contains(t, "chademo"):
+		return models.CHAdeMO
+	case strings.Contains(t, "ccs") && strings.Contains(t, "type 1"):
+		return models.CCS1
+	case strings.Contains(t, "ccs"):
+		return models.CCS2
+	case strings.Contains(t, "type 2"), strings.Contains(t, "mennekes"):
+		return models.Type2
+	case strings.Contains(t, "type 1"), strings.Contains(t, "j1772"):
+		return models.Type1
+	default:
+		return ""
+	}
+}
+
+// IsPublic reports whether the station's usage type allows public access
+func (s *ChargingStation) IsPublic() bool {
+	return strings.HasPrefix(strings.ToLower(s.UsageType.Title), "public")
+}
+
+// CompatiblePower returns the most powerful connection the profile can use and
+// its power in kW. Connections without a known power never satisfy a minimum power.
+func (s *ChargingStation) CompatiblePower(profile *models.ConnectorProfile) (models.ConnectorType, float64, bool) {
+	var bestType models.ConnectorType
+	bestPower := -1.0
+	for _, conn := range s.Connections {
+		connType := ConnectorTypeFromTitle(conn.ConnectionType.Title)
+		if profile != nil {
+			if len(profile.Connectors) > 0 && !hasConnector(profile.Connectors, connType) {
+				continue
+			}
+			if profile.MinPowerKW > 0 && conn.PowerKW < profile.MinPowerKW {
+				continue
+			}
+		}
+		if conn.PowerKW > bestPower {
+			bestType, bestPower = connType, conn.PowerKW
+		}
+	}
+
+	if bestPower < 0 {
+		return "", 0, false
+	}
+	return bestType, bestPower, true
+}
+
+// Matches reports whether a vehicle with the profile can charge at the station
+func (s *ChargingStation) Matches(profile *models.ConnectorProfile) bool {
+	if profile == nil {
+		return true
+	}
+	if profile.PublicOnly && !s.IsPublic() {
+		return false
+	}
+	_, _, ok := s.CompatiblePower(profile)
+	return ok
+}
+
+// FilterStations returns the stations a vehicle with the profile can charge at
+func FilterStations(stations []ChargingStation, profile *models.ConnectorProfile) []ChargingStation {
+	if profile == nil {
+		return stations
+	}
+
+	filtered := make([]ChargingStation, 0, len(stations))
+	for _, station := range stations {
+		if station.Matches(profile) {
+			filtered = append(filtered, station)
+		}
+	}
+	return filtered
+}
+
+func hasConnector(connectors []models.ConnectorType, connType models.ConnectorType) bool {
+	for _, c := range connectors {
+		if c == connType {
+			return true
+		}
+	}
+	return false
+}
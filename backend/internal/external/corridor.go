@@ -0,0 +1,54 @@
+package external
+
+import (
+	"context"
+	"greenroute/internal/geo"
+	"greenroute/internal/models"
+	"sort"
+)
+
+// CorridorStation is a charging station near a route
+type CorridorStation struct {
+	ChargingStation
+	DistanceAlongRouteKm float64 `json:"distance_along_route_km"`
+	DetourKm             float64 `json:"detour_km"` // from the closest point of the route, one way
+}
+
+// FindStationsInCorridor returns the stations within corridorKm of a path,
+// ordered by distance along it. The finder's results are clipped to the exact
+// corridor. A non-nil profile keeps only stations the vehicle can charge at.
+func FindStationsInCorridor(
+	ctx context.Context,
+	finder StationFinder,
+	path []geo.Point,
+	corridorKm float64,
+	profile *models.ConnectorProfile,
+) ([]CorridorStation, error) {
+	if len(path) == 0 || corridorKm <= 0 {
+		return nil, nil
+	}
+
+	stations, err := finder.FindStationsAlongRoute(ctx, path, corridorKm, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var corridor []CorridorStation
+	for _, station := range stations {
+		p := geo.Point{Lat: station.AddressInfo.Latitude, Lng: station.AddressInfo.Longitude}
+		along, offset := geo.LocateOnPath(p, path)
+		if offset/1000.0 > corridorKm {
+			continue
+		}
+		corridor = append(corridor, CorridorStation{
+			ChargingStation:      station,
+			DistanceAlongRouteKm: along / 1000.0,
+			DetourKm:             offset / 1000.0,
+		})
+	}
+
+	sort.Slice(corridor, func(i, j int) bool {
+		return corridor[i].DistanceAlongRouteKm < corridor[j].DistanceAlongRouteKm
+	})
+	return corridor, nil
+}
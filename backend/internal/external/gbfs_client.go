@@ -0,0 +1,538 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"greenroute/internal/geo"
+	"greenroute/internal/models"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SharedVehicleFinder locates shared bikes and scooters that can be rented
+// and the docks they can be returned to
+type SharedVehicleFinder interface {
+	FindPickups(ctx context.Context, near models.Location, radiusMeters float64, mode models.TransportMode) ([]SharedSpot, error)
+	FindDropoffs(ctx context.Context, system string, near models.Location, radiusMeters float64, mode models.TransportMode) ([]SharedSpot, error)
+}
+
+// SharedSpot is a station or a dockless vehicle of a sharing system. For
+// pickups Available counts the vehicles of the mode; for dropoffs it counts
+// the free docks.
+type SharedSpot struct {
+	System      string
+	Name        string // station name, or vehicle ID when dockless
+	Location    models.Location
+	Available   int
+	RangeMeters float64 // of a dockless vehicle, 0 if not reported
+	Docked      bool    // the vehicle must be returned to a station
+	Distance    float64 // from the searched location, in meters
+}
+
+// GBFSClient keeps the stations and vehicles of GBFS sharing systems in
+// memory, refreshed from their feeds
+type GBFSClient struct {
+	client  *http.Client
+	urls    []string // gbfs.json discovery URLs
+	mu      sync.RWMutex
+	systems map[string]*gbfsSystem
+}
+
+// gbfsSystem is the latest state of one sharing system
+type gbfsSystem struct {
+	name     string
+	stations []gbfsStation
+	vehicles []gbfsVehicle
+	docked   map[models.TransportMode]bool // modes returned to stations
+}
+
+// gbfsStation is a docking station and what it has available
+type gbfsStation struct {
+	id        string
+	name      string
+	point     geo.Point
+	vehicles  map[models.TransportMode]int
+	docks     int
+	renting   bool
+	returning bool
+}
+
+// gbfsVehicle is a dockless vehicle that can be rented
+type gbfsVehicle struct {
+	id          string
+	mode        models.TransportMode
+	point       geo.Point
+	rangeMeters float64
+}
+
+// NewGBFSClient creates a client for the sharing systems whose gbfs.json
+// discovery URLs are listed in GBFS_FEEDS, separated by commas. It returns nil
+// when no feeds are configured.
+func NewGBFSClient() *GBFSClient {
+	var urls []string
+	for _, u := range strings.Split(os.Getenv("GBFS_FEEDS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	return &GBFSClient{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		urls:    urls,
+		systems: make(map[string]*gbfsSystem),
+	}
+}
+
+// Refresh reads every configured system. A system that fails to load keeps
+// its previous state; the error reports the failures.
+func (c *GBFSClient) Refresh(ctx context.Context) error {
+	var failures []string
+	for _, u := range c.urls {
+		system, err := c.loadSystem(ctx, u)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", redactURL(u), err))
+			continue
+		}
+		c.mu.Lock()
+		c.systems[u] = system
+		c.mu.Unlock()
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to read GBFS feeds: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// StartRefresh refreshes the systems now and then every interval until ctx
+// is cancelled
+func (c *GBFSClient) StartRefresh(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := c.Refresh(ctx); err != nil {
+				log.Printf("GBFS refresh failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// FindPickups returns the stations with a vehicle of the mode to rent and
+// the free dockless vehicles within the radius, closest first
+func (c *GBFSClient) FindPickups(ctx context.Context, near models.Location, radiusMeters float64, mode models.TransportMode) ([]SharedSpot, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	center := geo.Point{Lat: near.Latitude, Lng: near.Longitude}
+	var spots []SharedSpot
+	add := func(spot SharedSpot, p geo.Point, address string) {
+		if d := geo.Haversine(center, p); d <= radiusMeters {
+			spot.Location = models.Location{Latitude: p.Lat, Longitude: p.Lng, Address: address}
+			spot.Distance = d
+			spots = append(spots, spot)
+		}
+	}
+	for _, system := range c.systems {
+		for _, station := range system.stations {
+			if station.renting && station.vehicles[mode] > 0 {
+				add(SharedSpot{
+					System:    system.name,
+					Name:      station.name,
+					Available: station.vehicles[mode],
+					Docked:    system.docked[mode],
+				}, station.point, station.name)
+			}
+		}
+		for _, vehicle := range system.vehicles {
+			if vehicle.mode == mode {
+				add(SharedSpot{
+					System:      system.name,
+					Name:        vehicle.id,
+					Available:   1,
+					RangeMeters: vehicle.rangeMeters,
+					Docked:      system.docked[mode],
+				}, vehicle.point, "")
+			}
+		}
+	}
+
+	sortSpots(spots)
+	return spots, nil
+}
+
+// FindDropoffs returns the stations of a system with a free dock for the mode
+// within the radius, closest first
+func (c *GBFSClient) FindDropoffs(ctx context.Context, systemName string, near models.Location, radiusMeters float64, mode models.TransportMode) ([]SharedSpot, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	center := geo.Point{Lat: near.Latitude, Lng: near.Longitude}
+	var spots []SharedSpot
+	for _, system := range c.systems {
+		if system.name != systemName || !system.docked[mode] {
+			continue
+		}
+		for _, station := range system.stations {
+			if !station.returning || station.docks <= 0 {
+				continue
+			}
+			if d := geo.Haversine(center, station.point); d <= radiusMeters {
+				spots = append(spots, SharedSpot{
+					System:    system.name,
+					Name:      station.name,
+					Location:  models.Location{Latitude: station.point.Lat, Longitude: station.point.Lng, Address: station.name},
+					Available: station.docks,
+					Docked:    true,
+					Distance:  d,
+				})
+			}
+		}
+	}
+
+	sortSpots(spots)
+	return spots, nil
+}
+
+// sortSpots orders spots closest first
+func sortSpots(spots []SharedSpot) {
+	sort.Slice(spots, func(i, j int) bool {
+		return spots[i].Distance < spots[j].Distance
+	})
+}
+
+// gbfsFeed is a feed listed by gbfs.json
+type gbfsFeed struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// gbfsBool reads the booleans of GBFS 2.0 and later and the 0 or 1 of 1.x
+type gbfsBool bool
+
+func (b *gbfsBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", "1":
+		*b = true
+	case "false", "0", "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid GBFS boolean %s", data)
+	}
+	return nil
+}
+
+// gbfsText reads a plain string, as before GBFS 3.0, or the English or first
+// of a list of localized strings
+type gbfsText string
+
+func (t *gbfsText) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var localized []struct {
+			Text     string `json:"text"`
+			Language string `json:"language"`
+		}
+		if err := json.Unmarshal(data, &localized); err != nil {
+			return err
+		}
+		*t = ""
+		for i, l := range localized {
+			if i == 0 || strings.HasPrefix(l.Language, "en") {
+				*t = gbfsText(l.Text)
+			}
+			if strings.HasPrefix(l.Language, "en") {
+				break
+			}
+		}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*t = gbfsText(s)
+	return nil
+}
+
+// loadSystem reads the discovery file of a system and the feeds it lists
+func (c *GBFSClient) loadSystem(ctx context.Context, discoveryURL string) (*gbfsSystem, error) {
+	var discovery struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := c.fetch(ctx, discoveryURL, &discovery); err != nil {
+		return nil, err
+	}
+
+	// GBFS 3.0 lists feeds directly, earlier versions per language
+	var feeds []gbfsFeed
+	var flat struct {
+		Feeds []gbfsFeed `json:"feeds"`
+	}
+	if err := json.Unmarshal(discovery.Data, &flat); err == nil && len(flat.Feeds) > 0 {
+		feeds = flat.Feeds
+	} else {
+		var languages map[string]struct {
+			Feeds []gbfsFeed `json:"feeds"`
+		}
+		if err := json.Unmarshal(discovery.Data, &languages); err != nil {
+			return nil, fmt.Errorf("failed to decode feed list: %v", err)
+		}
+		keys := make([]string, 0, len(languages))
+		for lang := range languages {
+			keys = append(keys, lang)
+		}
+		sort.Strings(keys)
+		for _, lang := range keys {
+			if feeds == nil || strings.HasPrefix(lang, "en") {
+				feeds = languages[lang].Feeds
+			}
+		}
+	}
+	feedURLs := make(map[string]string)
+	for _, f := range feeds {
+		feedURLs[f.Name] = f.URL
+	}
+
+	system := &gbfsSystem{name: discoveryURL, docked: make(map[models.TransportMode]bool)}
+	if u := feedURLs["system_information"]; u != "" {
+		var info struct {
+			Data struct {
+				Name gbfsText `json:"name"`
+			} `json:"data"`
+		}
+		if err := c.fetch(ctx, u, &info); err != nil {
+			return nil, err
+		}
+		if info.Data.Name != "" {
+			system.name = string(info.Data.Name)
+		}
+	}
+
+	// Without vehicle types every vehicle is a bicycle, as in GBFS 1.x
+	types := make(map[string]models.TransportMode)
+	if u := feedURLs["vehicle_types"]; u != "" {
+		var vt struct {
+			Data struct {
+				VehicleTypes []struct {
+					ID         string `json:"vehicle_type_id"`
+					FormFactor string `json:"form_factor"`
+				} `json:"vehicle_types"`
+			} `json:"data"`
+		}
+		if err := c.fetch(ctx, u, &vt); err != nil {
+			return nil, err
+		}
+		for _, t := range vt.Data.VehicleTypes {
+			if mode := formFactorMode(t.FormFactor); mode != "" {
+				types[t.ID] = mode
+			}
+		}
+	}
+	modeOf := func(vehicleType string) models.TransportMode {
+		if len(types) == 0 {
+			return models.BikeShare
+		}
+		return types[vehicleType]
+	}
+
+	if err := c.loadStations(ctx, feedURLs, system, modeOf); err != nil {
+		return nil, err
+	}
+	if err := c.loadVehicles(ctx, feedURLs, system, modeOf); err != nil {
+		return nil, err
+	}
+	return system, nil
+}
+
+// loadStations joins station_information and station_status
+func (c *GBFSClient) loadStations(ctx context.Context, feedURLs map[string]string, system *gbfsSystem, modeOf func(string) models.TransportMode) error {
+	infoURL, statusURL := feedURLs["station_information"], feedURLs["station_status"]
+	if infoURL == "" || statusURL == "" {
+		return nil // a dockless system
+	}
+
+	var info struct {
+		Data struct {
+			Stations []struct {
+				ID   string   `json:"station_id"`
+				Name gbfsText `json:"name"`
+				Lat  float64  `json:"lat"`
+				Lon  float64  `json:"lon"`
+			} `json:"stations"`
+		} `json:"data"`
+	}
+	if err := c.fetch(ctx, infoURL, &info); err != nil {
+		return err
+	}
+	var status struct {
+		Data struct {
+			Stations []struct {
+				ID                string    `json:"station_id"`
+				BikesAvailable    *int      `json:"num_bikes_available"`
+				VehiclesAvailable *int      `json:"num_vehicles_available"`
+				DocksAvailable    int       `json:"num_docks_available"`
+				IsInstalled       *gbfsBool `json:"is_installed"`
+				IsRenting         *gbfsBool `json:"is_renting"`
+				IsReturning       *gbfsBool `json:"is_returning"`
+				Types             []struct {
+					ID    string `json:"vehicle_type_id"`
+					Count int    `json:"count"`
+				} `json:"vehicle_types_available"`
+			} `json:"stations"`
+		} `json:"data"`
+	}
+	if err := c.fetch(ctx, statusURL, &status); err != nil {
+		return err
+	}
+
+	stations := make(map[string]*gbfsStation, len(info.Data.Stations))
+	for _, s := range info.Data.Stations {
+		stations[s.ID] = &gbfsStation{
+			id:    s.ID,
+			name:  string(s.Name),
+			point: geo.Point{Lat: s.Lat, Lng: s.Lon},
+		}
+	}
+	isTrue := func(b *gbfsBool) bool { return b == nil || bool(*b) } // absent means true
+	for _, s := range status.Data.Stations {
+		station, ok := stations[s.ID]
+		if !ok {
+			continue
+		}
+		station.vehicles = make(map[models.TransportMode]int)
+		if len(s.Types) > 0 {
+			for _, t := range s.Types {
+				if mode := modeOf(t.ID); mode != "" {
+					station.vehicles[mode] += t.Count
+					system.docked[mode] = true
+				}
+			}
+		} else if mode := modeOf(""); mode != "" {
+			switch {
+			case s.VehiclesAvailable != nil:
+				station.vehicles[mode] = *s.VehiclesAvailable
+			case s.BikesAvailable != nil:
+				station.vehicles[mode] = *s.BikesAvailable
+			}
+			system.docked[mode] = true
+		}
+		station.docks = s.DocksAvailable
+		installed := isTrue(s.IsInstalled)
+		station.renting = installed && isTrue(s.IsRenting)
+		station.returning = installed && isTrue(s.IsReturning)
+		system.stations = append(system.stations, *station)
+	}
+	return nil
+}
+
+// loadVehicles reads the dockless vehicles of free_bike_status, or
+// vehicle_status from GBFS 3.0
+func (c *GBFSClient) loadVehicles(ctx context.Context, feedURLs map[string]string, system *gbfsSystem, modeOf func(string) models.TransportMode) error {
+	u := feedURLs["vehicle_status"]
+	if u == "" {
+		u = feedURLs["free_bike_status"]
+	}
+	if u == "" {
+		return nil
+	}
+
+	type vehicle struct {
+		BikeID      string   `json:"bike_id"`
+		VehicleID   string   `json:"vehicle_id"`
+		Lat         *float64 `json:"lat"`
+		Lon         *float64 `json:"lon"`
+		StationID   string   `json:"station_id"`
+		IsReserved  gbfsBool `json:"is_reserved"`
+		IsDisabled  gbfsBool `json:"is_disabled"`
+		VehicleType string   `json:"vehicle_type_id"`
+		Range       float64  `json:"current_range_meters"`
+	}
+	var feed struct {
+		Data struct {
+			Bikes    []vehicle `json:"bikes"`
+			Vehicles []vehicle `json:"vehicles"`
+		} `json:"data"`
+	}
+	if err := c.fetch(ctx, u, &feed); err != nil {
+		return err
+	}
+
+	for _, v := range append(feed.Data.Bikes, feed.Data.Vehicles...) {
+		// Docked vehicles are counted by their station
+		if v.IsReserved || v.IsDisabled || v.StationID != "" || v.Lat == nil || v.Lon == nil {
+			continue
+		}
+		mode := modeOf(v.VehicleType)
+		if mode == "" {
+			continue
+		}
+		id := v.VehicleID
+		if id == "" {
+			id = v.BikeID
+		}
+		system.vehicles = append(system.vehicles, gbfsVehicle{
+			id:          id,
+			mode:        mode,
+			point:       geo.Point{Lat: *v.Lat, Lng: *v.Lon},
+			rangeMeters: v.Range,
+		})
+	}
+	return nil
+}
+
+// formFactorMode maps a GBFS vehicle form factor to a shared mode, or to
+// nothing for vehicles the planner does not rent
+func formFactorMode(formFactor string) models.TransportMode {
+	switch formFactor {
+	case "bicycle", "cargo_bicycle":
+		return models.BikeShare
+	case "scooter", "scooter_standing", "scooter_seated":
+		return models.EScooter
+	default:
+		return ""
+	}
+}
+
+// fetch decodes one GBFS JSON file
+func (c *GBFSClient) fetch(ctx context.Context, feedURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err // without the URL and its key
+		}
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("feed returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode feed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"greenroute/internal/geo"
+	"greenroute/internal/gtfs"
+	"greenroute/internal/models"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// realtimeMaxAge is how long a realtime feed that fails to refresh keeps
+// its last snapshot
+const realtimeMaxAge = 10 * time.Minute
+
+// GTFSRouter plans public transit trips over static GTFS timetables,
+// adjusted by GTFS-Realtime trip updates and service alerts when configured
+type GTFSRouter struct {
+	timetable *gtfs.Timetable
+
+	realtimeSources []string // URLs or files of GTFS-Realtime feeds
+	client          *http.Client
+	mu              sync.Mutex
+	latest          map[string]realtimeMessage // last good message of each source
+}
+
+// realtimeMessage is a GTFS-Realtime message and when it was read
+type realtimeMessage struct {
+	message *gtfsrt.FeedMessage
+	read    time.Time
+}
+
+// NewGTFSRouter loads the GTFS zip files listed in GTFS_FEEDS, separated by
+// commas; a directory in the list stands for every zip file in it. It returns
+// nil when no feeds are configured. GTFS_RT_FEEDS lists the URLs or files of
+// GTFS-Realtime trip update and alert feeds, also separated by commas.
+func NewGTFSRouter() (*GTFSRouter, error) {
+	value := os.Getenv("GTFS_FEEDS")
+	if value == "" {
+		return nil, nil
+	}
+
+	var paths []string
+	for _, p := range strings.Split(value, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GTFS feed: %v", err)
+		}
+		if !info.IsDir() {
+			paths = append(paths, p)
+			continue
+		}
+		zips, err := filepath.Glob(filepath.Join(p, "*.zip"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list GTFS feeds: %v", err)
+		}
+		paths = append(paths, zips...)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no GTFS feeds found in %s", value)
+	}
+
+	start := time.Now()
+	timetable, err := gtfs.Load(paths...)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d GTFS feeds with %d stops and %d trips in %s",
+		len(paths), timetable.StopCount(), timetable.TripCount(), time.Since(start).Round(time.Millisecond))
+
+	router := &GTFSRouter{
+		timetable: timetable,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		latest:    make(map[string]realtimeMessage),
+	}
+	for _, source := range strings.Split(os.Getenv("GTFS_RT_FEEDS"), ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			router.realtimeSources = append(router.realtimeSources, source)
+		}
+	}
+	return router, nil
+}
+
+// HasRealtime reports whether GTFS-Realtime feeds are configured
+func (g *GTFSRouter) HasRealtime() bool {
+	return len(g.realtimeSources) > 0
+}
+
+// RefreshRealtime reads every GTFS-Realtime feed and applies their trip
+// updates and alerts to the timetable. A feed that cannot be read keeps its
+// previous message for a while; the error reports the failures.
+func (g *GTFSRouter) RefreshRealtime(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var failures []string
+	for _, source := range g.realtimeSources {
+		message, err := g.readRealtime(ctx, source)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", redactURL(source), err))
+			continue
+		}
+		g.latest[source] = realtimeMessage{message: message, read: time.Now()}
+	}
+
+	var messages []*gtfsrt.FeedMessage
+	for _, source := range g.realtimeSources {
+		if latest, ok := g.latest[source]; ok && time.Since(latest.read) <= realtimeMaxAge {
+			messages = append(messages, latest.message)
+		}
+	}
+	rt := g.timetable.ReadRealtime(messages...)
+	g.timetable.SetRealtime(rt)
+	log.Printf("GTFS-Realtime refreshed: %d trip updates and %d alerts from %d feeds",
+		rt.TripUpdateCount(), rt.AlertCount(), len(messages))
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to read GTFS-Realtime feeds: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// StartRealtime refreshes the realtime feeds now and then every interval
+// until ctx is cancelled
+func (g *GTFSRouter) StartRealtime(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := g.RefreshRealtime(ctx); err != nil {
+				log.Printf("GTFS-Realtime refresh failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// readRealtime fetches and decodes one GTFS-Realtime feed from a URL or file
+func (g *GTFSRouter) readRealtime(ctx context.Context, source string) (*gtfsrt.FeedMessage, error) {
+	var data []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+		resp, err := g.client.Do(req)
+		if err != nil {
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err // without the URL and its key
+			}
+			return nil, fmt.Errorf("failed to send request: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("feed returned status %d", resp.StatusCode)
+		}
+		if data, err = io.ReadAll(resp.Body); err != nil {
+			return nil, fmt.Errorf("failed to read response: %v", err)
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, err
+		}
+	}
+
+	message := &gtfsrt.FeedMessage{}
+	if err := proto.Unmarshal(data, message); err != nil {
+		return nil, fmt.Errorf("failed to decode feed: %v", err)
+	}
+	return message, nil
+}
+
+// redactURL drops the query of a feed URL, which often carries an API key
+func redactURL(source string) string {
+	if i := strings.IndexByte(source, '?'); i >= 0 {
+		return source[:i]
+	}
+	return source
+}
+
+// GetRoute plans a transit trip leaving at the departure time, or now, or
+// arriving by the arrival time if one is set. The segment departs when the
+// traveller has to leave the origin and lists every vehicle boarded, with
+// predicted delays and alerts when realtime feeds are configured.
+func (g *GTFSRouter) GetRoute(
+	ctx context.Context,
+	origin models.Location,
+	destination models.Location,
+	mode models.TransportMode,
+	opts RouteOptions,
+) (*models.RouteSegment, error) {
+	if mode != models.PublicTransit {
+		return nil, fmt.Errorf("transport mode %s is not supported by the GTFS router", mode)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	from := geo.Point{Lat: origin.Latitude, Lng: origin.Longitude}
+	to := geo.Point{Lat: destination.Latitude, Lng: destination.Longitude}
+
+	var journey *gtfs.Journey
+	var err error
+	if !opts.ArrivalTime.IsZero() {
+		journey, err = g.timetable.LatestDeparture(from, to, opts.ArrivalTime)
+	} else {
+		departure := opts.DepartureTime
+		if departure.IsZero() {
+			departure = time.Now()
+		}
+		journey, err = g.timetable.EarliestArrival(from, to, departure)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan transit trip: %v", err)
+	}
+
+	departure := journey.Departure
+	seg := &models.RouteSegment{
+		StartLocation: origin,
+		EndLocation:   destination,
+		Mode:          models.PublicTransit,
+		Duration:      journey.Arrival.Sub(journey.Departure),
+		Departure:     &departure,
+	}
+	var points []geo.Point
+	for _, leg := range journey.Legs {
+		seg.Distance += leg.Distance
+		for _, p := range leg.Points {
+			if len(points) == 0 || points[len(points)-1] != p {
+				points = append(points, p)
+			}
+		}
+		if leg.Route == nil {
+			continue
+		}
+		seg.Rides = append(seg.Rides, models.TransitRide{
+			Line:      leg.Route.Name,
+			Vehicle:   leg.Route.Vehicle,
+			FromStop:  leg.From,
+			ToStop:    leg.To,
+			Departure: leg.Departure,
+			Arrival:   leg.Arrival,
+			Distance:  leg.Distance,
+			Delay:     leg.Delay,
+			Realtime:  leg.Realtime,
+			Alerts:    leg.Alerts,
+		})
+	}
+	seg.Polyline = geo.EncodePolyline(points)
+
+	return seg, nil
+}
+
+// GetRoutes returns the single best trip; the GTFS router does not compute alternatives
+func (g *GTFSRouter) GetRoutes(
+	ctx context.Context,
+	origin models.Location,
+	destination models.Location,
+	mode models.TransportMode,
+	opts RouteOptions,
+) ([]models.RouteSegment, error) {
+	segment, err := g.GetRoute(ctx, origin, destination, mode, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []models.RouteSegment{*segment}, nil
+}
+
+// FindTransitHubs returns the rail, metro, tram, ferry and cable stations of
+// the timetable within the radius, closest first
+func (g *GTFSRouter) FindTransitHubs(ctx context.Context, near models.Location, radiusMeters float64) ([]TransitHub, error) {
+	stations := g.timetable.Stations(geo.Point{Lat: near.Latitude, Lng: near.Longitude}, radiusMeters)
+	hubs := make([]TransitHub, 0, len(stations))
+	for _, station := range stations {
+		hubs = append(hubs, TransitHub{
+			Name: station.Name,
+			Location: models.Location{
+				Latitude:  station.Point.Lat,
+				Longitude: station.Point.Lng,
+				Address:   station.Name,
+			},
+		})
+	}
+	return hubs, nil
+}
+
+// transitRouting answers public transit requests from GTFS timetables and
+// every other mode from a road routing provider
+type transitRouting struct {
+	roads   RoutingProvider
+	transit *GTFSRouter
+}
+
+// WithTransit routes public transit over GTFS timetables and leaves the other
+// modes to provider
+func WithTransit(provider RoutingProvider, transit *GTFSRouter) RoutingProvider {
+	return &transitRouting{roads: provider, transit: transit}
+}
+
+// GetRoute calculates a route with the GTFS router for transit and the road provider otherwise
+func (t *transitRouting) GetRoute(
+	ctx context.Context,
+	origin models.Location,
+	destination models.Location,
+	mode models.TransportMode,
+	opts RouteOptions,
+) (*models.RouteSegment, error) {
+	if mode == models.PublicTransit {
+		return t.transit.GetRoute(ctx, origin, destination, mode, opts)
+	}
+	return t.roads.GetRoute(ctx, origin, destination, mode, opts)
+}
+
+// GetRoutes returns alternatives from the GTFS router for transit and the road provider otherwise
+func (t *transitRouting) GetRoutes(
+	ctx context.Context,
+	origin models.Location,
+	destination models.Location,
+	mode models.TransportMode,
+	opts RouteOptions,
+) ([]models.RouteSegment, error) {
+	if mode == models.PublicTransit {
+		return t.transit.GetRoutes(ctx, origin, destination, mode, opts)
+	}
+	return t.roads.GetRoutes(ctx, origin, destination, mode, opts)
+}
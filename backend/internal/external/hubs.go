@@ -0,0 +1,122 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"greenroute/internal/geo"
+	"greenroute/internal/models"
+	"os"
+	"sort"
+
+	"googlemaps.github.io/maps"
+)
+
+// TransitHub is a station where travellers can transfer to public transit
+type TransitHub struct {
+	Name     string          `json:"name"`
+	Location models.Location `json:"location"`
+}
+
+// HubFinder locates transit hubs near a location
+type HubFinder interface {
+	FindTransitHubs(ctx context.Context, near models.Location, radiusMeters float64) ([]TransitHub, error)
+}
+
+// NewHubFinder creates a hub finder backed by the static TRANSIT_HUBS_FILE if set,
+// otherwise by the stations of the GTFS timetables, otherwise by the Google
+// Places API. It returns nil when none is available.
+func NewHubFinder(transit *GTFSRouter) (HubFinder, error) {
+	if path := os.Getenv("TRANSIT_HUBS_FILE"); path != "" {
+		finder, err := NewStaticHubFinder(path)
+		if err != nil {
+			return nil, err
+		}
+		return finder, nil
+	}
+
+	if transit != nil {
+		return transit, nil
+	}
+
+	if os.Getenv("GOOGLE_MAPS_API_KEY") != "" {
+		client, err := NewMapsClient()
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+
+	return nil, nil
+}
+
+// FindTransitHubs finds transit stations near a location using Google Places
+func (m *MapsClient) FindTransitHubs(ctx context.Context, near models.Location, radiusMeters float64) ([]TransitHub, error) {
+	resp, err := m.client.NearbySearch(ctx, &maps.NearbySearchRequest{
+		Location: &maps.LatLng{Lat: near.Latitude, Lng: near.Longitude},
+		Radius:   uint(radiusMeters),
+		Type:     maps.PlaceTypeTransitStation,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search transit stations: %v", err)
+	}
+
+	hubs := make([]TransitHub, 0, len(resp.Results))
+	for _, result := range resp.Results {
+		hubs = append(hubs, TransitHub{
+			Name: result.Name,
+			Location: models.Location{
+				Latitude:  result.Geometry.Location.Lat,
+				Longitude: result.Geometry.Location.Lng,
+				Address:   result.Vicinity,
+			},
+		})
+	}
+
+	return sortByDistance(hubs, near, radiusMeters), nil
+}
+
+// StaticHubFinder serves transit hubs from a JSON file
+type StaticHubFinder struct {
+	hubs []TransitHub
+}
+
+// NewStaticHubFinder loads transit hubs from a JSON array of TransitHub objects
+func NewStaticHubFinder(path string) (*StaticHubFinder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transit hubs file: %v", err)
+	}
+
+	var hubs []TransitHub
+	if err := json.Unmarshal(data, &hubs); err != nil {
+		return nil, fmt.Errorf("failed to decode transit hubs file: %v", err)
+	}
+
+	return &StaticHubFinder{hubs: hubs}, nil
+}
+
+// FindTransitHubs returns the configured hubs within the radius, closest first
+func (f *StaticHubFinder) FindTransitHubs(ctx context.Context, near models.Location, radiusMeters float64) ([]TransitHub, error) {
+	return sortByDistance(f.hubs, near, radiusMeters), nil
+}
+
+// sortByDistance returns the hubs within the radius ordered by distance from near
+func sortByDistance(hubs []TransitHub, near models.Location, radiusMeters float64) []TransitHub {
+	origin := geo.Point{Lat: near.Latitude, Lng: near.Longitude}
+	distance := func(hub TransitHub) float64 {
+		return geo.Haversine(origin, geo.Point{Lat: hub.Location.Latitude, Lng: hub.Location.Longitude})
+	}
+
+	var result []TransitHub
+	for _, hub := range hubs {
+		if distance(hub) <= radiusMeters {
+			result = append(result, hub)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return distance(result[i]) < distance(result[j])
+	})
+	return result
+}
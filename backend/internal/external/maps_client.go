@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"greenroute/internal/models"
 	"os"
+	"strconv"
 	"time"
 
 	"googlemaps.github.io/maps"
@@ -39,7 +40,23 @@ func (m *MapsClient) GetRoute(
 	origin models.Location,
 	destination models.Location,
 	mode models.TransportMode,
+	opts RouteOptions,
 ) (*models.RouteSegment, error) {
+	segments, err := m.GetRoutes(ctx, origin, destination, mode, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &segments[0], nil
+}
+
+// GetRoutes returns every alternative route Google suggests between two points
+func (m *MapsClient) GetRoutes(
+	ctx context.Context,
+	origin models.Location,
+	destination models.Location,
+	mode models.TransportMode,
+	opts RouteOptions,
+) ([]models.RouteSegment, error) {
 	// Convert our transport mode to Google Maps mode
 	tMode := convertTransportMode(mode)
 
@@ -50,32 +67,55 @@ func (m *MapsClient) GetRoute(
 		DepartureTime: "now",
 		Alternatives:  true,
 	}
+	if opts.DepartureTime.After(time.Now()) {
+		// Google only predicts traffic for future departures
+		r.DepartureTime = strconv.FormatInt(opts.DepartureTime.Unix(), 10)
+	}
+	if mode == models.PublicTransit && opts.ArrivalTime.After(time.Now()) {
+		r.DepartureTime = ""
+		r.ArrivalTime = strconv.FormatInt(opts.ArrivalTime.Unix(), 10)
+	}
+	if opts.AvoidHighways {
+		r.Avoid = []maps.Avoid{maps.AvoidHighways}
+	}
 
 	routes, _, err := m.client.Directions(ctx, r)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get directions: %v", err)
 	}
 
-	if len(routes) == 0 {
-		return nil, errors.New("no routes found")
+	var segments []models.RouteSegment
+	for _, route := range routes {
+		if len(route.Legs) == 0 {
+			continue
+		}
+
+		// Calculate total distance and duration
+		leg := route.Legs[0]
+		duration := leg.Duration
+		if leg.DurationInTraffic > 0 {
+			duration = leg.DurationInTraffic // driving with a departure time
+		}
+		seg := models.RouteSegment{
+			StartLocation: origin,
+			EndLocation:   destination,
+			Mode:          mode,
+			Duration:      duration,
+			Distance:      float64(leg.Distance.Meters),
+			Polyline:      route.OverviewPolyline.Points,
+		}
+		if mode == models.PublicTransit && !leg.DepartureTime.IsZero() {
+			departure := leg.DepartureTime
+			seg.Departure = &departure
+		}
+		segments = append(segments, seg)
 	}
 
-	// Use the first route
-	route := routes[0]
-	if len(route.Legs) == 0 {
-		return nil, errors.New("route has no legs")
+	if len(segments) == 0 {
+		return nil, errors.New("no routes found")
 	}
 
-	// Calculate total distance and duration
-	leg := route.Legs[0]
-	return &models.RouteSegment{
-		StartLocation: origin,
-		EndLocation:  destination,
-		Mode:         mode,
-		Duration:     time.Duration(leg.Duration) * time.Second,
-		Distance:     float64(leg.Distance.Meters),
-		CO2Emission:  calculateEmissions(mode, float64(leg.Distance.Meters)),
-	}, nil
+	return segments, nil
 }
 
 // formatLocation converts our Location model to Google Maps format
@@ -98,17 +138,3 @@ func convertTransportMode(mode models.TransportMode) maps.Mode {
 		return maps.TravelModeDriving
 	}
 }
-
-// calculateEmissions estimates CO2 emissions based on transport mode and distance
-func calculateEmissions(mode models.TransportMode, distanceMeters float64) float64 {
-	// Emissions in grams of CO2 per kilometer
-	emissionsPerKm := map[models.TransportMode]float64{
-		models.Car:         120.0, // Average car
-		models.Bicycle:     0.0,   // Zero emissions
-		models.Walking:     0.0,   // Zero emissions
-		models.PublicTransit: 60.0, // Average bus/train
-	}
-
-	kmTraveled := distanceMeters / 1000.0
-	return kmTraveled * emissionsPerKm[mode]
-}
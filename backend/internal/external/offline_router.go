@@ -0,0 +1,120 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"greenroute/internal/geo"
+	"greenroute/internal/models"
+	"greenroute/internal/osmrouter"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// OfflineRouter answers route queries from an in-memory OpenStreetMap road graph
+type OfflineRouter struct {
+	graph  *osmrouter.Graph
+	metric osmrouter.Metric
+}
+
+// NewOfflineRouter loads the OSM extract referenced by OSM_PBF_PATH.
+// OFFLINE_ROUTING_METRIC selects "fastest" (default) or "shortest" paths.
+func NewOfflineRouter() (*OfflineRouter, error) {
+	path := os.Getenv("OSM_PBF_PATH")
+	if path == "" {
+		return nil, errors.New("OSM extract path not found in environment variables")
+	}
+
+	var metric osmrouter.Metric
+	switch strings.ToLower(os.Getenv("OFFLINE_ROUTING_METRIC")) {
+	case "", "fastest":
+		metric = osmrouter.Fastest
+	case "shortest":
+		metric = osmrouter.Shortest
+	default:
+		return nil, fmt.Errorf("unknown offline routing metric: %s", os.Getenv("OFFLINE_ROUTING_METRIC"))
+	}
+
+	start := time.Now()
+	graph, err := osmrouter.LoadPBF(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load road graph: %v", err)
+	}
+	log.Printf("Loaded road graph with %d nodes from %s in %s", graph.NodeCount(), path, time.Since(start).Round(time.Millisecond))
+
+	return &OfflineRouter{
+		graph:  graph,
+		metric: metric,
+	}, nil
+}
+
+// GetRoute calculates a route between two points using specified transport mode
+func (o *OfflineRouter) GetRoute(
+	ctx context.Context,
+	origin models.Location,
+	destination models.Location,
+	mode models.TransportMode,
+	opts RouteOptions,
+) (*models.RouteSegment, error) {
+	profile, ok := osmProfile(mode)
+	if !ok {
+		return nil, fmt.Errorf("transport mode %s is not supported by the offline router", mode)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	path, err := o.graph.Route(
+		geo.Point{Lat: origin.Latitude, Lng: origin.Longitude},
+		geo.Point{Lat: destination.Latitude, Lng: destination.Longitude},
+		profile,
+		osmrouter.Options{
+			Metric:        o.metric,
+			AvoidHighways: opts.AvoidHighways,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate offline route: %v", err)
+	}
+
+	return &models.RouteSegment{
+		StartLocation: origin,
+		EndLocation:   destination,
+		Mode:          mode,
+		Duration:      path.Duration,
+		Distance:      path.Distance,
+		Polyline:      geo.EncodePolyline(path.Points),
+	}, nil
+}
+
+// GetRoutes returns the single optimal path; the offline router does not compute alternatives
+func (o *OfflineRouter) GetRoutes(
+	ctx context.Context,
+	origin models.Location,
+	destination models.Location,
+	mode models.TransportMode,
+	opts RouteOptions,
+) ([]models.RouteSegment, error) {
+	segment, err := o.GetRoute(ctx, origin, destination, mode, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []models.RouteSegment{*segment}, nil
+}
+
+// osmProfile converts our transport mode to an offline routing profile
+func osmProfile(mode models.TransportMode) (osmrouter.Profile, bool) {
+	switch mode {
+	case models.Car:
+		return osmrouter.ProfileCar, true
+	case models.Bicycle:
+		return osmrouter.ProfileBicycle, true
+	case models.Walking:
+		return osmrouter.ProfileFoot, true
+	default:
+		return 0, false
+	}
+}
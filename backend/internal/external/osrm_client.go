@@ -0,0 +1,160 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"greenroute/internal/models"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// OSRMClient handles interactions with a self-hosted OSRM routing server
+type OSRMClient struct {
+	baseURLs map[models.TransportMode]string
+	client   *http.Client
+}
+
+// osrmResponse represents the response of the OSRM route service
+type osrmResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Routes  []struct {
+		Distance float64 `json:"distance"` // in meters
+		Duration float64 `json:"duration"` // in seconds
+		Geometry string  `json:"geometry"` // encoded polyline
+	} `json:"routes"`
+}
+
+// NewOSRMClient creates a new instance of OSRMClient.
+// OSRM_URL sets the default server; OSRM_CAR_URL, OSRM_BICYCLE_URL and
+// OSRM_WALKING_URL override it for deployments running one server per profile.
+func NewOSRMClient() (*OSRMClient, error) {
+	defaultURL := os.Getenv("OSRM_URL")
+	if defaultURL == "" {
+		defaultURL = "http://localhost:5000"
+	}
+
+	baseURLs := map[models.TransportMode]string{
+		models.Car:     defaultURL,
+		models.Bicycle: defaultURL,
+		models.Walking: defaultURL,
+	}
+	overrides := map[models.TransportMode]string{
+		models.Car:     "OSRM_CAR_URL",
+		models.Bicycle: "OSRM_BICYCLE_URL",
+		models.Walking: "OSRM_WALKING_URL",
+	}
+	for mode, key := range overrides {
+		if value := os.Getenv(key); value != "" {
+			baseURLs[mode] = value
+		}
+	}
+
+	for mode, baseURL := range baseURLs {
+		if _, err := url.Parse(baseURL); err != nil {
+			return nil, fmt.Errorf("invalid OSRM URL for %s: %v", mode, err)
+		}
+		baseURLs[mode] = strings.TrimRight(baseURL, "/")
+	}
+
+	return &OSRMClient{
+		baseURLs: baseURLs,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// GetRoute calculates a route between two points using specified transport mode
+func (o *OSRMClient) GetRoute(
+	ctx context.Context,
+	origin models.Location,
+	destination models.Location,
+	mode models.TransportMode,
+	opts RouteOptions,
+) (*models.RouteSegment, error) {
+	segments, err := o.GetRoutes(ctx, origin, destination, mode, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &segments[0], nil
+}
+
+// GetRoutes returns the main route and any alternatives OSRM finds
+func (o *OSRMClient) GetRoutes(
+	ctx context.Context,
+	origin models.Location,
+	destination models.Location,
+	mode models.TransportMode,
+	opts RouteOptions,
+) ([]models.RouteSegment, error) {
+	baseURL, ok := o.baseURLs[mode]
+	if !ok {
+		return nil, fmt.Errorf("transport mode %s is not supported by OSRM", mode)
+	}
+
+	// OSRM expects coordinates as longitude,latitude
+	reqURL := fmt.Sprintf(
+		"%s/route/v1/%s/%f,%f;%f,%f?overview=full&geometries=polyline&alternatives=true",
+		baseURL, osrmProfile(mode),
+		origin.Longitude, origin.Latitude,
+		destination.Longitude, destination.Latitude,
+	)
+	if opts.AvoidHighways {
+		// Requires a profile that declares motorway as excludable
+		reqURL += "&exclude=motorway"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result osrmResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	if result.Code != "Ok" {
+		return nil, fmt.Errorf("OSRM request failed: %s %s", result.Code, result.Message)
+	}
+
+	if len(result.Routes) == 0 {
+		return nil, errors.New("no routes found")
+	}
+
+	segments := make([]models.RouteSegment, 0, len(result.Routes))
+	for _, route := range result.Routes {
+		segments = append(segments, models.RouteSegment{
+			StartLocation: origin,
+			EndLocation:   destination,
+			Mode:          mode,
+			Duration:      time.Duration(route.Duration * float64(time.Second)),
+			Distance:      route.Distance,
+			Polyline:      route.Geometry,
+		})
+	}
+
+	return segments, nil
+}
+
+// osrmProfile converts our transport mode to an OSRM profile name
+func osrmProfile(mode models.TransportMode) string {
+	switch mode {
+	case models.Bicycle:
+		return "cycling"
+	case models.Walking:
+		return "foot"
+	default:
+		return "driving"
+	}
+}
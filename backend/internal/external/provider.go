@@ -0,0 +1,67 @@
+package external
+
+import (
+	"context"
+	"fmt"
+	"greenroute/internal/models"
+	"os"
+	"strings"
+	"time"
+)
+
+// RoutingProvider calculates routes between two locations for a transport mode.
+// Segments are returned without emissions; those are estimated by the caller.
+type RoutingProvider interface {
+	// GetRoute returns the provider's preferred route
+	GetRoute(
+		ctx context.Context,
+		origin models.Location,
+		destination models.Location,
+		mode models.TransportMode,
+		opts RouteOptions,
+	) (*models.RouteSegment, error)
+
+	// GetRoutes returns all alternative routes, preferred route first
+	GetRoutes(
+		ctx context.Context,
+		origin models.Location,
+		destination models.Location,
+		mode models.TransportMode,
+		opts RouteOptions,
+	) ([]models.RouteSegment, error)
+}
+
+// RouteOptions holds optional constraints passed to a routing provider
+type RouteOptions struct {
+	AvoidHighways bool
+	DepartureTime time.Time // zero for now; only providers with live traffic use it
+	ArrivalTime   time.Time // latest arrival, zero for none; only timetabled transit uses it
+}
+
+// NewRoutingProvider creates the routing provider selected by the
+// ROUTING_PROVIDER environment variable ("google", "osrm" or "offline")
+func NewRoutingProvider() (RoutingProvider, error) {
+	provider := strings.ToLower(os.Getenv("ROUTING_PROVIDER"))
+	switch provider {
+	case "", "google":
+		client, err := NewMapsClient()
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case "osrm":
+		client, err := NewOSRMClient()
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case "offline":
+		router, err := NewOfflineRouter()
+		if err != nil {
+			return nil, err
+		}
+		return router, nil
+	default:
+		return nil, fmt.Errorf("unknown routing provider: %s", provider)
+	}
+}
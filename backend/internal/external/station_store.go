@@ -0,0 +1,392 @@
+package external
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"greenroute/internal/geo"
+	"greenroute/internal/models"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// storeCellDegrees is the size of a spatial index cell, about 11 km of latitude
+const storeCellDegrees = 0.1
+
+// StationStore keeps charging stations in memory behind a grid index so corridor
+// queries are answered locally and work offline. It is persisted as a JSON
+// snapshot and refreshed incrementally from OpenChargeMap.
+type StationStore struct {
+	mu           sync.RWMutex
+	path         string
+	stations     map[int]ChargingStation
+	cells        map[storeCell][]int
+	lastModified time.Time
+}
+
+// storeCell identifies one cell of the spatial index
+type storeCell struct {
+	lat, lng int
+}
+
+// stationSnapshot is the on-disk format of a StationStore
+type stationSnapshot struct {
+	LastModified time.Time         `json:"last_modified"`
+	Stations     []ChargingStation `json:"stations"`
+}
+
+// NewStationStore creates the store configured by STATION_STORE_PATH, where the
+// snapshot is kept, and STATION_DUMP_FILE, an OpenChargeMap JSON export used to
+// seed an empty store. It returns nil when neither is set.
+func NewStationStore() (*StationStore, error) {
+	path := os.Getenv("STATION_STORE_PATH")
+	dump := os.Getenv("STATION_DUMP_FILE")
+	if path == "" && dump == "" {
+		return nil, nil
+	}
+
+	store := newStationStore(path)
+	if path != "" {
+		if err := store.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	if dump != "" && store.Len() == 0 {
+		if _, err := store.ImportDump(dump); err != nil {
+			return nil, err
+		}
+		if err := store.Save(); err != nil {
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+func newStationStore(path string) *StationStore {
+	return &StationStore{
+		path:     path,
+		stations: make(map[int]ChargingStation),
+		cells:    make(map[storeCell][]int),
+	}
+}
+
+// load reads the snapshot, if there is one
+func (s *StationStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read station store: %v", err)
+	}
+
+	var snapshot stationSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to decode station store: %v", err)
+	}
+
+	s.Upsert(snapshot.Stations)
+	s.mu.Lock()
+	if snapshot.LastModified.After(s.lastModified) {
+		s.lastModified = snapshot.LastModified
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Save writes the snapshot. It does nothing for a store without a path.
+func (s *StationStore) Save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.RLock()
+	snapshot := stationSnapshot{
+		LastModified: s.lastModified,
+		Stations:     make([]ChargingStation, 0, len(s.stations)),
+	}
+	for _, station := range s.stations {
+		snapshot.Stations = append(snapshot.Stations, station)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(snapshot.Stations, func(i, j int) bool {
+		return snapshot.Stations[i].ID < snapshot.Stations[j].ID
+	})
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode station store: %v", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a partial snapshot
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write station store: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write station store: %v", err)
+	}
+	return nil
+}
+
+// ImportDump bulk-loads an OpenChargeMap JSON export. path may be a file holding
+// an array of stations or a single station, or a directory of such files as in
+// the ocm-export repository. It returns the number of stations read.
+func (s *StationStore) ImportDump(path string) (int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open station dump: %v", err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		err := filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(p), ".json") {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to list station dump: %v", err)
+		}
+	}
+
+	total := 0
+	for _, file := range files {
+		stations, err := readStationFile(file)
+		if err != nil {
+			return total, err
+		}
+		s.Upsert(stations)
+		total += len(stations)
+	}
+	return total, nil
+}
+
+// readStationFile decodes a JSON file holding either an array of stations or one station
+func readStationFile(path string) ([]ChargingStation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open station dump: %v", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	first, err := firstNonSpace(reader)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read station dump %s: %v", path, err)
+	}
+
+	decoder := json.NewDecoder(reader)
+	if first != '[' {
+		var station ChargingStation
+		if err := decoder.Decode(&station); err != nil {
+			return nil, fmt.Errorf("failed to decode station dump %s: %v", path, err)
+		}
+		return []ChargingStation{station}, nil
+	}
+
+	// Stream the array so large exports are not held in memory twice
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("failed to decode station dump %s: %v", path, err)
+	}
+	var stations []ChargingStation
+	for decoder.More() {
+		var station ChargingStation
+		if err := decoder.Decode(&station); err != nil {
+			return nil, fmt.Errorf("failed to decode station dump %s: %v", path, err)
+		}
+		stations = append(stations, station)
+	}
+	return stations, nil
+}
+
+// firstNonSpace returns the first non-whitespace byte without consuming it
+func firstNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\n' && b != '\r' {
+			return b, r.UnreadByte()
+		}
+	}
+}
+
+// Upsert adds stations or replaces stored ones that are not newer
+func (s *StationStore) Upsert(stations []ChargingStation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, station := range stations {
+		if station.ID == 0 {
+			continue
+		}
+		modified := station.LastModified()
+		if existing, ok := s.stations[station.ID]; ok {
+			if existing.LastModified().After(modified) {
+				continue
+			}
+			s.removeFromCell(existing)
+		}
+
+		s.stations[station.ID] = station
+		cell := cellOf(station.AddressInfo.Latitude, station.AddressInfo.Longitude)
+		s.cells[cell] = append(s.cells[cell], station.ID)
+		if modified.After(s.lastModified) {
+			s.lastModified = modified
+		}
+	}
+}
+
+func (s *StationStore) removeFromCell(station ChargingStation) {
+	cell := cellOf(station.AddressInfo.Latitude, station.AddressInfo.Longitude)
+	ids := s.cells[cell]
+	for i, id := range ids {
+		if id == station.ID {
+			s.cells[cell] = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+}
+
+func cellOf(lat, lng float64) storeCell {
+	return storeCell{
+		lat: int(math.Floor(lat / storeCellDegrees)),
+		lng: int(math.Floor(lng / storeCellDegrees)),
+	}
+}
+
+// Len returns the number of stored stations
+func (s *StationStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.stations)
+}
+
+// LastModified returns the newest station timestamp in the store
+func (s *StationStore) LastModified() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastModified
+}
+
+// Refresh fetches stations changed since the newest one in the store and saves
+// the snapshot. It returns the number of stations received.
+func (s *StationStore) Refresh(ctx context.Context, client *ChargingClient) (int, error) {
+	stations, err := client.FetchModifiedSince(ctx, s.LastModified())
+	if err != nil {
+		return 0, fmt.Errorf("failed to refresh station store: %v", err)
+	}
+
+	s.Upsert(stations)
+	if err := s.Save(); err != nil {
+		return len(stations), err
+	}
+	return len(stations), nil
+}
+
+// StartRefresh refreshes the store every interval until ctx is cancelled
+func (s *StationStore) StartRefresh(ctx context.Context, client *ChargingClient, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := s.Refresh(ctx, client)
+				if err != nil {
+					log.Printf("Station store refresh failed: %v", err)
+					continue
+				}
+				log.Printf("Station store refreshed: %d updated stations, %d total", n, s.Len())
+			}
+		}
+	}()
+}
+
+// FindNearbyStations returns stored stations within radiusKm, nearest first.
+// A non-nil profile keeps only stations the vehicle can charge at.
+func (s *StationStore) FindNearbyStations(ctx context.Context, lat, lng, radiusKm float64, profile *models.ConnectorProfile) ([]ChargingStation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	center := geo.Point{Lat: lat, Lng: lng}
+	latSpan := radiusKm / 111.0
+	lngSpan := radiusKm / (111.0 * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+	low := cellOf(lat-latSpan, lng-lngSpan)
+	high := cellOf(lat+latSpan, lng+lngSpan)
+
+	type match struct {
+		station  ChargingStation
+		distance float64
+	}
+	var matches []match
+	for cy := low.lat; cy <= high.lat; cy++ {
+		for cx := low.lng; cx <= high.lng; cx++ {
+			for _, id := range s.cells[storeCell{lat: cy, lng: cx}] {
+				station := s.stations[id]
+				p := geo.Point{Lat: station.AddressInfo.Latitude, Lng: station.AddressInfo.Longitude}
+				distance := geo.Haversine(center, p) / 1000.0
+				if distance <= radiusKm {
+					matches = append(matches, match{station: station, distance: distance})
+				}
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+
+	stations := make([]ChargingStation, len(matches))
+	for i, m := range matches {
+		stations[i] = m.station
+	}
+	return FilterStations(stations, profile), nil
+}
+
+// FindStationsAlongRoute returns stored stations within corridorKm of a path.
+// The buffer around the path is covered by circles of corridorKm*√2 spaced
+// 2*corridorKm apart, so some stations just outside it are returned too.
+func (s *StationStore) FindStationsAlongRoute(ctx context.Context, path []geo.Point, corridorKm float64, profile *models.ConnectorProfile) ([]ChargingStation, error) {
+	var allStations []ChargingStation
+	seenStations := make(map[int]bool)
+
+	for _, wp := range geo.SamplePath(path, 2*corridorKm*1000) {
+		stations, err := s.FindNearbyStations(ctx, wp.Lat, wp.Lng, corridorKm*math.Sqrt2, profile)
+		if err != nil {
+			return nil, err
+		}
+		for _, station := range stations {
+			if !seenStations[station.ID] {
+				allStations = append(allStations, station)
+				seenStations[station.ID] = true
+			}
+		}
+	}
+
+	return allStations, nil
+}
@@ -0,0 +1,55 @@
+package geo
+
+import "math"
+
+// EarthRadiusMeters is the mean radius of the Earth
+const EarthRadiusMeters = 6371008.8
+
+// Point represents a geographical coordinate in degrees
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+// Haversine returns the great-circle distance between two points in meters
+func Haversine(a, b Point) float64 {
+	lat1 := toRadians(a.Lat)
+	lat2 := toRadians(b.Lat)
+	dLat := lat2 - lat1
+	dLng := toRadians(b.Lng - a.Lng)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadiusMeters * math.Asin(math.Sqrt(h))
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Interpolate returns the point at a fraction of the way from a to b
+func Interpolate(a, b Point, fraction float64) Point {
+	return Point{
+		Lat: a.Lat + (b.Lat-a.Lat)*fraction,
+		Lng: a.Lng + (b.Lng-a.Lng)*fraction,
+	}
+}
+
+// ProjectOnSegment finds the point on segment a-b closest to p. It returns how
+// far along the segment that point lies, as a fraction clamped to [0, 1], and
+// its distance from p in meters. A local equirectangular projection is used,
+// which is accurate for segments up to a few hundred kilometers.
+func ProjectOnSegment(p, a, b Point) (fraction, distance float64) {
+	scale := math.Cos(toRadians((a.Lat + b.Lat) / 2))
+	ax, ay := a.Lng*scale, a.Lat
+	bx, by := b.Lng*scale, b.Lat
+	px, py := p.Lng*scale, p.Lat
+
+	dx, dy := bx-ax, by-ay
+	if lengthSq := dx*dx + dy*dy; lengthSq > 0 {
+		fraction = ((px-ax)*dx + (py-ay)*dy) / lengthSq
+	}
+	fraction = math.Max(0, math.Min(1, fraction))
+
+	return fraction, Haversine(p, Interpolate(a, b, fraction))
+}
@@ -0,0 +1,54 @@
+package geo
+
+// geohashAlphabet is the base-32 alphabet of geohashes
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// MaxGeohashPrecision is the longest geohash Geohash produces, a cell of a few
+// centimetres
+const MaxGeohashPrecision = 12
+
+// Geohash returns the geohash of the cell of the given length that contains p.
+// Each character divides the cell 32 ways: length 5 cells are about 4.9 km by
+// 4.9 km, length 6 cells 1.2 km by 0.6 km and length 7 cells 153 m by 153 m.
+func Geohash(p Point, precision int) string {
+	if precision < 1 {
+		precision = 1
+	}
+	if precision > MaxGeohashPrecision {
+		precision = MaxGeohashPrecision
+	}
+
+	minLat, maxLat := -90.0, 90.0
+	minLng, maxLng := -180.0, 180.0
+	hash := make([]byte, 0, precision)
+	even := true // bits alternate between longitude and latitude, longitude first
+	var ch, bit int
+	for len(hash) < precision {
+		if even {
+			mid := (minLng + maxLng) / 2
+			if p.Lng >= mid {
+				ch |= 1 << (4 - bit)
+				minLng = mid
+			} else {
+				maxLng = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if p.Lat >= mid {
+				ch |= 1 << (4 - bit)
+				minLat = mid
+			} else {
+				maxLat = mid
+			}
+		}
+		even = !even
+
+		if bit < 4 {
+			bit++
+		} else {
+			hash = append(hash, geohashAlphabet[ch])
+			ch, bit = 0, 0
+		}
+	}
+	return string(hash)
+}
@@ -0,0 +1,183 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// polylinePrecision is the coordinate scale of the encoded polyline format
+// used by Google Maps and OSRM, five decimal places
+const polylinePrecision = 1e5
+
+// EncodePolyline encodes points in the encoded polyline algorithm format
+func EncodePolyline(points []Point) string {
+	var b strings.Builder
+	var lastLat, lastLng int64
+	for _, p := range points {
+		lat := int64(math.Round(p.Lat * polylinePrecision))
+		lng := int64(math.Round(p.Lng * polylinePrecision))
+		encodeValue(&b, lat-lastLat)
+		encodeValue(&b, lng-lastLng)
+		lastLat, lastLng = lat, lng
+	}
+	return b.String()
+}
+
+func encodeValue(b *strings.Builder, v int64) {
+	u := uint64(v) << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		b.WriteByte(byte(0x20|(u&0x1f)) + 63)
+		u >>= 5
+	}
+	b.WriteByte(byte(u) + 63)
+}
+
+// DecodePolyline decodes a string in the encoded polyline algorithm format
+func DecodePolyline(encoded string) ([]Point, error) {
+	var points []Point
+	var lat, lng int64
+	for i := 0; i < len(encoded); {
+		dLat, next, err := decodeValue(encoded, i)
+		if err != nil {
+			return nil, err
+		}
+		dLng, next, err := decodeValue(encoded, next)
+		if err != nil {
+			return nil, err
+		}
+		i = next
+
+		lat += dLat
+		lng += dLng
+		points = append(points, Point{
+			Lat: float64(lat) / polylinePrecision,
+			Lng: float64(lng) / polylinePrecision,
+		})
+	}
+	return points, nil
+}
+
+func decodeValue(encoded string, i int) (int64, int, error) {
+	var result uint64
+	var shift uint
+	for {
+		if i >= len(encoded) {
+			return 0, i, errors.New("truncated polyline")
+		}
+		c := uint64(encoded[i]) - 63
+		i++
+		if c > 0x3f || shift > 60 {
+			return 0, i, errors.New("invalid polyline")
+		}
+		result |= (c & 0x1f) << shift
+		shift += 5
+		if c < 0x20 {
+			break
+		}
+	}
+
+	if result&1 != 0 {
+		return ^int64(result >> 1), i, nil
+	}
+	return int64(result >> 1), i, nil
+}
+
+// PathLength returns the length of a path in meters
+func PathLength(path []Point) float64 {
+	var total float64
+	for i := 1; i < len(path); i++ {
+		total += Haversine(path[i-1], path[i])
+	}
+	return total
+}
+
+// LocateOnPath finds the point of a path closest to p. It returns the distance
+// along the path to that point and its distance from p, both in meters.
+func LocateOnPath(p Point, path []Point) (along, offset float64) {
+	if len(path) == 0 {
+		return 0, math.Inf(1)
+	}
+	if len(path) == 1 {
+		return 0, Haversine(p, path[0])
+	}
+
+	offset = math.Inf(1)
+	var travelled float64
+	for i := 1; i < len(path); i++ {
+		length := Haversine(path[i-1], path[i])
+		fraction, distance := ProjectOnSegment(p, path[i-1], path[i])
+		if distance < offset {
+			offset = distance
+			along = travelled + fraction*length
+		}
+		travelled += length
+	}
+	return along, offset
+}
+
+// SamplePath returns points along a path no more than spacing meters apart,
+// always including both ends
+func SamplePath(path []Point, spacing float64) []Point {
+	if len(path) == 0 || spacing <= 0 {
+		return path
+	}
+
+	samples := []Point{path[0]}
+	var sinceLast float64
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		length := Haversine(a, b)
+		position := 0.0
+		for sinceLast+length-position >= spacing {
+			position += spacing - sinceLast
+			samples = append(samples, Interpolate(a, b, position/length))
+			sinceLast = 0
+		}
+		sinceLast += length - position
+	}
+
+	if last := path[len(path)-1]; samples[len(samples)-1] != last {
+		samples = append(samples, last)
+	}
+	return samples
+}
+
+// Simplify drops points of a path that lie within tolerance meters of the
+// simplified line, using the Douglas-Peucker algorithm. Every point of the
+// original path stays within tolerance of the result.
+func Simplify(path []Point, tolerance float64) []Point {
+	if len(path) < 3 {
+		return path
+	}
+
+	keep := make([]bool, len(path))
+	keep[0], keep[len(path)-1] = true, true
+	stack := [][2]int{{0, len(path) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		farthest, distance := -1, tolerance
+		for i := span[0] + 1; i < span[1]; i++ {
+			if _, d := ProjectOnSegment(path[i], path[span[0]], path[span[1]]); d > distance {
+				farthest, distance = i, d
+			}
+		}
+		if farthest >= 0 {
+			keep[farthest] = true
+			stack = append(stack, [2]int{span[0], farthest}, [2]int{farthest, span[1]})
+		}
+	}
+
+	var simplified []Point
+	for i, p := range path {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
@@ -0,0 +1,475 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"greenroute/internal/geo"
+	"greenroute/internal/models"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTransferWalk is how far apart two stops may be for a walking transfer
+const maxTransferWalk = 300.0 // in meters
+
+// stopTime is one row of stop_times.txt; missing times are -1
+type stopTime struct {
+	sequence  int
+	stop      int32
+	arrival   int32
+	departure int32
+}
+
+// Load reads GTFS feeds from zip files into one timetable. Each feed needs
+// agency.txt, stops.txt, routes.txt, trips.txt and stop_times.txt, plus
+// calendar.txt, calendar_dates.txt or both. Stops of different feeds within
+// walking distance of each other are joined by footpaths.
+func Load(paths ...string) (*Timetable, error) {
+	t := &Timetable{
+		stopIDs:  make(map[string]int32),
+		routeIDs: make(map[string]int32),
+		tripIDs:  make(map[string]int32),
+	}
+	for _, p := range paths {
+		if err := t.loadFeed(p); err != nil {
+			return nil, fmt.Errorf("failed to load GTFS feed %s: %v", p, err)
+		}
+	}
+	if len(t.trips) == 0 {
+		return nil, errors.New("no scheduled trips found in GTFS feeds")
+	}
+
+	points := make([]geo.Point, len(t.stops))
+	for i, stop := range t.stops {
+		points[i] = stop.Point
+	}
+	t.index = newStopIndex(points)
+	served := make([]bool, len(t.stops))
+	for _, tr := range t.trips {
+		vehicle := t.routes[tr.route].Vehicle
+		for _, stop := range tr.stops {
+			served[stop] = true
+			if vehicle != "" && vehicle != models.Bus && vehicle != models.Coach {
+				t.stops[stop].hub = true
+			}
+		}
+	}
+	for stop := range t.stops {
+		if served[stop] {
+			t.index.insert(int32(stop))
+		}
+	}
+
+	t.footpaths = make([][]footpath, len(t.stops))
+	for stop := range t.stops {
+		if !served[stop] {
+			continue
+		}
+		for _, near := range t.index.within(t.stops[stop].Point, maxTransferWalk) {
+			if near.stop != int32(stop) {
+				t.footpaths[stop] = append(t.footpaths[stop], footpath{stop: near.stop, distance: near.distance})
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// loadFeed adds the stops, routes and trips of one zip file to the timetable
+func (t *Timetable) loadFeed(zipPath string) error {
+	archive, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	// Some feeds are zipped with an enclosing directory
+	files := make(map[string]*zip.File)
+	for _, f := range archive.File {
+		files[path.Base(f.Name)] = f
+	}
+
+	f := &feed{}
+
+	agency := "" // the first agency, for routes that do not name one
+	err = readTable(files, "agency.txt", true, func(row func(string) string) error {
+		if f.location != nil {
+			return nil // all agencies of a feed share a time zone
+		}
+		agency = row("agency_id")
+		location, err := time.LoadLocation(row("agency_timezone"))
+		if err != nil {
+			return fmt.Errorf("invalid agency_timezone: %v", err)
+		}
+		f.location = location
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if f.location == nil {
+		return errors.New("agency.txt has no agencies")
+	}
+
+	stopIndex := make(map[string]int32)
+	parents := make(map[int32]string)
+	err = readTable(files, "stops.txt", true, func(row func(string) string) error {
+		switch row("location_type") {
+		case "", "0", "1":
+		default:
+			return nil // entrances, generic nodes and boarding areas
+		}
+		lat, err := strconv.ParseFloat(row("stop_lat"), 64)
+		if err != nil {
+			return fmt.Errorf("invalid stop_lat for stop %s: %v", row("stop_id"), err)
+		}
+		lng, err := strconv.ParseFloat(row("stop_lon"), 64)
+		if err != nil {
+			return fmt.Errorf("invalid stop_lon for stop %s: %v", row("stop_id"), err)
+		}
+		idx := int32(len(t.stops))
+		stopIndex[row("stop_id")] = idx
+		if _, ok := t.stopIDs[row("stop_id")]; !ok {
+			t.stopIDs[row("stop_id")] = idx
+		}
+		if parent := row("parent_station"); parent != "" {
+			parents[idx] = parent
+		}
+		t.stops = append(t.stops, Stop{
+			ID:      row("stop_id"),
+			Name:    row("stop_name"),
+			Point:   geo.Point{Lat: lat, Lng: lng},
+			station: -1,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for stop, parent := range parents {
+		if station, ok := stopIndex[parent]; ok {
+			t.stops[stop].station = station
+		}
+	}
+
+	routeIndex := make(map[string]int32)
+	err = readTable(files, "routes.txt", true, func(row func(string) string) error {
+		routeType, err := strconv.Atoi(row("route_type"))
+		if err != nil {
+			return fmt.Errorf("invalid route_type for route %s: %v", row("route_id"), err)
+		}
+		name := row("route_short_name")
+		if name == "" {
+			name = row("route_long_name")
+		}
+		routeAgency := row("agency_id")
+		if routeAgency == "" {
+			routeAgency = agency
+		}
+		idx := int32(len(t.routes))
+		routeIndex[row("route_id")] = idx
+		if _, ok := t.routeIDs[row("route_id")]; !ok {
+			t.routeIDs[row("route_id")] = idx
+		}
+		t.routes = append(t.routes, Route{
+			Name:      name,
+			Vehicle:   vehicleOf(routeType),
+			agency:    routeAgency,
+			routeType: routeType,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	serviceIndex := make(map[string]int32)
+	serviceOf := func(id string) int32 {
+		idx, ok := serviceIndex[id]
+		if !ok {
+			idx = int32(len(f.services))
+			serviceIndex[id] = idx
+			f.services = append(f.services, service{added: map[int]bool{}, removed: map[int]bool{}})
+		}
+		return idx
+	}
+
+	firstTrip := int32(len(t.trips))
+	tripIndex := make(map[string]int32)
+	err = readTable(files, "trips.txt", true, func(row func(string) string) error {
+		route, ok := routeIndex[row("route_id")]
+		if !ok {
+			return fmt.Errorf("trip %s has unknown route %s", row("trip_id"), row("route_id"))
+		}
+		idx := int32(len(t.trips))
+		tripIndex[row("trip_id")] = idx
+		if _, ok := t.tripIDs[row("trip_id")]; !ok {
+			t.tripIDs[row("trip_id")] = idx
+		}
+		t.trips = append(t.trips, trip{
+			route:   route,
+			feed:    int32(len(t.feeds)),
+			service: serviceOf(row("service_id")),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	hasCalendar := false
+	err = readTable(files, "calendar.txt", false, func(row func(string) string) error {
+		hasCalendar = true
+		s := &f.services[serviceOf(row("service_id"))]
+		for day, column := range []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"} {
+			s.weekdays[day] = row(column) == "1"
+		}
+		var err error
+		if s.start, err = strconv.Atoi(row("start_date")); err != nil {
+			return fmt.Errorf("invalid start_date for service %s: %v", row("service_id"), err)
+		}
+		if s.end, err = strconv.Atoi(row("end_date")); err != nil {
+			return fmt.Errorf("invalid end_date for service %s: %v", row("service_id"), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = readTable(files, "calendar_dates.txt", !hasCalendar, func(row func(string) string) error {
+		s := &f.services[serviceOf(row("service_id"))]
+		date, err := strconv.Atoi(row("date"))
+		if err != nil {
+			return fmt.Errorf("invalid date for service %s: %v", row("service_id"), err)
+		}
+		switch row("exception_type") {
+		case "1":
+			s.added[date] = true
+		case "2":
+			s.removed[date] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	stopTimes := make(map[int32][]stopTime)
+	err = readTable(files, "stop_times.txt", true, func(row func(string) string) error {
+		tr, ok := tripIndex[row("trip_id")]
+		if !ok {
+			return fmt.Errorf("stop time has unknown trip %s", row("trip_id"))
+		}
+		stop, ok := stopIndex[row("stop_id")]
+		if !ok {
+			return fmt.Errorf("trip %s has unknown stop %s", row("trip_id"), row("stop_id"))
+		}
+		sequence, err := strconv.Atoi(row("stop_sequence"))
+		if err != nil {
+			return fmt.Errorf("invalid stop_sequence for trip %s: %v", row("trip_id"), err)
+		}
+		arrival, err := parseTime(row("arrival_time"))
+		if err != nil {
+			return fmt.Errorf("invalid arrival_time for trip %s: %v", row("trip_id"), err)
+		}
+		departure, err := parseTime(row("departure_time"))
+		if err != nil {
+			return fmt.Errorf("invalid departure_time for trip %s: %v", row("trip_id"), err)
+		}
+		stopTimes[tr] = append(stopTimes[tr], stopTime{
+			sequence:  sequence,
+			stop:      stop,
+			arrival:   arrival,
+			departure: departure,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for tr := firstTrip; tr < int32(len(t.trips)); tr++ {
+		times := stopTimes[tr]
+		if !interpolateTimes(times) {
+			continue // a trip needs at least two timed stops
+		}
+		tp := &t.trips[tr]
+		for _, st := range times {
+			tp.stops = append(tp.stops, st.stop)
+			tp.sequences = append(tp.sequences, int32(st.sequence))
+			tp.arrivals = append(tp.arrivals, st.arrival)
+			tp.departures = append(tp.departures, st.departure)
+		}
+		f.connections = appendConnections(f.connections, tr, tp.stops, tp.arrivals, tp.departures)
+	}
+
+	f.byArrival = sortConnections(f.connections)
+
+	t.feeds = append(t.feeds, f)
+	return nil
+}
+
+// appendConnections adds the connections between consecutive stops of a trip.
+// Positions with a negative time are passed through without stopping.
+func appendConnections(connections []connection, tr int32, stops, arrivals, departures []int32) []connection {
+	prev := -1
+	for i := range stops {
+		if arrivals[i] < 0 {
+			continue
+		}
+		if prev >= 0 {
+			arrival := arrivals[i]
+			if arrival < departures[prev] {
+				arrival = departures[prev]
+			}
+			connections = append(connections, connection{
+				trip:      tr,
+				seq:       int32(prev),
+				next:      int32(i),
+				from:      stops[prev],
+				to:        stops[i],
+				departure: departures[prev],
+				arrival:   arrival,
+			})
+		}
+		prev = i
+	}
+	return connections
+}
+
+// sortConnections orders connections by departure and returns their order by arrival
+func sortConnections(connections []connection) []int32 {
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].departure < connections[j].departure
+	})
+	byArrival := make([]int32, len(connections))
+	for i := range byArrival {
+		byArrival[i] = int32(i)
+	}
+	sort.Slice(byArrival, func(i, j int) bool {
+		return connections[byArrival[i]].arrival < connections[byArrival[j]].arrival
+	})
+	return byArrival
+}
+
+// interpolateTimes orders a trip's stop times and fills in missing times
+// evenly between the timed stops around them. It reports false if the first
+// or last stop has no time.
+func interpolateTimes(times []stopTime) bool {
+	if len(times) < 2 {
+		return false
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].sequence < times[j].sequence
+	})
+
+	for i := range times {
+		if times[i].arrival < 0 {
+			times[i].arrival = times[i].departure
+		}
+		if times[i].departure < 0 {
+			times[i].departure = times[i].arrival
+		}
+	}
+	last := len(times) - 1
+	if times[0].departure < 0 || times[last].arrival < 0 {
+		return false
+	}
+
+	prev := 0
+	for i := 1; i <= last; i++ {
+		if times[i].arrival < 0 {
+			continue
+		}
+		for k := prev + 1; k < i; k++ {
+			at := times[prev].departure + (times[i].arrival-times[prev].departure)*int32(k-prev)/int32(i-prev)
+			times[k].arrival, times[k].departure = at, at
+		}
+		prev = i
+	}
+	return true
+}
+
+// parseTime parses a GTFS time of day, HH:MM:SS where the hours may exceed
+// 24, into seconds. An empty time is -1.
+func parseTime(value string) (int32, error) {
+	if value == "" {
+		return -1, nil
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("expected HH:MM:SS, got %q", value)
+	}
+	var seconds int32
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("expected HH:MM:SS, got %q", value)
+		}
+		seconds = seconds*60 + int32(n)
+	}
+	return seconds, nil
+}
+
+// readTable calls fn for every row of a CSV file in the feed. row returns the
+// trimmed value of a column, or an empty string if the file has no such column.
+func readTable(files map[string]*zip.File, name string, required bool, fn func(row func(string) string) error) error {
+	file, ok := files[name]
+	if !ok {
+		if required {
+			return fmt.Errorf("%s is missing", name)
+		}
+		return nil
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", name, err)
+	}
+	defer rc.Close()
+
+	reader := csv.NewReader(rc)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))] = i
+	}
+
+	var record []string
+	row := func(column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	for line := 2; ; line++ {
+		record, err = reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		if err := fn(row); err != nil {
+			return fmt.Errorf("%s line %d: %v", name, line, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package gtfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int32
+		err   bool
+	}{
+		{value: "08:30:00", want: 8*3600 + 30*60},
+		{value: "7:05:09", want: 7*3600 + 5*60 + 9},
+		{value: "25:10:05", want: 25*3600 + 10*60 + 5},
+		{value: "", want: -1},
+		{value: "08:30", err: true},
+		{value: "08:30:00:00", err: true},
+		{value: "aa:30:00", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseTime(tt.value)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parseTime(%q) = %d, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("parseTime(%q) = %d, %v; want %d", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateTimes(t *testing.T) {
+	tests := []struct {
+		name  string
+		times []stopTime
+		ok    bool
+		want  []stopTime
+	}{
+		{
+			name: "timed stops",
+			times: []stopTime{
+				{sequence: 1, arrival: 100, departure: 120},
+				{sequence: 2, arrival: 200, departure: 200},
+			},
+			ok: true,
+			want: []stopTime{
+				{sequence: 1, arrival: 100, departure: 120},
+				{sequence: 2, arrival: 200, departure: 200},
+			},
+		},
+		{
+			name: "out of sequence",
+			times: []stopTime{
+				{sequence: 7, stop: 2, arrival: 300, departure: 300},
+				{sequence: 3, stop: 1, arrival: 100, departure: 100},
+			},
+			ok: true,
+			want: []stopTime{
+				{sequence: 3, stop: 1, arrival: 100, departure: 100},
+				{sequence: 7, stop: 2, arrival: 300, departure: 300},
+			},
+		},
+		{
+			name: "one time given",
+			times: []stopTime{
+				{sequence: 1, arrival: -1, departure: 100},
+				{sequence: 2, arrival: 200, departure: -1},
+			},
+			ok: true,
+			want: []stopTime{
+				{sequence: 1, arrival: 100, departure: 100},
+				{sequence: 2, arrival: 200, departure: 200},
+			},
+		},
+		{
+			name: "untimed stops between",
+			times: []stopTime{
+				{sequence: 1, arrival: 50, departure: 100},
+				{sequence: 2, arrival: -1, departure: -1},
+				{sequence: 3, arrival: -1, departure: -1},
+				{sequence: 4, arrival: 400, departure: 410},
+				{sequence: 5, arrival: -1, departure: -1},
+				{sequence: 6, arrival: 610, departure: 610},
+			},
+			ok: true,
+			want: []stopTime{
+				{sequence: 1, arrival: 50, departure: 100},
+				{sequence: 2, arrival: 200, departure: 200},
+				{sequence: 3, arrival: 300, departure: 300},
+				{sequence: 4, arrival: 400, departure: 410},
+				{sequence: 5, arrival: 510, departure: 510},
+				{sequence: 6, arrival: 610, departure: 610},
+			},
+		},
+		{
+			name: "first stop untimed",
+			times: []stopTime{
+				{sequence: 1, arrival: -1, departure: -1},
+				{sequence: 2, arrival: 200, departure: 200},
+			},
+		},
+		{
+			name: "last stop untimed",
+			times: []stopTime{
+				{sequence: 1, arrival: 100, departure: 100},
+				{sequence: 2, arrival: -1, departure: -1},
+			},
+		},
+		{
+			name:  "single stop",
+			times: []stopTime{{sequence: 1, arrival: 100, departure: 100}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok := interpolateTimes(tt.times)
+			if ok != tt.ok {
+				t.Fatalf("interpolateTimes reported %v, want %v", ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(tt.times, tt.want) {
+				t.Errorf("times = %+v, want %+v", tt.times, tt.want)
+			}
+		})
+	}
+}
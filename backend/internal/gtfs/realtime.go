@@ -0,0 +1,421 @@
+package gtfs
+
+import (
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+)
+
+// Realtime is a snapshot of GTFS-Realtime trip updates and service alerts
+// matched against a timetable. It is not changed once built.
+type Realtime struct {
+	streams   map[streamKey]*stream
+	alerts    []alert
+	noService []*alert // alerts that close a route or stop
+	updates   int
+}
+
+// streamKey identifies the trips of one feed on one service date
+type streamKey struct {
+	feed int32
+	date int // YYYYMMDD
+}
+
+// stream holds the connections of updated trips on one service date. Its
+// trips replace their scheduled runs, and cancelled trips have no connections.
+type stream struct {
+	connections []connection // ordered by departure
+	byArrival   []int32
+	replaced    map[int32]bool
+}
+
+// tripTimes is the realtime schedule of one trip; skipped stops have a
+// negative arrival
+type tripTimes struct {
+	cancelled  bool
+	arrivals   []int32
+	departures []int32
+}
+
+// alert is a service alert and the service it applies to
+type alert struct {
+	periods   [][2]int64 // unix seconds, 0 for an open end
+	noService bool
+	text      string
+	entities  []alertEntity
+}
+
+// alertEntity selects the service an alert informs about; negative indexes
+// and empty strings match anything
+type alertEntity struct {
+	agency    string
+	route     int32
+	routeType int
+	trip      int32
+	stop      int32
+}
+
+// ReadRealtime matches trip updates and alerts of GTFS-Realtime messages to
+// the timetable. Updates for unknown or added trips are ignored; later
+// messages win when they update the same trip.
+func (t *Timetable) ReadRealtime(messages ...*gtfsrt.FeedMessage) *Realtime {
+	rt := &Realtime{streams: make(map[streamKey]*stream)}
+	updated := make(map[streamKey]map[int32]*tripTimes)
+
+	for _, message := range messages {
+		at := time.Now()
+		if ts := message.GetHeader().GetTimestamp(); ts > 0 {
+			at = time.Unix(int64(ts), 0)
+		}
+		for _, entity := range message.GetEntity() {
+			if entity.GetIsDeleted() {
+				continue
+			}
+			if update := entity.GetTripUpdate(); update != nil {
+				tr, date, times, ok := t.readTripUpdate(update, at)
+				if !ok {
+					continue
+				}
+				key := streamKey{feed: t.trips[tr].feed, date: date}
+				if updated[key] == nil {
+					updated[key] = make(map[int32]*tripTimes)
+				}
+				updated[key][tr] = times
+			}
+			if a := entity.GetAlert(); a != nil {
+				if parsed, ok := t.readAlert(a); ok {
+					rt.alerts = append(rt.alerts, parsed)
+				}
+			}
+		}
+	}
+
+	for key, trips := range updated {
+		s := &stream{replaced: make(map[int32]bool, len(trips))}
+		for tr, times := range trips {
+			s.replaced[tr] = true
+			rt.updates++
+			if !times.cancelled {
+				s.connections = appendConnections(s.connections, tr, t.trips[tr].stops, times.arrivals, times.departures)
+			}
+		}
+		s.byArrival = sortConnections(s.connections)
+		rt.streams[key] = s
+	}
+	for i := range rt.alerts {
+		if rt.alerts[i].noService {
+			rt.noService = append(rt.noService, &rt.alerts[i])
+		}
+	}
+	return rt
+}
+
+// TripUpdateCount returns the number of scheduled trips with realtime updates
+func (rt *Realtime) TripUpdateCount() int {
+	return rt.updates
+}
+
+// AlertCount returns the number of alerts that apply to the timetable
+func (rt *Realtime) AlertCount() int {
+	return len(rt.alerts)
+}
+
+// SetRealtime replaces the realtime snapshot used by searches; nil returns
+// to the static timetable
+func (t *Timetable) SetRealtime(rt *Realtime) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.realtime = rt
+}
+
+func (t *Timetable) currentRealtime() *Realtime {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.realtime
+}
+
+// readTripUpdate resolves the trip and service date of an update and applies
+// its stop time predictions to the scheduled times
+func (t *Timetable) readTripUpdate(update *gtfsrt.TripUpdate, at time.Time) (int32, int, *tripTimes, bool) {
+	descriptor := update.GetTrip()
+	switch descriptor.GetScheduleRelationship() {
+	case gtfsrt.TripDescriptor_SCHEDULED, gtfsrt.TripDescriptor_CANCELED, gtfsrt.TripDescriptor_REPLACEMENT:
+	default:
+		return 0, 0, nil, false // trips that are not in the timetable
+	}
+	tr, ok := t.tripIDs[descriptor.GetTripId()]
+	if !ok || len(t.trips[tr].stops) == 0 {
+		return 0, 0, nil, false
+	}
+	f := t.feeds[t.trips[tr].feed]
+
+	var date time.Time
+	if value := descriptor.GetStartDate(); value != "" {
+		parsed, err := time.ParseInLocation("20060102", value, f.location)
+		if err != nil {
+			return 0, 0, nil, false
+		}
+		date = parsed
+	} else if date, ok = t.nearestRun(tr, at); !ok {
+		return 0, 0, nil, false
+	}
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, f.location)
+	if !f.services[t.trips[tr].service].runsOn(noon) {
+		return 0, 0, nil, false
+	}
+	key := noon.Year()*10000 + int(noon.Month())*100 + noon.Day()
+
+	if descriptor.GetScheduleRelationship() == gtfsrt.TripDescriptor_CANCELED {
+		return tr, key, &tripTimes{cancelled: true}, true
+	}
+	base := noon.Add(-12 * time.Hour).Unix()
+	return tr, key, t.predictTimes(tr, base, update), true
+}
+
+// nearestRun returns the service date on which a trip runs closest to at,
+// for updates without a start date
+func (t *Timetable) nearestRun(tr int32, at time.Time) (time.Time, bool) {
+	tp := &t.trips[tr]
+	f := t.feeds[tp.feed]
+	local := at.In(f.location)
+
+	var best time.Time
+	bestGap := int64(-1)
+	for offset := -1; offset <= 1; offset++ {
+		noon := time.Date(local.Year(), local.Month(), local.Day()+offset, 12, 0, 0, 0, f.location)
+		if !f.services[tp.service].runsOn(noon) {
+			continue
+		}
+		base := noon.Add(-12 * time.Hour).Unix()
+		gap := int64(0)
+		if start := base + int64(tp.departures[0]); at.Unix() < start {
+			gap = start - at.Unix()
+		} else if end := base + int64(tp.arrivals[len(tp.arrivals)-1]); at.Unix() > end {
+			gap = at.Unix() - end
+		}
+		if bestGap < 0 || gap < bestGap {
+			best, bestGap = noon, gap
+		}
+	}
+	return best, bestGap >= 0
+}
+
+// predictTimes applies stop time updates to the scheduled times of a trip.
+// A delay carries forward to later stops until the next update; stops before
+// the first update keep the trip delay, if any.
+func (t *Timetable) predictTimes(tr int32, base int64, update *gtfsrt.TripUpdate) *tripTimes {
+	tp := &t.trips[tr]
+	times := &tripTimes{
+		arrivals:   append([]int32(nil), tp.arrivals...),
+		departures: append([]int32(nil), tp.departures...),
+	}
+
+	// Match updates to positions along the trip, in order
+	positions := make(map[int]*gtfsrt.TripUpdate_StopTimeUpdate)
+	next := 0
+	for _, stu := range update.GetStopTimeUpdate() {
+		for i := next; i < len(tp.stops); i++ {
+			matched := false
+			if stu.StopSequence != nil {
+				matched = tp.sequences[i] == int32(stu.GetStopSequence())
+			} else {
+				matched = t.stops[tp.stops[i]].ID == stu.GetStopId()
+			}
+			if matched {
+				positions[i] = stu
+				next = i + 1
+				break
+			}
+		}
+	}
+
+	delay := update.GetDelay()
+	for i := range tp.stops {
+		stu, ok := positions[i]
+		if !ok {
+			times.arrivals[i] = max(tp.arrivals[i]+delay, 0)
+			times.departures[i] = max(tp.departures[i]+delay, 0)
+			continue
+		}
+		switch stu.GetScheduleRelationship() {
+		case gtfsrt.TripUpdate_StopTimeUpdate_SKIPPED:
+			times.arrivals[i] = -1
+			continue
+		case gtfsrt.TripUpdate_StopTimeUpdate_NO_DATA:
+			delay = 0
+			continue
+		}
+
+		arrival, hasArrival := predict(stu.GetArrival(), tp.arrivals[i], base)
+		departure, hasDeparture := predict(stu.GetDeparture(), tp.departures[i], base)
+		switch {
+		case hasArrival && hasDeparture:
+		case hasArrival:
+			departure = tp.departures[i] + arrival - tp.arrivals[i]
+		case hasDeparture:
+			arrival = tp.arrivals[i] + departure - tp.departures[i]
+		default:
+			arrival, departure = tp.arrivals[i]+delay, tp.departures[i]+delay
+		}
+		if departure < arrival {
+			departure = arrival
+		}
+		times.arrivals[i], times.departures[i] = arrival, departure
+		delay = departure - tp.departures[i]
+	}
+	return times
+}
+
+// predict returns the time of a stop time event relative to the service day
+func predict(event *gtfsrt.TripUpdate_StopTimeEvent, scheduled int32, base int64) (int32, bool) {
+	switch {
+	case event == nil:
+		return 0, false
+	case event.Time != nil:
+		at := event.GetTime() - base
+		if at < 0 {
+			at = 0
+		}
+		return int32(at), true
+	case event.Delay != nil:
+		return scheduled + event.GetDelay(), true
+	}
+	return 0, false
+}
+
+// readAlert keeps an alert if it informs about service in the timetable
+func (t *Timetable) readAlert(a *gtfsrt.Alert) (alert, bool) {
+	parsed := alert{
+		noService: a.GetEffect() == gtfsrt.Alert_NO_SERVICE,
+		text:      translation(a.GetHeaderText()),
+	}
+	if parsed.text == "" {
+		parsed.text = translation(a.GetDescriptionText())
+	}
+	for _, period := range a.GetActivePeriod() {
+		parsed.periods = append(parsed.periods, [2]int64{int64(period.GetStart()), int64(period.GetEnd())})
+	}
+
+	for _, selector := range a.GetInformedEntity() {
+		e := alertEntity{agency: selector.GetAgencyId(), route: -1, routeType: -1, trip: -1, stop: -1}
+		routeID := selector.GetRouteId()
+		if descriptor := selector.GetTrip(); descriptor != nil {
+			if id := descriptor.GetTripId(); id != "" {
+				tr, ok := t.tripIDs[id]
+				if !ok {
+					continue
+				}
+				e.trip = tr
+			}
+			if routeID == "" {
+				routeID = descriptor.GetRouteId()
+			}
+		}
+		if routeID != "" {
+			route, ok := t.routeIDs[routeID]
+			if !ok {
+				continue
+			}
+			e.route = route
+		}
+		if selector.RouteType != nil {
+			e.routeType = int(selector.GetRouteType())
+		}
+		if id := selector.GetStopId(); id != "" {
+			stop, ok := t.stopIDs[id]
+			if !ok {
+				continue
+			}
+			e.stop = stop
+		}
+		parsed.entities = append(parsed.entities, e)
+	}
+	return parsed, len(parsed.entities) > 0
+}
+
+// translation picks the English or untagged text of a translated string,
+// or else its first translation
+func translation(s *gtfsrt.TranslatedString) string {
+	translations := s.GetTranslation()
+	for _, tr := range translations {
+		if lang := tr.GetLanguage(); lang == "" || lang == "en" {
+			return tr.GetText()
+		}
+	}
+	if len(translations) > 0 {
+		return translations[0].GetText()
+	}
+	return ""
+}
+
+// active reports whether an alert is in force at some time between from and
+// to, in unix seconds
+func (a *alert) active(from, to int64) bool {
+	if len(a.periods) == 0 {
+		return true
+	}
+	for _, p := range a.periods {
+		if (p[0] == 0 || p[0] <= to) && (p[1] == 0 || p[1] >= from) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether an alert applies to a trip calling at a stop
+func (a *alert) matches(t *Timetable, tr, stop int32) bool {
+	route := &t.routes[t.trips[tr].route]
+	for _, e := range a.entities {
+		if e.agency != "" && e.agency != route.agency {
+			continue
+		}
+		if e.route >= 0 && e.route != t.trips[tr].route {
+			continue
+		}
+		if e.routeType >= 0 && e.routeType != route.routeType {
+			continue
+		}
+		if e.trip >= 0 && e.trip != tr {
+			continue
+		}
+		if e.stop >= 0 && e.stop != stop && e.stop != t.stops[stop].station {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// closed reports whether an alert stops a trip from serving a stop at a time
+func (rt *Realtime) closed(t *Timetable, tr, stop int32, at int64) bool {
+	if rt == nil {
+		return false
+	}
+	for _, a := range rt.noService {
+		if a.active(at, at) && a.matches(t, tr, stop) {
+			return true
+		}
+	}
+	return false
+}
+
+// alertsFor returns the texts of alerts about a ride on a trip between two
+// stops, in unix seconds
+func (rt *Realtime) alertsFor(t *Timetable, tr, from, to int32, departure, arrival int64) []string {
+	if rt == nil {
+		return nil
+	}
+	var texts []string
+	seen := make(map[string]bool)
+	for i := range rt.alerts {
+		a := &rt.alerts[i]
+		if a.text == "" || seen[a.text] || !a.active(departure, arrival) {
+			continue
+		}
+		if a.matches(t, tr, from) || a.matches(t, tr, to) {
+			seen[a.text] = true
+			texts = append(texts, a.text)
+		}
+	}
+	return texts
+}
@@ -0,0 +1,452 @@
+package gtfs
+
+import (
+	"errors"
+	"greenroute/internal/geo"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// MaxAccessWalk is how far a trip end may be from its first or last stop
+	MaxAccessWalk = 1000.0 // in meters
+
+	walkingSpeed = 1.3  // in m/s
+	walkDetour   = 1.25 // ratio of the walked distance to the straight line
+
+	// minTransferTime is the slack needed to change from one vehicle to another
+	minTransferTime = 2 * 60 // in seconds
+	// maxTripTime bounds how far from the requested time a search looks
+	maxTripTime = 6 * 60 * 60 // in seconds
+	// scanDays is how many service days of each feed a search covers
+	scanDays = 3
+)
+
+// ErrNoJourney is returned when no timetabled trip connects the trip ends
+var ErrNoJourney = errors.New("no transit journey found")
+
+// Journey is a door-to-door trip through the timetable
+type Journey struct {
+	Departure time.Time // leaving the origin
+	Arrival   time.Time // at the destination
+	Legs      []Leg
+}
+
+// Leg is a walk or a ride on one vehicle
+type Leg struct {
+	Route     *Route // nil for walks
+	From      string // stop name, empty at the trip ends
+	To        string
+	Departure time.Time
+	Arrival   time.Time
+	Distance  float64 // in meters
+	Points    []geo.Point
+	Delay     time.Duration // at the alighting stop, from realtime updates
+	Realtime  bool          // the times are predicted rather than scheduled
+	Alerts    []string      // service alerts about the ride
+}
+
+// labelKind tells how the scan reached a stop
+type labelKind uint8
+
+const (
+	unreached labelKind = iota
+	onFoot              // walked from the trip end
+	riding              // by vehicle
+	transfer            // walked from another stop after a ride
+)
+
+// label is the best time found at a stop and how it was reached. Earliest
+// arrival scans keep arrivals; latest departure scans keep departures.
+type label struct {
+	time     int64 // unix seconds
+	kind     labelKind
+	board    connectionRef // riding: the connection boarded
+	alight   connectionRef // riding: the connection alighted from
+	stop     int32         // transfer: the stop at the other end of the walk
+	distance float64       // onFoot and transfer: walked distance in meters
+}
+
+// connectionRef is a connection on one service day
+type connectionRef struct {
+	day   *serviceDay
+	index int32
+}
+
+func (r connectionRef) connection() *connection {
+	return &r.day.connections[r.index]
+}
+
+// serviceDay walks the connections of one feed on one day, skipping trips
+// whose service does not run. Trips with realtime updates are walked by a
+// second serviceDay holding their predicted connections.
+type serviceDay struct {
+	feed        *feed
+	slot        int   // 0 to scanDays-1, for per-trip state
+	base        int64 // unix seconds of noon minus 12 hours
+	connections []connection
+	byArrival   []int32
+	active      []bool
+	replaced    map[int32]bool // trips walked by the realtime serviceDay
+	realtime    bool
+	pos         int // into connections when scanning forward, into byArrival backward
+}
+
+// runs reports whether a trip runs on the day from this serviceDay's connections
+func (d *serviceDay) runs(t *Timetable, tr int32) bool {
+	if d.realtime {
+		return true
+	}
+	return d.active[t.trips[tr].service] && !d.replaced[tr]
+}
+
+// EarliestArrival finds the journey leaving no earlier than departure that
+// reaches the destination first. The journey leaves the origin just in time
+// for its first vehicle.
+func (t *Timetable) EarliestArrival(from, to geo.Point, departure time.Time) (*Journey, error) {
+	accesses := t.index.within(from, MaxAccessWalk)
+	egresses := t.index.within(to, MaxAccessWalk)
+	if len(accesses) == 0 || len(egresses) == 0 {
+		return nil, ErrNoJourney
+	}
+
+	start := departure.Unix()
+	labels := make([]label, len(t.stops))
+	for i := range labels {
+		labels[i].time = math.MaxInt64
+	}
+	for _, a := range accesses {
+		labels[a.stop] = label{time: start + walkSeconds(a.distance), kind: onFoot, distance: a.distance}
+	}
+	egress := make(map[int32]float64, len(egresses))
+	for _, e := range egresses {
+		egress[e.stop] = e.distance
+	}
+
+	best := int64(math.MaxInt64)
+	bestStop := int32(-1)
+	reach := func(stop int32) {
+		if d, ok := egress[stop]; ok {
+			if at := labels[stop].time + walkSeconds(d); at < best {
+				best, bestStop = at, stop
+			}
+		}
+	}
+
+	rt := t.currentRealtime()
+	days := t.serviceDays(departure, rt)
+	for _, day := range days {
+		connections := day.connections
+		day.pos = sort.Search(len(connections), func(i int) bool {
+			return day.base+int64(connections[i].departure) >= start
+		})
+	}
+
+	boarded := make([]connectionRef, len(t.trips)*scanDays)
+	for {
+		ref, ok := t.nextDeparture(days)
+		if !ok {
+			break
+		}
+		c := ref.connection()
+		dep := ref.day.base + int64(c.departure)
+		if dep >= best || dep > start+maxTripTime {
+			break
+		}
+
+		key := int(c.trip)*scanDays + ref.day.slot
+		if boarded[key].day == nil {
+			l := labels[c.from]
+			ready := l.time
+			if l.kind == riding {
+				ready += minTransferTime
+			}
+			if l.kind == unreached || ready > dep || rt.closed(t, c.trip, c.from, dep) {
+				continue
+			}
+			boarded[key] = ref
+		}
+
+		arr := ref.day.base + int64(c.arrival)
+		if arr >= labels[c.to].time || rt.closed(t, c.trip, c.to, arr) {
+			continue
+		}
+		labels[c.to] = label{time: arr, kind: riding, board: boarded[key], alight: ref}
+		reach(c.to)
+		for _, fp := range t.footpaths[c.to] {
+			if at := arr + walkSeconds(fp.distance); at < labels[fp.stop].time {
+				labels[fp.stop] = label{time: at, kind: transfer, stop: c.to, distance: fp.distance}
+				reach(fp.stop)
+			}
+		}
+	}
+	if bestStop < 0 {
+		return nil, ErrNoJourney
+	}
+
+	// Follow the labels back from the last stop
+	legs := []Leg{t.walk(t.stops[bestStop].Point, to, t.stops[bestStop].Name, "", labels[bestStop].time, egress[bestStop])}
+	stop := bestStop
+	for labels[stop].kind != onFoot {
+		l := labels[stop]
+		if l.kind == riding {
+			legs = append(legs, t.ride(l.board, l.alight, rt))
+			stop = l.board.connection().from
+			continue
+		}
+		legs = append(legs, t.walk(t.stops[l.stop].Point, t.stops[stop].Point, t.stops[l.stop].Name, t.stops[stop].Name,
+			l.time-walkSeconds(l.distance), l.distance))
+		stop = l.stop
+	}
+	first := legs[len(legs)-1].Departure.Unix()
+	legs = append(legs, t.walk(from, t.stops[stop].Point, "", t.stops[stop].Name,
+		first-walkSeconds(labels[stop].distance), labels[stop].distance))
+	for i, j := 0, len(legs)-1; i < j; i, j = i+1, j-1 {
+		legs[i], legs[j] = legs[j], legs[i]
+	}
+
+	return newJourney(legs), nil
+}
+
+// LatestDeparture finds the journey arriving by arriveBy that leaves the
+// origin last
+func (t *Timetable) LatestDeparture(from, to geo.Point, arriveBy time.Time) (*Journey, error) {
+	accesses := t.index.within(from, MaxAccessWalk)
+	egresses := t.index.within(to, MaxAccessWalk)
+	if len(accesses) == 0 || len(egresses) == 0 {
+		return nil, ErrNoJourney
+	}
+
+	end := arriveBy.Unix()
+	labels := make([]label, len(t.stops))
+	for i := range labels {
+		labels[i].time = math.MinInt64
+	}
+	for _, e := range egresses {
+		labels[e.stop] = label{time: end - walkSeconds(e.distance), kind: onFoot, distance: e.distance}
+	}
+	access := make(map[int32]float64, len(accesses))
+	for _, a := range accesses {
+		access[a.stop] = a.distance
+	}
+
+	best := int64(math.MinInt64)
+	bestStop := int32(-1)
+	reach := func(stop int32) {
+		if d, ok := access[stop]; ok {
+			if at := labels[stop].time - walkSeconds(d); at > best {
+				best, bestStop = at, stop
+			}
+		}
+	}
+
+	rt := t.currentRealtime()
+	days := t.serviceDays(arriveBy, rt)
+	for _, day := range days {
+		day.pos = sort.Search(len(day.byArrival), func(i int) bool {
+			return day.base+int64(day.connections[day.byArrival[i]].arrival) > end
+		}) - 1
+	}
+
+	alighted := make([]connectionRef, len(t.trips)*scanDays)
+	for {
+		ref, ok := t.prevArrival(days)
+		if !ok {
+			break
+		}
+		c := ref.connection()
+		arr := ref.day.base + int64(c.arrival)
+		if arr <= best || arr < end-maxTripTime {
+			break
+		}
+
+		key := int(c.trip)*scanDays + ref.day.slot
+		if alighted[key].day == nil {
+			l := labels[c.to]
+			needed := l.time
+			if l.kind == riding {
+				needed -= minTransferTime
+			}
+			if l.kind == unreached || arr > needed || rt.closed(t, c.trip, c.to, arr) {
+				continue
+			}
+			alighted[key] = ref
+		}
+
+		dep := ref.day.base + int64(c.departure)
+		if dep <= labels[c.from].time || rt.closed(t, c.trip, c.from, dep) {
+			continue
+		}
+		labels[c.from] = label{time: dep, kind: riding, board: ref, alight: alighted[key]}
+		reach(c.from)
+		for _, fp := range t.footpaths[c.from] {
+			if at := dep - walkSeconds(fp.distance); at > labels[fp.stop].time {
+				labels[fp.stop] = label{time: at, kind: transfer, stop: c.from, distance: fp.distance}
+				reach(fp.stop)
+			}
+		}
+	}
+	if bestStop < 0 {
+		return nil, ErrNoJourney
+	}
+
+	// Follow the labels forward from the first stop
+	legs := []Leg{t.walk(from, t.stops[bestStop].Point, "", t.stops[bestStop].Name, best, access[bestStop])}
+	stop := bestStop
+	for labels[stop].kind != onFoot {
+		l := labels[stop]
+		if l.kind == riding {
+			legs = append(legs, t.ride(l.board, l.alight, rt))
+			stop = l.alight.connection().to
+			continue
+		}
+		legs = append(legs, t.walk(t.stops[stop].Point, t.stops[l.stop].Point, t.stops[stop].Name, t.stops[l.stop].Name,
+			l.time, l.distance))
+		stop = l.stop
+	}
+	last := legs[len(legs)-1].Arrival.Unix()
+	legs = append(legs, t.walk(t.stops[stop].Point, to, t.stops[stop].Name, "", last, labels[stop].distance))
+
+	return newJourney(legs), nil
+}
+
+// serviceDays returns the service days of every feed around a time: the day
+// before it for trips running past midnight, its own day and the next day
+func (t *Timetable) serviceDays(at time.Time, rt *Realtime) []*serviceDay {
+	var days []*serviceDay
+	for fi, f := range t.feeds {
+		local := at.In(f.location)
+		for slot := 0; slot < scanDays; slot++ {
+			noon := time.Date(local.Year(), local.Month(), local.Day()+slot-1, 12, 0, 0, 0, f.location)
+			day := &serviceDay{
+				feed:        f,
+				slot:        slot,
+				base:        noon.Add(-12 * time.Hour).Unix(),
+				connections: f.connections,
+				byArrival:   f.byArrival,
+				active:      make([]bool, len(f.services)),
+			}
+			for i := range f.services {
+				day.active[i] = f.services[i].runsOn(noon)
+			}
+			days = append(days, day)
+
+			if rt == nil {
+				continue
+			}
+			date := noon.Year()*10000 + int(noon.Month())*100 + noon.Day()
+			if s, ok := rt.streams[streamKey{feed: int32(fi), date: date}]; ok {
+				day.replaced = s.replaced
+				days = append(days, &serviceDay{
+					feed:        f,
+					slot:        slot,
+					base:        day.base,
+					connections: s.connections,
+					byArrival:   s.byArrival,
+					realtime:    true,
+				})
+			}
+		}
+	}
+	return days
+}
+
+// nextDeparture returns the next connection by departure across service days
+func (t *Timetable) nextDeparture(days []*serviceDay) (connectionRef, bool) {
+	var next *serviceDay
+	var nextTime int64
+	for _, day := range days {
+		connections := day.connections
+		for day.pos < len(connections) && !day.runs(t, connections[day.pos].trip) {
+			day.pos++
+		}
+		if day.pos == len(connections) {
+			continue
+		}
+		if at := day.base + int64(connections[day.pos].departure); next == nil || at < nextTime {
+			next, nextTime = day, at
+		}
+	}
+	if next == nil {
+		return connectionRef{}, false
+	}
+	ref := connectionRef{day: next, index: int32(next.pos)}
+	next.pos++
+	return ref, true
+}
+
+// prevArrival returns the previous connection by arrival across service days
+func (t *Timetable) prevArrival(days []*serviceDay) (connectionRef, bool) {
+	var prev *serviceDay
+	var prevTime int64
+	for _, day := range days {
+		for day.pos >= 0 && !day.runs(t, day.connections[day.byArrival[day.pos]].trip) {
+			day.pos--
+		}
+		if day.pos < 0 {
+			continue
+		}
+		if at := day.base + int64(day.connections[day.byArrival[day.pos]].arrival); prev == nil || at > prevTime {
+			prev, prevTime = day, at
+		}
+	}
+	if prev == nil {
+		return connectionRef{}, false
+	}
+	ref := connectionRef{day: prev, index: prev.byArrival[prev.pos]}
+	prev.pos--
+	return ref, true
+}
+
+// ride returns the leg travelled on one trip between two of its connections,
+// with the delay and alerts known for it
+func (t *Timetable) ride(board, alight connectionRef, rt *Realtime) Leg {
+	first, last := board.connection(), alight.connection()
+	tr := &t.trips[first.trip]
+	departure := board.day.base + int64(first.departure)
+	arrival := alight.day.base + int64(last.arrival)
+
+	leg := Leg{
+		Route:     &t.routes[tr.route],
+		From:      t.stops[first.from].Name,
+		To:        t.stops[last.to].Name,
+		Departure: time.Unix(departure, 0),
+		Arrival:   time.Unix(arrival, 0),
+		Realtime:  alight.day.realtime,
+		Alerts:    rt.alertsFor(t, first.trip, first.from, last.to, departure, arrival),
+	}
+	if leg.Realtime {
+		leg.Delay = time.Duration(last.arrival-tr.arrivals[last.next]) * time.Second
+	}
+	for _, stop := range tr.stops[first.seq : last.next+1] {
+		leg.Points = append(leg.Points, t.stops[stop].Point)
+	}
+	leg.Distance = geo.PathLength(leg.Points)
+	return leg
+}
+
+// walk returns a walking leg leaving at departure, in unix seconds
+func (t *Timetable) walk(from, to geo.Point, fromName, toName string, departure int64, distance float64) Leg {
+	return Leg{
+		From:      fromName,
+		To:        toName,
+		Departure: time.Unix(departure, 0),
+		Arrival:   time.Unix(departure+walkSeconds(distance), 0),
+		Distance:  distance * walkDetour,
+		Points:    []geo.Point{from, to},
+	}
+}
+
+func newJourney(legs []Leg) *Journey {
+	return &Journey{
+		Departure: legs[0].Departure,
+		Arrival:   legs[len(legs)-1].Arrival,
+		Legs:      legs,
+	}
+}
+
+// walkSeconds returns the time to walk a straight-line distance
+func walkSeconds(distance float64) int64 {
+	return int64(math.Ceil(distance * walkDetour / walkingSpeed))
+}
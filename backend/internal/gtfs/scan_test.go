@@ -0,0 +1,269 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"errors"
+	"greenroute/internal/geo"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// testFeed is a tiny network: lines 1 and 2 connect A to D with a walk
+// between B and C, 170 m apart, line 3 runs from A to D directly but slower,
+// and the night line 4 runs from D past midnight through F to E
+var testFeed = map[string]string{
+	"agency.txt": `agency_id,agency_name,agency_url,agency_timezone
+test,Test Transit,https://example.com,UTC
+`,
+	"stops.txt": `stop_id,stop_name,stop_lat,stop_lon
+A,Alpha,52.0,13.0
+B,Bravo,52.0,13.1
+C,Charlie,52.0015,13.1
+D,Delta,52.0,13.2
+F,Foxtrot,52.0,13.25
+E,Echo,52.0,13.3
+`,
+	"routes.txt": `route_id,route_short_name,route_type
+R1,1,2
+R2,2,2
+R3,3,2
+R4,4,2
+`,
+	"trips.txt": `route_id,service_id,trip_id
+R1,daily,T1
+R2,daily,T2
+R3,daily,T3
+R4,daily,T4
+`,
+	"calendar.txt": `service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date
+daily,1,1,1,1,1,1,1,20260101,20261231
+`,
+	"stop_times.txt": `trip_id,arrival_time,departure_time,stop_id,stop_sequence
+T1,08:00:00,08:00:00,A,1
+T1,08:30:00,08:30:00,B,2
+T2,08:40:00,08:40:00,C,1
+T2,09:10:00,09:10:00,D,2
+T3,07:50:00,07:50:00,A,1
+T3,09:30:00,09:30:00,D,2
+T4,23:50:00,23:50:00,D,1
+T4,24:10:00,24:10:00,F,2
+T4,24:20:00,24:20:00,E,3
+`,
+}
+
+// loadTestFeed zips testFeed and loads it
+func loadTestFeed(t *testing.T) *Timetable {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "feed.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(file)
+	for name, content := range testFeed {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	timetable, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return timetable
+}
+
+// cancelTrips returns a realtime feed cancelling trips on a service date
+func cancelTrips(date string, trips ...string) *gtfsrt.FeedMessage {
+	message := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+	}
+	for _, id := range trips {
+		message.Entity = append(message.Entity, &gtfsrt.FeedEntity{
+			Id: proto.String(id),
+			TripUpdate: &gtfsrt.TripUpdate{
+				Trip: &gtfsrt.TripDescriptor{
+					TripId:               proto.String(id),
+					StartDate:            proto.String(date),
+					ScheduleRelationship: gtfsrt.TripDescriptor_CANCELED.Enum(),
+				},
+			},
+		})
+	}
+	return message
+}
+
+func TestConnectionScan(t *testing.T) {
+	timetable := loadTestFeed(t)
+	stop := func(id string) geo.Point {
+		return timetable.stops[timetable.stopIDs[id]].Point
+	}
+	at := func(day int, clock string) time.Time {
+		tod, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2026, 3, 10+day, tod.Hour(), tod.Minute(), 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		from, to  string
+		departure time.Time // for an earliest arrival search
+		arriveBy  time.Time // for a latest departure search
+		cancelled []string
+		lines     []string // of the rides, with "" for walks between them
+		leave     time.Time
+		arrive    time.Time
+		err       error
+	}{
+		{
+			name:      "footpath transfer",
+			from:      "A",
+			to:        "D",
+			departure: at(0, "07:45"),
+			lines:     []string{"1", "", "2"},
+			leave:     at(0, "08:00"),
+			arrive:    at(0, "09:10"),
+		},
+		{
+			name:      "cancelled first trip",
+			from:      "A",
+			to:        "D",
+			departure: at(0, "07:45"),
+			cancelled: []string{"T1"},
+			lines:     []string{"3"},
+			leave:     at(0, "07:50"),
+			arrive:    at(0, "09:30"),
+		},
+		{
+			name:      "cancelled connecting trip",
+			from:      "A",
+			to:        "D",
+			departure: at(0, "07:45"),
+			cancelled: []string{"T2"},
+			lines:     []string{"3"},
+			leave:     at(0, "07:50"),
+			arrive:    at(0, "09:30"),
+		},
+		{
+			name:      "cancelled on another day",
+			from:      "A",
+			to:        "D",
+			departure: at(1, "07:45"),
+			cancelled: []string{"T2"},
+			lines:     []string{"1", "", "2"},
+			leave:     at(1, "08:00"),
+			arrive:    at(1, "09:10"),
+		},
+		{
+			name:      "nothing left to ride",
+			from:      "A",
+			to:        "D",
+			departure: at(0, "08:15"),
+			err:       ErrNoJourney,
+		},
+		{
+			name:      "overnight trip",
+			from:      "D",
+			to:        "E",
+			departure: at(0, "23:45"),
+			lines:     []string{"4"},
+			leave:     at(0, "23:50"),
+			arrive:    at(1, "00:20"),
+		},
+		{
+			name:      "overnight trip of the previous service day",
+			from:      "F",
+			to:        "E",
+			departure: at(1, "00:00"),
+			lines:     []string{"4"},
+			leave:     at(1, "00:10"),
+			arrive:    at(1, "00:20"),
+		},
+		{
+			name:     "arrive by with a footpath transfer",
+			from:     "A",
+			to:       "D",
+			arriveBy: at(0, "09:15"),
+			lines:    []string{"1", "", "2"},
+			leave:    at(0, "08:00"),
+			arrive:   at(0, "09:10"),
+		},
+		{
+			name:      "arrive by with a cancelled trip",
+			from:      "A",
+			to:        "D",
+			arriveBy:  at(0, "09:15"),
+			cancelled: []string{"T2"},
+			err:       ErrNoJourney,
+		},
+		{
+			name:     "arrive by after midnight",
+			from:     "D",
+			to:       "E",
+			arriveBy: at(1, "00:30"),
+			lines:    []string{"4"},
+			leave:    at(0, "23:50"),
+			arrive:   at(1, "00:20"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.cancelled) > 0 {
+				timetable.SetRealtime(timetable.ReadRealtime(cancelTrips("20260310", tt.cancelled...)))
+				defer timetable.SetRealtime(nil)
+			}
+
+			var journey *Journey
+			var err error
+			if tt.arriveBy.IsZero() {
+				journey, err = timetable.EarliestArrival(stop(tt.from), stop(tt.to), tt.departure)
+			} else {
+				journey, err = timetable.LatestDeparture(stop(tt.from), stop(tt.to), tt.arriveBy)
+			}
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("no journey: %v", err)
+			}
+
+			// The trip ends are at stops, so the first and last walks are empty
+			var lines []string
+			for _, leg := range journey.Legs[1 : len(journey.Legs)-1] {
+				line := ""
+				if leg.Route != nil {
+					line = leg.Route.Name
+				}
+				lines = append(lines, line)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("lines = %q, want %q", lines, tt.lines)
+			}
+			if !journey.Departure.Equal(tt.leave) || !journey.Arrival.Equal(tt.arrive) {
+				t.Errorf("journey %v to %v, want %v to %v",
+					journey.Departure.UTC(), journey.Arrival.UTC(), tt.leave, tt.arrive)
+			}
+		})
+	}
+}
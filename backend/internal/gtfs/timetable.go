@@ -0,0 +1,228 @@
+package gtfs
+
+import (
+	"greenroute/internal/geo"
+	"greenroute/internal/models"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Timetable holds the stops and scheduled trips of one or more GTFS feeds,
+// and the latest realtime snapshot of their service
+type Timetable struct {
+	stops     []Stop
+	routes    []Route
+	trips     []trip
+	feeds     []*feed
+	footpaths [][]footpath // walking transfers from each stop
+	index     *stopIndex   // stops served by at least one trip
+
+	// Feed IDs for matching realtime updates; the first feed wins a clash
+	stopIDs  map[string]int32
+	routeIDs map[string]int32
+	tripIDs  map[string]int32
+
+	mu       sync.RWMutex
+	realtime *Realtime
+}
+
+// Stop is a place where passengers board or leave a vehicle, or a station
+// grouping such places
+type Stop struct {
+	ID      string // as given in the feed
+	Name    string
+	Point   geo.Point
+	station int32 // parent station, -1 for none
+	hub     bool  // served by a vehicle other than a bus or coach
+}
+
+// Route is a transit line
+type Route struct {
+	Name      string
+	Vehicle   models.TransitVehicle // empty if the route type is not known
+	agency    string
+	routeType int
+}
+
+// trip is one scheduled run of a vehicle along a route. The stop slices are
+// indexed by position along the trip.
+type trip struct {
+	route      int32
+	feed       int32
+	service    int32   // index into the services of its feed
+	stops      []int32 // stop at each position
+	sequences  []int32 // stop_sequence at each position
+	arrivals   []int32 // scheduled, in seconds like connection times
+	departures []int32
+}
+
+// feed holds the calendar and connections of one GTFS feed. Times are
+// seconds since noon minus 12 hours of the service day, in the feed's time zone.
+type feed struct {
+	location    *time.Location
+	services    []service
+	connections []connection // ordered by departure
+	byArrival   []int32      // connections ordered by arrival
+}
+
+// connection is a vehicle travelling between two consecutive stops of a trip
+type connection struct {
+	trip      int32
+	seq       int32 // position of the departure stop in the trip
+	next      int32 // position of the arrival stop, after seq
+	from, to  int32
+	departure int32
+	arrival   int32
+}
+
+// service is a set of days on which trips run
+type service struct {
+	weekdays   [7]bool // Sunday first, as time.Weekday
+	start, end int     // dates as YYYYMMDD, 0 without a calendar entry
+	added      map[int]bool
+	removed    map[int]bool
+}
+
+// runsOn reports whether the service runs on a date
+func (s *service) runsOn(date time.Time) bool {
+	key := date.Year()*10000 + int(date.Month())*100 + date.Day()
+	if s.removed[key] {
+		return false
+	}
+	if s.added[key] {
+		return true
+	}
+	return s.start != 0 && key >= s.start && key <= s.end && s.weekdays[date.Weekday()]
+}
+
+// footpath is a walk between two nearby stops
+type footpath struct {
+	stop     int32
+	distance float64 // in meters
+}
+
+// StopCount returns the number of stops and stations in the timetable
+func (t *Timetable) StopCount() int {
+	return len(t.stops)
+}
+
+// TripCount returns the number of trips in the timetable
+func (t *Timetable) TripCount() int {
+	return len(t.trips)
+}
+
+// Stations returns the stations within a radius that are served by rail,
+// metro, tram, ferry or cable transport, closest first. Platforms of one
+// station are reported once, as the station.
+func (t *Timetable) Stations(near geo.Point, radiusMeters float64) []Stop {
+	seen := make(map[int32]bool)
+	var stations []Stop
+	for _, s := range t.index.within(near, radiusMeters) {
+		if !t.stops[s.stop].hub {
+			continue
+		}
+		station := s.stop
+		if parent := t.stops[station].station; parent >= 0 {
+			station = parent
+		}
+		if !seen[station] {
+			seen[station] = true
+			stations = append(stations, t.stops[station])
+		}
+	}
+	return stations
+}
+
+// vehicleOf maps a GTFS route type, basic or extended, to a transit vehicle
+func vehicleOf(routeType int) models.TransitVehicle {
+	switch {
+	case routeType == 0 || routeType == 5:
+		return models.Tram
+	case routeType == 1 || routeType == 12:
+		return models.Metro
+	case routeType == 2:
+		return models.Rail
+	case routeType == 3 || routeType == 11:
+		return models.Bus
+	case routeType == 4:
+		return models.Ferry
+	case routeType == 6 || routeType == 7:
+		return models.Cable
+	case routeType >= 100 && routeType < 200:
+		return models.Rail
+	case routeType >= 200 && routeType < 300:
+		return models.Coach
+	case routeType >= 400 && routeType < 500:
+		return models.Metro
+	case routeType >= 700 && routeType < 900:
+		return models.Bus
+	case routeType >= 900 && routeType < 1000:
+		return models.Tram
+	case routeType == 1000 || routeType == 1200:
+		return models.Ferry
+	case routeType >= 1300 && routeType < 1500:
+		return models.Cable
+	default:
+		return ""
+	}
+}
+
+// indexCellDegrees is the size of a stop index cell
+const indexCellDegrees = 0.01
+
+// stopIndex is a uniform grid used to find stops near a point
+type stopIndex struct {
+	cells  map[[2]int32][]int32
+	points []geo.Point
+}
+
+// stopDistance is a stop and its distance from a query point
+type stopDistance struct {
+	stop     int32
+	distance float64 // in meters
+}
+
+func newStopIndex(points []geo.Point) *stopIndex {
+	return &stopIndex{
+		cells:  make(map[[2]int32][]int32),
+		points: points,
+	}
+}
+
+func cellOf(p geo.Point) [2]int32 {
+	return [2]int32{
+		int32(math.Floor(p.Lat / indexCellDegrees)),
+		int32(math.Floor(p.Lng / indexCellDegrees)),
+	}
+}
+
+func (si *stopIndex) insert(stop int32) {
+	cell := cellOf(si.points[stop])
+	si.cells[cell] = append(si.cells[cell], stop)
+}
+
+// within returns the stops within a radius of p, closest first
+func (si *stopIndex) within(p geo.Point, radiusMeters float64) []stopDistance {
+	dLat := radiusMeters / 111000
+	dLng := radiusMeters / (111000 * math.Max(math.Cos(p.Lat*math.Pi/180), 0.01))
+	low := cellOf(geo.Point{Lat: p.Lat - dLat, Lng: p.Lng - dLng})
+	high := cellOf(geo.Point{Lat: p.Lat + dLat, Lng: p.Lng + dLng})
+
+	var result []stopDistance
+	for a := low[0]; a <= high[0]; a++ {
+		for b := low[1]; b <= high[1]; b++ {
+			for _, stop := range si.cells[[2]int32{a, b}] {
+				if d := geo.Haversine(p, si.points[stop]); d <= radiusMeters {
+					result = append(result, stopDistance{stop: stop, distance: d})
+				}
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].distance < result[j].distance
+	})
+	return result
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// APIKey describes an API key without its secret
+type APIKey struct {
+	ID                 uint       `json:"id"`
+	Name               string     `json:"name"`
+	Prefix             string     `json:"prefix"` // first characters of the key, for recognising it
+	RateLimitPerMinute int        `json:"rate_limit_per_minute"`
+	MonthlyQuota       int        `json:"monthly_quota"` // 0 for unlimited
+	CreatedAt          time.Time  `json:"created_at"`
+	LastUsedAt         *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt          *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyUsage is the number of requests made with a key in one calendar month
+type APIKeyUsage struct {
+	Month    string `json:"month"` // YYYY-MM, UTC
+	Requests int64  `json:"requests"`
+	Rejected int64  `json:"rejected"` // refused for rate limit or quota
+	Quota    int    `json:"quota"`    // 0 for unlimited
+}
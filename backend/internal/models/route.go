@@ -8,10 +8,30 @@ import (
 type TransportMode string
 
 const (
-	Car         TransportMode = "car"
-	Bicycle     TransportMode = "bicycle"
+	Car           TransportMode = "car"
+	Bicycle       TransportMode = "bicycle"
 	PublicTransit TransportMode = "public_transit"
-	Walking     TransportMode = "walking"
+	Walking       TransportMode = "walking"
+	BikeShare     TransportMode = "bike_share" // docked or dockless shared bikes, from GBFS feeds
+	EScooter      TransportMode = "e_scooter"  // shared electric scooters, from GBFS feeds
+)
+
+// Shared reports whether the mode rents a vehicle from a sharing system
+func (m TransportMode) Shared() bool {
+	return m == BikeShare || m == EScooter
+}
+
+// TransitVehicle is the kind of vehicle serving a public transit ride
+type TransitVehicle string
+
+const (
+	Bus   TransitVehicle = "bus"
+	Coach TransitVehicle = "coach"
+	Tram  TransitVehicle = "tram" // including light rail
+	Metro TransitVehicle = "metro"
+	Rail  TransitVehicle = "rail"
+	Ferry TransitVehicle = "ferry"
+	Cable TransitVehicle = "cable" // aerial lifts and funiculars
 )
 
 // Location represents a geographical point
@@ -23,12 +43,70 @@ type Location struct {
 
 // RouteSegment represents a portion of the route with specific transport mode
 type RouteSegment struct {
-	StartLocation Location     `json:"start_location"`
-	EndLocation   Location     `json:"end_location"`
-	Mode          TransportMode `json:"mode"`
-	Duration      time.Duration `json:"duration"`
-	Distance      float64      `json:"distance"` // in meters
-	CO2Emission   float64      `json:"co2_emission"` // in grams
+	StartLocation     Location            `json:"start_location"`
+	EndLocation       Location            `json:"end_location"`
+	Mode              TransportMode       `json:"mode"`
+	Duration          time.Duration       `json:"duration"`
+	Distance          float64             `json:"distance"`     // in meters
+	CO2Emission       float64             `json:"co2_emission"` // in grams
+	EmissionFactorSet string              `json:"emission_factor_set,omitempty"`
+	Polyline          string              `json:"polyline,omitempty"`  // encoded polyline of the path, if known
+	ETA               *TravelTimeEstimate `json:"eta,omitempty"`       // from traffic history, driving only
+	Departure         *time.Time          `json:"departure,omitempty"` // timetabled departure, transit only
+	Rides             []TransitRide       `json:"rides,omitempty"`     // vehicles boarded, GTFS transit only
+	Shared            *SharedRide         `json:"shared,omitempty"`    // rental details, shared modes only
+	Elevation         *ElevationProfile   `json:"elevation,omitempty"` // terrain along the path, if a DEM covers it
+}
+
+// ElevationProfile is the terrain along a segment, read from a digital
+// elevation model
+type ElevationProfile struct {
+	Ascent   float64          `json:"ascent"`    // total climb, in meters
+	Descent  float64          `json:"descent"`   // total drop, in meters
+	MaxGrade float64          `json:"max_grade"` // steepest climb over 100 m, as a fraction
+	Points   []ElevationPoint `json:"points"`
+}
+
+// ElevationPoint is the height of the terrain at a distance along a segment
+type ElevationPoint struct {
+	Distance  float64 `json:"distance"`  // in meters
+	Elevation float64 `json:"elevation"` // above sea level, in meters
+}
+
+// SharedRide is where a shared bike or scooter is picked up and left. The
+// counts are those reported when the route was planned.
+type SharedRide struct {
+	System            string `json:"system"`
+	Pickup            string `json:"pickup"`                    // station name, or the vehicle ID when dockless
+	Dropoff           string `json:"dropoff,omitempty"`         // station name, empty when left at the destination
+	VehiclesAvailable int    `json:"vehicles_available"`        // at the pickup
+	DocksAvailable    int    `json:"docks_available,omitempty"` // at the dropoff
+}
+
+// TransitRide is one vehicle boarded on a public transit segment
+type TransitRide struct {
+	Line        string         `json:"line"`
+	Vehicle     TransitVehicle `json:"vehicle,omitempty"`
+	FromStop    string         `json:"from_stop"`
+	ToStop      string         `json:"to_stop"`
+	Departure   time.Time      `json:"departure"`
+	Arrival     time.Time      `json:"arrival"`
+	Distance    float64        `json:"distance"`           // in meters
+	CO2Emission float64        `json:"co2_emission"`       // in grams
+	Delay       time.Duration  `json:"delay,omitempty"`    // predicted lateness at ToStop
+	Realtime    bool           `json:"realtime,omitempty"` // times come from a live feed
+	Alerts      []string       `json:"alerts,omitempty"`   // service alerts about the ride
+}
+
+// TravelTimeEstimate is a segment's travel time learned from the history of
+// similar trips at the same hour of the week
+type TravelTimeEstimate struct {
+	Mean    time.Duration `json:"mean"`
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	Low     time.Duration `json:"low"` // 90% interval for a single trip
+	High    time.Duration `json:"high"`
+	Samples float64       `json:"samples"` // effective number of trips, older ones weighted less
 }
 
 // Route represents a complete route with multiple segments
@@ -41,14 +119,80 @@ type Route struct {
 	TotalDistance float64        `json:"total_distance"` // in meters
 	TotalDuration time.Duration  `json:"total_duration"`
 	TotalEmission float64        `json:"total_emission"` // in grams
+	DepartureTime time.Time      `json:"departure_time"`
+	ArrivalTime   time.Time      `json:"arrival_time"` // including waits for timetabled transit
+	Rank          int            `json:"rank"`         // 1 for the recommended route
+	Score         float64        `json:"score"`        // weighted cost, lower is better
+	ChargingStops []ChargingStop `json:"charging_stops,omitempty"`
+	Warnings      []string       `json:"warnings,omitempty"`
 	CreatedAt     time.Time      `json:"created_at"`
 }
 
+// ChargingStop represents a planned EV charging stop between two segments
+type ChargingStop struct {
+	StationID      int           `json:"station_id"`
+	Name           string        `json:"name"`
+	Location       Location      `json:"location"`
+	ArrivalSoC     float64       `json:"arrival_soc"`   // 0-1
+	DepartureSoC   float64       `json:"departure_soc"` // 0-1
+	EnergyKWh      float64       `json:"energy_kwh"`
+	Connector      ConnectorType `json:"connector,omitempty"`
+	PowerKW        float64       `json:"power_kw"`
+	ChargeDuration time.Duration `json:"charge_duration"` // dwell time including plugging in
+}
+
 // RoutePreferences represents user preferences for route calculation
 type RoutePreferences struct {
-	PreferredModes    []TransportMode `json:"preferred_modes"`
-	AvoidHighways     bool           `json:"avoid_highways"`
-	MaxWalkingDistance float64        `json:"max_walking_distance"` // in meters
-	PrioritizeEmission bool           `json:"prioritize_emission"`
-	MaxTransfers      int            `json:"max_transfers"`
+	PreferredModes     []TransportMode `json:"preferred_modes"`
+	AvoidHighways      bool            `json:"avoid_highways"`
+	MaxWalkingDistance float64         `json:"max_walking_distance"` // in meters, 0 for no limit
+	PrioritizeEmission bool            `json:"prioritize_emission"`
+	MaxTransfers       int             `json:"max_transfers"`      // 0 for no limit
+	AvoidSteepClimbs   bool            `json:"avoid_steep_climbs"` // for walking and cycling
+	Weights            *RankingWeights `json:"weights,omitempty"`
+	Vehicle            *VehicleProfile `json:"vehicle,omitempty"`
+}
+
+// RankingWeights sets the relative importance of each criterion when ranking
+// alternative routes. Weights are normalised, so only their ratios matter.
+type RankingWeights struct {
+	Duration float64 `json:"duration"`
+	Distance float64 `json:"distance"`
+	Emission float64 `json:"emission"`
+}
+
+// PreferenceProfile is a named set of route preferences saved by a user
+type PreferenceProfile struct {
+	Name        string           `json:"name"`
+	IsDefault   bool             `json:"is_default"`
+	Preferences RoutePreferences `json:"preferences"`
+}
+
+// DepartureObjective is what a departure time is chosen to minimise
+type DepartureObjective string
+
+const (
+	MinimiseDuration DepartureObjective = "duration"
+	MinimiseEmission DepartureObjective = "emission"
+)
+
+// DepartureWindow asks for the best time to leave. Departures are tried from
+// Earliest to Latest; with a LatestArrival, only those arriving in time count.
+type DepartureWindow struct {
+	Earliest      time.Time          `json:"earliest,omitempty"`       // defaults to now
+	Latest        *time.Time         `json:"latest,omitempty"`         // defaults to LatestArrival
+	LatestArrival *time.Time         `json:"latest_arrival,omitempty"` // arrive no later than this
+	Step          time.Duration      `json:"step,omitempty"`           // between tried departures, defaults to 15 minutes
+	Objective     DepartureObjective `json:"objective,omitempty"`      // defaults to emission if prioritised, else duration
+}
+
+// DepartureOption is the predicted trip when leaving at one time
+type DepartureOption struct {
+	Departure          time.Time       `json:"departure"`
+	Arrival            time.Time       `json:"arrival"`
+	Duration           time.Duration   `json:"duration"`
+	Emission           float64         `json:"emission"`            // in grams, including congestion
+	CongestionEmission float64         `json:"congestion_emission"` // in grams, from driving slower than at the quietest departure
+	Modes              []TransportMode `json:"modes"`
+	FromHistory        bool            `json:"from_history"` // whether traffic history predicted the driving time
 }
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ScheduledTrip is a recurring trip, such as a commute arriving at 09:00 on
+// weekdays. It is planned again on the morning of every occurrence.
+type ScheduledTrip struct {
+	ID            uint              `json:"id"`
+	Name          string            `json:"name"`
+	StartLocation Location          `json:"start_location"`
+	EndLocation   Location          `json:"end_location"`
+	Days          []string          `json:"days"`                  // mon, tue, wed, thu, fri, sat or sun
+	ArriveBy      string            `json:"arrive_by"`             // local time of day, HH:MM
+	TimeZone      string            `json:"time_zone,omitempty"`   // IANA name, defaults to UTC
+	Profile       string            `json:"profile,omitempty"`     // preference profile, empty for the default
+	Preferences   *RoutePreferences `json:"preferences,omitempty"` // used instead of the profile if set
+	NextPlanAt    time.Time         `json:"next_plan_at"`
+	LastRouteID   string            `json:"last_route_id,omitempty"` // most recently planned route
+	PlannedFor    *time.Time        `json:"planned_for,omitempty"`   // arrival the last plan was made for
+	LastError     string            `json:"last_error,omitempty"`    // why the last plan failed
+	CreatedAt     time.Time         `json:"created_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// User is the public representation of a registered user
+type User struct {
+	ID        uint      `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// FuelType represents the energy source of a vehicle
+type FuelType string
+
+const (
+	Petrol FuelType = "petrol"
+	Diesel FuelType = "diesel"
+	Hybrid FuelType = "hybrid"
+	BEV    FuelType = "bev"  // battery electric vehicle
+	PHEV   FuelType = "phev" // plug-in hybrid electric vehicle
+)
+
+// VehicleProfile describes the car used for driving segments
+type VehicleProfile struct {
+	FuelType  FuelType `json:"fuel_type"`
+	SizeClass string   `json:"size_class,omitempty"` // small, medium, large or average
+	ModelYear int      `json:"model_year,omitempty"`
+	Occupancy int      `json:"occupancy,omitempty"` // travellers sharing the car, defaults to 1
+
+	// Electric vehicles only
+	ConsumptionKWhPerKm float64    `json:"consumption_kwh_per_km,omitempty"` // at 50 km/h, defaults by size class
+	MassKg              float64    `json:"mass_kg,omitempty"`                // with occupants, for climbs; defaults by size class
+	GridRegion          string     `json:"grid_region,omitempty"`            // electricity grid the battery is charged from
+	ChargeTime          *time.Time `json:"charge_time,omitempty"`            // when the battery is charged, defaults to departure
+
+	// Battery state used to plan charging stops; planning is skipped without a capacity
+	BatteryCapacityKWh float64 `json:"battery_capacity_kwh,omitempty"`
+	StartSoC           float64 `json:"start_soc,omitempty"`           // 0-1, defaults to 1
+	MinArrivalSoC      float64 `json:"min_arrival_soc,omitempty"`     // 0-1 reserve kept at every stop, defaults to 0.1
+	MaxChargePowerKW   float64 `json:"max_charge_power_kw,omitempty"` // vehicle charging limit, 0 for none
+
+	// Charging hardware the vehicle can use, nil to accept every station
+	Connectors *ConnectorProfile `json:"connectors,omitempty"`
+}
+
+// ConnectorType represents a physical EV charging connector standard
+type ConnectorType string
+
+const (
+	CCS1    ConnectorType = "ccs1"
+	CCS2    ConnectorType = "ccs2"
+	CHAdeMO ConnectorType = "chademo"
+	Type1   ConnectorType = "type1"
+	Type2   ConnectorType = "type2"
+	NACS    ConnectorType = "nacs"
+)
+
+// ConnectorProfile restricts charging stations to those a vehicle can use
+type ConnectorProfile struct {
+	Connectors []ConnectorType `json:"connectors,omitempty"`   // accepted connectors, empty for any
+	MinPowerKW float64         `json:"min_power_kw,omitempty"` // minimum power of a compatible connection
+	PublicOnly bool            `json:"public_only,omitempty"`  // exclude private and restricted stations
+}
@@ -0,0 +1,273 @@
+package osmrouter
+
+import (
+	"context"
+	"fmt"
+	"greenroute/internal/geo"
+	"math"
+	"os"
+	"runtime"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+)
+
+// Graph is an in-memory road graph built from an OpenStreetMap extract
+type Graph struct {
+	points  []geo.Point
+	offsets []int32 // edges of node i are edges[offsets[i]:offsets[i+1]]
+	edges   []edge
+	index   [profileCount]*gridIndex
+}
+
+// edge is a directed connection between two graph nodes
+type edge struct {
+	to      int32
+	length  float32               // in meters
+	speeds  [profileCount]float32 // in km/h, zero when the profile has no access
+	highway bool                  // motorway or trunk road
+}
+
+// rawWay holds a routable way until node coordinates are known
+type rawWay struct {
+	nodes   []int32
+	access  [profileCount]wayAccess
+	highway bool
+}
+
+// LoadPBF builds a road graph from an .osm.pbf extract.
+// The file is read twice: once for ways and once for the coordinates of their nodes.
+func LoadPBF(path string) (*Graph, error) {
+	nodeIndex := make(map[osm.NodeID]int32)
+	var ways []rawWay
+
+	err := scanPBF(path, true, false, func(obj osm.Object) {
+		way, ok := obj.(*osm.Way)
+		if !ok || len(way.Nodes) < 2 {
+			return
+		}
+
+		access := evaluateWay(way.Tags)
+		routable := false
+		for _, a := range access {
+			if a.forward || a.backward {
+				routable = true
+			}
+		}
+		if !routable {
+			return
+		}
+
+		nodes := make([]int32, len(way.Nodes))
+		for i, wn := range way.Nodes {
+			idx, ok := nodeIndex[wn.ID]
+			if !ok {
+				idx = int32(len(nodeIndex))
+				nodeIndex[wn.ID] = idx
+			}
+			nodes[i] = idx
+		}
+		ways = append(ways, rawWay{
+			nodes:   nodes,
+			access:  access,
+			highway: isHighway(way.Tags.Find("highway")),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ways) == 0 {
+		return nil, fmt.Errorf("no routable ways found in %s", path)
+	}
+
+	points := make([]geo.Point, len(nodeIndex))
+	found := make([]bool, len(nodeIndex))
+	err = scanPBF(path, false, true, func(obj osm.Object) {
+		node, ok := obj.(*osm.Node)
+		if !ok {
+			return
+		}
+		if idx, ok := nodeIndex[node.ID]; ok {
+			points[idx] = geo.Point{Lat: node.Lat, Lng: node.Lon}
+			found[idx] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return buildGraph(points, found, ways), nil
+}
+
+// scanPBF calls fn for every node or way in the file
+func scanPBF(path string, skipNodes, skipWays bool, fn func(osm.Object)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open OSM extract: %v", err)
+	}
+	defer f.Close()
+
+	scanner := osmpbf.New(context.Background(), f, runtime.GOMAXPROCS(0))
+	defer scanner.Close()
+
+	scanner.SkipNodes = skipNodes
+	scanner.SkipWays = skipWays
+	scanner.SkipRelations = true
+
+	for scanner.Scan() {
+		fn(scanner.Object())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read OSM extract: %v", err)
+	}
+	return nil
+}
+
+// buildGraph converts raw ways into a compressed adjacency list
+func buildGraph(points []geo.Point, found []bool, ways []rawWay) *Graph {
+	type pending struct {
+		from int32
+		edge edge
+	}
+	var all []pending
+
+	for _, way := range ways {
+		for i := 0; i+1 < len(way.nodes); i++ {
+			a, b := way.nodes[i], way.nodes[i+1]
+			if !found[a] || !found[b] {
+				continue
+			}
+			length := float32(geo.Haversine(points[a], points[b]))
+
+			forward := edge{to: b, length: length, highway: way.highway}
+			backward := edge{to: a, length: length, highway: way.highway}
+			var hasForward, hasBackward bool
+			for p, access := range way.access {
+				if access.forward {
+					forward.speeds[p] = float32(access.speed)
+					hasForward = true
+				}
+				if access.backward {
+					backward.speeds[p] = float32(access.speed)
+					hasBackward = true
+				}
+			}
+			if hasForward {
+				all = append(all, pending{from: a, edge: forward})
+			}
+			if hasBackward {
+				all = append(all, pending{from: b, edge: backward})
+			}
+		}
+	}
+
+	g := &Graph{
+		points:  points,
+		offsets: make([]int32, len(points)+1),
+		edges:   make([]edge, len(all)),
+	}
+
+	for _, p := range all {
+		g.offsets[p.from+1]++
+	}
+	for i := 1; i < len(g.offsets); i++ {
+		g.offsets[i] += g.offsets[i-1]
+	}
+	next := make([]int32, len(points))
+	copy(next, g.offsets[:len(points)])
+	for _, p := range all {
+		g.edges[next[p.from]] = p.edge
+		next[p.from]++
+	}
+
+	// Index nodes that can be left by each profile so queries snap to usable roads
+	for p := Profile(0); p < profileCount; p++ {
+		idx := newGridIndex()
+		for node := range points {
+			for _, e := range g.outgoing(int32(node)) {
+				if e.speeds[p] > 0 {
+					idx.insert(int32(node), points[node])
+					break
+				}
+			}
+		}
+		g.index[p] = idx
+	}
+
+	return g
+}
+
+// NodeCount returns the number of nodes in the graph
+func (g *Graph) NodeCount() int {
+	return len(g.points)
+}
+
+// outgoing returns the edges leaving a node
+func (g *Graph) outgoing(node int32) []edge {
+	return g.edges[g.offsets[node]:g.offsets[node+1]]
+}
+
+// gridCellDegrees is the size of a spatial index cell
+const gridCellDegrees = 0.01
+
+// gridIndex is a uniform grid used to find the nearest graph node
+type gridIndex struct {
+	cells  map[[2]int32][]int32
+	points map[int32]geo.Point
+}
+
+func newGridIndex() *gridIndex {
+	return &gridIndex{
+		cells:  make(map[[2]int32][]int32),
+		points: make(map[int32]geo.Point),
+	}
+}
+
+func cellOf(p geo.Point) [2]int32 {
+	return [2]int32{
+		int32(math.Floor(p.Lat / gridCellDegrees)),
+		int32(math.Floor(p.Lng / gridCellDegrees)),
+	}
+}
+
+func (gi *gridIndex) insert(node int32, p geo.Point) {
+	cell := cellOf(p)
+	gi.cells[cell] = append(gi.cells[cell], node)
+	gi.points[node] = p
+}
+
+// nearest returns the closest node within maxRings cells of p
+func (gi *gridIndex) nearest(p geo.Point, maxRings int32) (int32, float64, bool) {
+	center := cellOf(p)
+	best := int32(-1)
+	bestDist := math.Inf(1)
+
+	for ring := int32(0); ring <= maxRings; ring++ {
+		for dLat := -ring; dLat <= ring; dLat++ {
+			for dLng := -ring; dLng <= ring; dLng++ {
+				if abs32(dLat) != ring && abs32(dLng) != ring {
+					continue // only visit the outer ring
+				}
+				for _, node := range gi.cells[[2]int32{center[0] + dLat, center[1] + dLng}] {
+					if d := geo.Haversine(p, gi.points[node]); d < bestDist {
+						best, bestDist = node, d
+					}
+				}
+			}
+		}
+		// Any node further out is at least one full ring away
+		if best >= 0 && bestDist < float64(ring)*gridCellDegrees*111000*math.Cos(p.Lat*math.Pi/180) {
+			break
+		}
+	}
+
+	return best, bestDist, best >= 0
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
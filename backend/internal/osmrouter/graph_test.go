@@ -0,0 +1,126 @@
+package osmrouter
+
+import (
+	"greenroute/internal/geo"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+// Nodes of the test graph: A, B and C lie on a residential street with a
+// trunk road alongside A-B, the motorway bypasses B through D one way, and
+// G-H is a street of its own. Node M is never found in the extract.
+const (
+	nodeA int32 = iota
+	nodeB
+	nodeC
+	nodeD
+	nodeG
+	nodeH
+	nodeM
+)
+
+var testPoints = []geo.Point{
+	nodeA: {Lat: 0, Lng: 0},
+	nodeB: {Lat: 0, Lng: 0.01},
+	nodeC: {Lat: 0, Lng: 0.02},
+	nodeD: {Lat: 0.004, Lng: 0.01},
+	nodeG: {Lat: 0.03, Lng: 0},
+	nodeH: {Lat: 0.03, Lng: 0.001},
+	nodeM: {Lat: 0.05, Lng: 0.05},
+}
+
+// testWay is a way of a highway type through nodes, with extra tags
+func testWay(highway string, nodes []int32, tags ...osm.Tag) rawWay {
+	tags = append(tags, osm.Tag{Key: "highway", Value: highway})
+	return rawWay{
+		nodes:   nodes,
+		access:  evaluateWay(osm.Tags(tags)),
+		highway: isHighway(highway),
+	}
+}
+
+// testGraph builds the test graph
+func testGraph() *Graph {
+	found := make([]bool, len(testPoints))
+	for i := range found {
+		found[i] = i != int(nodeM)
+	}
+	ways := []rawWay{
+		testWay("residential", []int32{nodeA, nodeB, nodeC}),
+		testWay("trunk", []int32{nodeA, nodeB}),
+		testWay("motorway", []int32{nodeA, nodeD, nodeC}),
+		testWay("residential", []int32{nodeG, nodeH, nodeM}),
+	}
+	return buildGraph(testPoints, found, ways)
+}
+
+func TestBuildGraph(t *testing.T) {
+	g := testGraph()
+	if g.NodeCount() != len(testPoints) {
+		t.Fatalf("NodeCount = %d, want %d", g.NodeCount(), len(testPoints))
+	}
+
+	type link struct {
+		to      int32
+		speeds  [profileCount]float32
+		highway bool
+	}
+	residential := [profileCount]float32{30, bicycleSpeed, footSpeed}
+	tests := []struct {
+		node  int32
+		edges []link
+	}{
+		{node: nodeA, edges: []link{
+			{to: nodeB, speeds: residential},
+			{to: nodeB, speeds: [profileCount]float32{90, bicycleSpeed, 0}, highway: true},
+			{to: nodeD, speeds: [profileCount]float32{110, 0, 0}, highway: true},
+		}},
+		{node: nodeB, edges: []link{
+			{to: nodeA, speeds: residential},
+			{to: nodeC, speeds: residential},
+			{to: nodeA, speeds: [profileCount]float32{90, bicycleSpeed, 0}, highway: true},
+		}},
+		// The motorway is one way, so only C's residential street leads back
+		{node: nodeC, edges: []link{{to: nodeB, speeds: residential}}},
+		{node: nodeD, edges: []link{{to: nodeC, speeds: [profileCount]float32{110, 0, 0}, highway: true}}},
+		// The segment to M is dropped since M has no coordinates
+		{node: nodeH, edges: []link{{to: nodeG, speeds: residential}}},
+		{node: nodeM},
+	}
+	for _, tt := range tests {
+		edges := g.outgoing(tt.node)
+		if len(edges) != len(tt.edges) {
+			t.Errorf("node %d has %d edges, want %d", tt.node, len(edges), len(tt.edges))
+			continue
+		}
+		for i, e := range edges {
+			want := tt.edges[i]
+			if e.to != want.to || e.speeds != want.speeds || e.highway != want.highway {
+				t.Errorf("node %d edge %d = to %d at %v, highway %v; want to %d at %v, highway %v",
+					tt.node, i, e.to, e.speeds, e.highway, want.to, want.speeds, want.highway)
+			}
+			length := geo.Haversine(testPoints[tt.node], testPoints[e.to])
+			if float64(e.length) != float64(float32(length)) {
+				t.Errorf("node %d edge %d length = %v, want %v", tt.node, i, e.length, length)
+			}
+		}
+	}
+
+	// Nodes are indexed for the profiles that can leave them
+	indexed := map[Profile][]int32{
+		ProfileCar:     {nodeA, nodeB, nodeC, nodeD, nodeG, nodeH},
+		ProfileBicycle: {nodeA, nodeB, nodeC, nodeG, nodeH},
+		ProfileFoot:    {nodeA, nodeB, nodeC, nodeG, nodeH},
+	}
+	for profile, nodes := range indexed {
+		if len(g.index[profile].points) != len(nodes) {
+			t.Errorf("%v index has %d nodes, want %d", profile, len(g.index[profile].points), len(nodes))
+		}
+		for _, node := range nodes {
+			if _, ok := g.index[profile].points[node]; !ok {
+				t.Errorf("%v index is missing node %d", profile, node)
+			}
+		}
+	}
+}
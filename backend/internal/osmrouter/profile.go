@@ -0,0 +1,209 @@
+package osmrouter
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+// Profile identifies a travel profile with its own access rules and speeds
+type Profile int
+
+const (
+	ProfileCar Profile = iota
+	ProfileBicycle
+	ProfileFoot
+
+	profileCount = 3
+)
+
+// String returns the profile name
+func (p Profile) String() string {
+	switch p {
+	case ProfileCar:
+		return "car"
+	case ProfileBicycle:
+		return "bicycle"
+	case ProfileFoot:
+		return "foot"
+	default:
+		return "unknown"
+	}
+}
+
+// Metric selects the edge weight minimised by a search
+type Metric int
+
+const (
+	// Fastest minimises travel time
+	Fastest Metric = iota
+	// Shortest minimises travel distance
+	Shortest
+)
+
+// Default speeds in km/h for cars by highway type
+var carSpeeds = map[string]float64{
+	"motorway":       110,
+	"motorway_link":  60,
+	"trunk":          90,
+	"trunk_link":     50,
+	"primary":        65,
+	"primary_link":   40,
+	"secondary":      55,
+	"secondary_link": 40,
+	"tertiary":       45,
+	"tertiary_link":  30,
+	"unclassified":   35,
+	"residential":    30,
+	"living_street":  10,
+	"service":        15,
+	"road":           30,
+}
+
+// Highway types usable by bicycles in addition to the car network
+var bicycleHighways = map[string]bool{
+	"cycleway": true,
+	"path":     true,
+	"track":    true,
+}
+
+// Highway types usable on foot in addition to the car network
+var footHighways = map[string]bool{
+	"footway":    true,
+	"pedestrian": true,
+	"path":       true,
+	"steps":      true,
+	"track":      true,
+	"cycleway":   true,
+}
+
+const (
+	bicycleSpeed = 16.0 // km/h
+	footSpeed    = 5.0  // km/h
+
+	// maxCarSpeed caps car speeds so the A* heuristic stays admissible
+	maxCarSpeed = 130.0
+)
+
+// wayAccess describes how a profile may traverse a way
+type wayAccess struct {
+	forward  bool
+	backward bool
+	speed    float64 // km/h
+}
+
+// evaluateWay returns the access rules of a way for every profile
+func evaluateWay(tags osm.Tags) [profileCount]wayAccess {
+	var result [profileCount]wayAccess
+
+	highway := tags.Find("highway")
+	if highway == "" || tags.Find("area") == "yes" {
+		return result
+	}
+	access := tags.Find("access")
+	restricted := access == "no" || access == "private"
+
+	oneway := tags.Find("oneway")
+	forwardOnly := oneway == "yes" || oneway == "1" || oneway == "true" ||
+		tags.Find("junction") == "roundabout" || highway == "motorway"
+	backwardOnly := oneway == "-1"
+
+	// Cars
+	if speed, ok := carSpeeds[highway]; ok && allowed(tags, restricted, "motor_vehicle", "motorcar") {
+		if maxspeed := parseMaxSpeed(tags.Find("maxspeed")); maxspeed > 0 {
+			speed = math.Min(maxspeed, maxCarSpeed)
+		}
+		result[ProfileCar] = directional(speed, forwardOnly, backwardOnly)
+	}
+
+	// Bicycles
+	_, carRoad := carSpeeds[highway]
+	bikeRoad := (carRoad && highway != "motorway" && highway != "motorway_link") || bicycleHighways[highway]
+	bicycleTag := tags.Find("bicycle")
+	if bicycleTag == "yes" || bicycleTag == "designated" {
+		bikeRoad = highway != "motorway" && highway != "motorway_link"
+	}
+	if bikeRoad && allowed(tags, restricted, "bicycle") {
+		if tags.Find("oneway:bicycle") == "no" {
+			result[ProfileBicycle] = directional(bicycleSpeed, false, false)
+		} else {
+			result[ProfileBicycle] = directional(bicycleSpeed, forwardOnly, backwardOnly)
+		}
+	}
+
+	// Pedestrians ignore one-way restrictions
+	footRoad := (carRoad && highway != "motorway" && highway != "motorway_link" &&
+		highway != "trunk" && highway != "trunk_link") || footHighways[highway]
+	if footTag := tags.Find("foot"); footTag == "yes" || footTag == "designated" {
+		footRoad = highway != "motorway" && highway != "motorway_link"
+	}
+	if footRoad && allowed(tags, restricted, "foot") {
+		result[ProfileFoot] = directional(footSpeed, false, false)
+	}
+
+	return result
+}
+
+// isHighway reports whether a highway type counts as a highway for avoidance
+func isHighway(highway string) bool {
+	switch highway {
+	case "motorway", "motorway_link", "trunk", "trunk_link":
+		return true
+	}
+	return false
+}
+
+// allowed reports whether the mode-specific access tags permit travel
+func allowed(tags osm.Tags, restricted bool, keys ...string) bool {
+	for _, key := range keys {
+		switch tags.Find(key) {
+		case "no", "private", "use_sidepath":
+			return false
+		case "yes", "designated", "permissive", "destination":
+			return true
+		}
+	}
+	return !restricted
+}
+
+func directional(speed float64, forwardOnly, backwardOnly bool) wayAccess {
+	return wayAccess{
+		forward:  !backwardOnly,
+		backward: !forwardOnly,
+		speed:    speed,
+	}
+}
+
+// parseMaxSpeed parses an OSM maxspeed value such as "50" or "30 mph" into km/h
+func parseMaxSpeed(value string) float64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	factor := 1.0
+	if strings.HasSuffix(value, "mph") {
+		factor = 1.609344
+		value = strings.TrimSpace(strings.TrimSuffix(value, "mph"))
+	}
+
+	speed, err := strconv.ParseFloat(value, 64)
+	if err != nil || speed <= 0 {
+		return 0
+	}
+	return speed * factor
+}
+
+// maxSpeed returns the highest speed a profile can reach in km/h
+func maxSpeed(profile Profile) float64 {
+	switch profile {
+	case ProfileCar:
+		return maxCarSpeed
+	case ProfileBicycle:
+		return bicycleSpeed
+	default:
+		return footSpeed
+	}
+}
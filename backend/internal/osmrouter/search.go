@@ -0,0 +1,163 @@
+package osmrouter
+
+import (
+	"container/heap"
+	"errors"
+	"greenroute/internal/geo"
+	"math"
+	"time"
+)
+
+// maxSnapRings limits how far (in grid cells) a query point may be from the road network
+const maxSnapRings = 5
+
+// ErrNoRoute is returned when the destination cannot be reached
+var ErrNoRoute = errors.New("no route found")
+
+// Path is the result of a shortest or fastest path query
+type Path struct {
+	Points   []geo.Point
+	Distance float64 // in meters
+	Duration time.Duration
+}
+
+// Options controls a path query
+type Options struct {
+	Metric        Metric
+	AvoidHighways bool
+}
+
+// Route finds a path between two points for a profile using A* search
+func (g *Graph) Route(from, to geo.Point, profile Profile, opts Options) (*Path, error) {
+	if profile < 0 || profile >= profileCount {
+		return nil, errors.New("unknown routing profile")
+	}
+
+	source, _, ok := g.index[profile].nearest(from, maxSnapRings)
+	if !ok {
+		return nil, errors.New("origin is too far from the road network")
+	}
+	target, _, ok := g.index[profile].nearest(to, maxSnapRings)
+	if !ok {
+		return nil, errors.New("destination is too far from the road network")
+	}
+
+	// Costs are seconds for Fastest and meters for Shortest
+	speedLimit := maxSpeed(profile) / 3.6 // m/s
+	heuristic := func(node int32) float64 {
+		d := geo.Haversine(g.points[node], g.points[target])
+		if opts.Metric == Shortest {
+			return d
+		}
+		return d / speedLimit
+	}
+
+	cost := map[int32]float64{source: 0}
+	prev := map[int32]int32{}
+	closed := map[int32]bool{}
+
+	queue := &nodeQueue{{node: source, priority: heuristic(source)}}
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(queueItem).node
+		if current == target {
+			return g.buildPath(source, target, prev, profile, opts), nil
+		}
+		if closed[current] {
+			continue
+		}
+		closed[current] = true
+
+		for _, e := range g.outgoing(current) {
+			weight, ok := edgeWeight(e, profile, opts)
+			if !ok || closed[e.to] {
+				continue
+			}
+
+			next := cost[current] + weight
+			if known, ok := cost[e.to]; ok && known <= next {
+				continue
+			}
+			cost[e.to] = next
+			prev[e.to] = current
+			heap.Push(queue, queueItem{node: e.to, priority: next + heuristic(e.to)})
+		}
+	}
+
+	return nil, ErrNoRoute
+}
+
+// edgeWeight returns the cost of an edge for a search, or false if the search
+// may not use it
+func edgeWeight(e edge, profile Profile, opts Options) (float64, bool) {
+	speed := e.speeds[profile]
+	if speed <= 0 || (opts.AvoidHighways && e.highway) {
+		return 0, false
+	}
+	weight := float64(e.length)
+	if opts.Metric == Fastest {
+		weight /= float64(speed) / 3.6
+	}
+	return weight, true
+}
+
+// buildPath walks the predecessor map back from target and sums edge costs
+func (g *Graph) buildPath(source, target int32, prev map[int32]int32, profile Profile, opts Options) *Path {
+	nodes := []int32{target}
+	for node := target; node != source; {
+		node = prev[node]
+		nodes = append(nodes, node)
+	}
+
+	path := &Path{Points: make([]geo.Point, len(nodes))}
+	var seconds float64
+	for i := range nodes {
+		node := nodes[len(nodes)-1-i]
+		path.Points[i] = g.points[node]
+		if i == 0 {
+			continue
+		}
+		from := nodes[len(nodes)-i]
+		e := g.cheapestEdge(from, node, profile, opts)
+		path.Distance += float64(e.length)
+		seconds += float64(e.length) / (float64(e.speeds[profile]) / 3.6)
+	}
+	path.Duration = time.Duration(math.Round(seconds)) * time.Second
+
+	return path
+}
+
+// cheapestEdge returns the edge between two adjacent nodes that the search
+// relaxed: the cheapest one its options allow
+func (g *Graph) cheapestEdge(from, to int32, profile Profile, opts Options) edge {
+	var best edge
+	bestWeight := math.Inf(1)
+	for _, e := range g.outgoing(from) {
+		if e.to != to {
+			continue
+		}
+		if weight, ok := edgeWeight(e, profile, opts); ok && weight < bestWeight {
+			best, bestWeight = e, weight
+		}
+	}
+	return best
+}
+
+// queueItem is a node in the A* open set
+type queueItem struct {
+	node     int32
+	priority float64
+}
+
+// nodeQueue implements heap.Interface as a min-heap on priority
+type nodeQueue []queueItem
+
+func (q nodeQueue) Len() int            { return len(q) }
+func (q nodeQueue) Less(i, j int) bool  { return q[i].priority < q[j].priority }
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(queueItem)) }
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
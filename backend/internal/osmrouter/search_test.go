@@ -0,0 +1,165 @@
+package osmrouter
+
+import (
+	"errors"
+	"greenroute/internal/geo"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRoute(t *testing.T) {
+	g := testGraph()
+
+	// expect is the path through nodes, at speeds in km/h for each leg or one for all
+	expect := func(nodes []int32, speeds ...float64) *Path {
+		path := &Path{}
+		var seconds float64
+		for i, node := range nodes {
+			path.Points = append(path.Points, testPoints[node])
+			if i > 0 {
+				speed := speeds[0]
+				if len(speeds) > 1 {
+					speed = speeds[i-1]
+				}
+				length := float64(float32(geo.Haversine(testPoints[nodes[i-1]], testPoints[node])))
+				path.Distance += length
+				seconds += length / (speed / 3.6)
+			}
+		}
+		path.Duration = time.Duration(math.Round(seconds)) * time.Second
+		return path
+	}
+
+	tests := []struct {
+		name     string
+		from, to geo.Point
+		profile  Profile
+		opts     Options
+		want     *Path
+		err      error
+	}{
+		{
+			name:    "fastest takes the motorway",
+			from:    testPoints[nodeA],
+			to:      testPoints[nodeC],
+			profile: ProfileCar,
+			want:    expect([]int32{nodeA, nodeD, nodeC}, 110),
+		},
+		{
+			// The motorway is one way, so the way back takes the trunk from B
+			name:    "one way motorway",
+			from:    testPoints[nodeC],
+			to:      testPoints[nodeA],
+			profile: ProfileCar,
+			want:    expect([]int32{nodeC, nodeB, nodeA}, 30, 90),
+		},
+		{
+			// The trunk beside A-B is faster but not allowed
+			name:    "avoid highways",
+			from:    testPoints[nodeA],
+			to:      testPoints[nodeC],
+			profile: ProfileCar,
+			opts:    Options{AvoidHighways: true},
+			want:    expect([]int32{nodeA, nodeB, nodeC}, 30),
+		},
+		{
+			name:    "avoid highways on a road next to a highway",
+			from:    testPoints[nodeA],
+			to:      testPoints[nodeB],
+			profile: ProfileCar,
+			opts:    Options{AvoidHighways: true},
+			want:    expect([]int32{nodeA, nodeB}, 30),
+		},
+		{
+			name:    "fastest next to a slower road",
+			from:    testPoints[nodeA],
+			to:      testPoints[nodeB],
+			profile: ProfileCar,
+			want:    expect([]int32{nodeA, nodeB}, 90),
+		},
+		{
+			name:    "cycling stays off the motorway",
+			from:    testPoints[nodeA],
+			to:      testPoints[nodeC],
+			profile: ProfileBicycle,
+			want:    expect([]int32{nodeA, nodeB, nodeC}, bicycleSpeed),
+		},
+		{
+			// D is only on the motorway, so walking starts from the nearest footway node
+			name:    "walking snaps to a walkable node",
+			from:    testPoints[nodeD],
+			to:      testPoints[nodeC],
+			profile: ProfileFoot,
+			want:    expect([]int32{nodeB, nodeC}, footSpeed),
+		},
+		{
+			name:    "disconnected street",
+			from:    testPoints[nodeA],
+			to:      testPoints[nodeG],
+			profile: ProfileCar,
+			err:     ErrNoRoute,
+		},
+		{
+			name:    "origin off the network",
+			from:    geo.Point{Lat: 1, Lng: 1},
+			to:      testPoints[nodeC],
+			profile: ProfileCar,
+			err:     errors.New("origin is too far from the road network"),
+		},
+		{
+			name:    "unknown profile",
+			from:    testPoints[nodeA],
+			to:      testPoints[nodeC],
+			profile: profileCount,
+			err:     errors.New("unknown routing profile"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := g.Route(tt.from, tt.to, tt.profile, tt.opts)
+			if tt.err != nil {
+				if err == nil || err.Error() != tt.err.Error() {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Route: %v", err)
+			}
+			if !reflect.DeepEqual(path.Points, tt.want.Points) {
+				t.Errorf("points = %v, want %v", path.Points, tt.want.Points)
+			}
+			if math.Abs(path.Distance-tt.want.Distance) > 1e-6 || path.Duration != tt.want.Duration {
+				t.Errorf("path of %.1f m in %v, want %.1f m in %v",
+					path.Distance, path.Duration, tt.want.Distance, tt.want.Duration)
+			}
+		})
+	}
+}
+
+func TestRouteShortest(t *testing.T) {
+	g := testGraph()
+
+	// The street through B is shorter than the motorway through D but slower
+	fastest, err := g.Route(testPoints[nodeA], testPoints[nodeC], ProfileCar, Options{Metric: Fastest})
+	if err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	shortest, err := g.Route(testPoints[nodeA], testPoints[nodeC], ProfileCar, Options{Metric: Shortest})
+	if err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+
+	want := []geo.Point{testPoints[nodeA], testPoints[nodeB], testPoints[nodeC]}
+	if !reflect.DeepEqual(shortest.Points, want) {
+		t.Errorf("shortest points = %v, want %v", shortest.Points, want)
+	}
+	if shortest.Distance >= fastest.Distance {
+		t.Errorf("shortest path of %.1f m is not shorter than the fastest of %.1f m", shortest.Distance, fastest.Distance)
+	}
+	if shortest.Duration <= fastest.Duration {
+		t.Errorf("shortest path in %v is not slower than the fastest in %v", shortest.Duration, fastest.Duration)
+	}
+}
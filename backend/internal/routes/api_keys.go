@@ -0,0 +1,170 @@
+package routes
+
+import (
+	"errors"
+	"greenroute/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler handles HTTP requests for managing API keys
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new instance of APIKeyHandler
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// RegisterRoutes registers all API key endpoints
+func (h *APIKeyHandler) RegisterRoutes(router *gin.Engine) {
+	v1 := router.Group("/api/v1", RequireUser())
+	{
+		v1.GET("/api-keys", h.ListKeys)
+		v1.POST("/api-keys", h.CreateKey)
+		v1.DELETE("/api-keys/:id", h.RevokeKey)
+		v1.GET("/api-keys/:id/usage", h.Usage)
+	}
+}
+
+// CreateAPIKeyRequest represents the incoming request to create an API key.
+// Limits are capped by the server configuration; zero selects the maximum.
+type CreateAPIKeyRequest struct {
+	Name               string `json:"name" binding:"required"`
+	RateLimitPerMinute int    `json:"rate_limit_per_minute"`
+	MonthlyQuota       int    `json:"monthly_quota"`
+}
+
+// ListKeys returns the caller's API keys
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	userID, _ := CurrentUserID(c)
+
+	keys, err := h.apiKeyService.ListKeys(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateKey creates an API key and returns its secret once
+func (h *APIKeyHandler) CreateKey(c *gin.Context) {
+	userID, _ := CurrentUserID(c)
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, secret, err := h.apiKeyService.CreateKey(c.Request.Context(), userID, req.Name, req.RateLimitPerMinute, req.MonthlyQuota)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"key":    key,
+		"secret": secret,
+	})
+}
+
+// RevokeKey revokes one of the caller's API keys
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	userID, _ := CurrentUserID(c)
+	keyID, ok := apiKeyIDParam(c)
+	if !ok {
+		return
+	}
+
+	err := h.apiKeyService.RevokeKey(c.Request.Context(), userID, keyID)
+	if errors.Is(err, services.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Usage returns the monthly request counts of one of the caller's API keys
+func (h *APIKeyHandler) Usage(c *gin.Context) {
+	userID, _ := CurrentUserID(c)
+	keyID, ok := apiKeyIDParam(c)
+	if !ok {
+		return
+	}
+
+	usage, err := h.apiKeyService.Usage(c.Request.Context(), userID, keyID)
+	if errors.Is(err, services.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+func apiKeyIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid API key ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// AuthenticateAPIKey authenticates requests carrying an X-API-Key header,
+// enforcing the key's rate limit and monthly quota, and attributes them to the
+// key's owner. Requests without a key from a signed-in user are held to the
+// default user rate limit, and anonymous requests are limited per IP address
+// unless anonymous routing is disabled.
+func AuthenticateAPIKey(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		secret := c.GetHeader("X-API-Key")
+
+		var userID uint
+		var err error
+		if secret != "" {
+			userID, err = apiKeyService.Authorize(ctx, secret)
+		} else if id, ok := CurrentUserID(c); ok {
+			userID, err = id, apiKeyService.AuthorizeUser(ctx, id)
+		} else {
+			err = apiKeyService.AuthorizeAnonymous(ctx, c.ClientIP())
+		}
+
+		switch {
+		case errors.Is(err, services.ErrInvalidAPIKey), errors.Is(err, services.ErrCallerRequired):
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, services.ErrRateLimited):
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, services.ErrQuotaExceeded):
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if userID != 0 {
+			c.Set(userIDKey, userID)
+		}
+		c.Next()
+	}
+}
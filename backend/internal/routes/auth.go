@@ -0,0 +1,217 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"greenroute/internal/auth"
+	"greenroute/internal/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// userIDKey is the gin context key of the authenticated user's ID
+	userIDKey = "userID"
+	// maxPasswordBytes is the longest password bcrypt uses in full
+	maxPasswordBytes = 72
+)
+
+// AuthHandler handles HTTP requests for registration and login
+type AuthHandler struct {
+	authService *services.AuthService
+}
+
+// NewAuthHandler creates a new instance of AuthHandler
+func NewAuthHandler(authService *services.AuthService) *AuthHandler {
+	return &AuthHandler{
+		authService: authService,
+	}
+}
+
+// RegisterRoutes registers all authentication endpoints
+func (h *AuthHandler) RegisterRoutes(router *gin.Engine) {
+	v1 := router.Group("/api/v1")
+	{
+		v1.POST("/auth/register", h.Register)
+		v1.POST("/auth/login", h.Login)
+		v1.POST("/auth/refresh", h.Refresh)
+		v1.GET("/auth/me", RequireUser(), h.Me)
+	}
+}
+
+// RegisterRequest represents the incoming request to create an account
+type RegisterRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Name     string `json:"name" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"` // at most maxPasswordBytes
+}
+
+// LoginRequest represents the incoming request to sign in
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// RefreshRequest represents the incoming request to renew tokens
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Register creates an account and returns its tokens
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// The binding counts characters, but bcrypt uses at most 72 bytes
+	if len(req.Password) > maxPasswordBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("password must be at most %d bytes", maxPasswordBytes)})
+		return
+	}
+
+	session, err := h.authService.Register(c.Request.Context(), req.Email, req.Name, req.Password)
+	if errors.Is(err, services.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, session)
+}
+
+// Login checks credentials and returns new tokens
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := h.authService.Login(c.Request.Context(), req.Email, req.Password)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// Refresh exchanges a refresh token for a new token pair
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := h.authService.Refresh(c.Request.Context(), req.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// Me returns the authenticated user
+func (h *AuthHandler) Me(c *gin.Context) {
+	userID, _ := CurrentUserID(c)
+
+	user, err := h.authService.GetUser(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// Authenticate verifies a bearer access token and puts its user into the
+// context. Requests without a token continue anonymously; requests with an
+// invalid token are rejected.
+func Authenticate(tokens *auth.TokenManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "expected a bearer token"})
+			return
+		}
+
+		userID, err := tokens.VerifyAccess(strings.TrimSpace(token))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(userIDKey, userID)
+		c.Next()
+	}
+}
+
+// RequireUser rejects requests that Authenticate did not attach a user to
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := CurrentUserID(c); !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUserID returns the authenticated user's ID, if any
+func CurrentUserID(c *gin.Context) (uint, bool) {
+	userID, ok := c.Get(userIDKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := userID.(uint)
+	return id, ok
+}
+
+// userIDParam resolves the userId path parameter, which may be "me", and
+// responds with 400 or 403 unless it is the authenticated user
+func userIDParam(c *gin.Context) (uint, bool) {
+	caller, ok := CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return 0, false
+	}
+
+	param := c.Param("userId")
+	if param == "me" {
+		return caller, true
+	}
+
+	userID, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return 0, false
+	}
+	if uint(userID) != caller {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access to another user's data is not allowed"})
+		return 0, false
+	}
+	return caller, true
+}
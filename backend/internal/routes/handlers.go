@@ -1,22 +1,36 @@
 package routes
 
 import (
+	"errors"
+	"fmt"
+	"greenroute/internal/database"
 	"greenroute/internal/models"
 	"greenroute/internal/services"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // RouteHandler handles HTTP requests for route calculations
 type RouteHandler struct {
-	routeService *services.RouteService
+	routeService      *services.RouteService
+	preferenceService *services.PreferenceService
+	apiKeyService     *services.APIKeyService
 }
 
 // NewRouteHandler creates a new instance of RouteHandler
-func NewRouteHandler(routeService *services.RouteService) *RouteHandler {
+func NewRouteHandler(
+	routeService *services.RouteService,
+	preferenceService *services.PreferenceService,
+	apiKeyService *services.APIKeyService,
+) *RouteHandler {
 	return &RouteHandler{
-		routeService: routeService,
+		routeService:      routeService,
+		preferenceService: preferenceService,
+		apiKeyService:     apiKeyService,
 	}
 }
 
@@ -24,16 +38,28 @@ func NewRouteHandler(routeService *services.RouteService) *RouteHandler {
 func (h *RouteHandler) RegisterRoutes(router *gin.Engine) {
 	v1 := router.Group("/api/v1")
 	{
-		v1.POST("/routes/calculate", h.CalculateRoute)
+		v1.POST("/routes/calculate", AuthenticateAPIKey(h.apiKeyService), h.CalculateRoute)
+		v1.POST("/routes/departure", AuthenticateAPIKey(h.apiKeyService), h.PlanDeparture)
 		v1.GET("/routes/:id", h.GetRoute)
+		v1.GET("/routes/user/:userId", RequireUser(), h.GetUserRoutes)
 	}
 }
 
-// RouteRequest represents the incoming request for route calculation
+// RouteRequest represents the incoming request for route calculation. Without
+// preferences, the named profile or else the caller's default profile is used.
 type RouteRequest struct {
-	StartLocation models.Location         `json:"start_location" binding:"required"`
-	EndLocation   models.Location         `json:"end_location" binding:"required"`
-	Preferences   models.RoutePreferences `json:"preferences"`
+	StartLocation models.Location          `json:"start_location" binding:"required"`
+	EndLocation   models.Location          `json:"end_location" binding:"required"`
+	Preferences   *models.RoutePreferences `json:"preferences,omitempty"`
+	Profile       string                   `json:"profile,omitempty"`
+	DepartureTime *time.Time               `json:"departure_time,omitempty"` // defaults to now
+	ArriveBy      *time.Time               `json:"arrive_by,omitempty"`      // instead of a departure time
+}
+
+// DepartureRequest asks for the best time to leave within a window
+type DepartureRequest struct {
+	RouteRequest
+	Window models.DepartureWindow `json:"window"`
 }
 
 // CalculateRoute handles the route calculation request
@@ -44,11 +70,36 @@ func (h *RouteHandler) CalculateRoute(c *gin.Context) {
 		return
 	}
 
+	if req.DepartureTime != nil && req.ArriveBy != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "departure_time and arrive_by cannot both be set"})
+		return
+	}
+
+	prefs, userID, ok := h.resolveRequest(c, req)
+	if !ok {
+		return
+	}
+
+	var when services.TripTime
+	if req.DepartureTime != nil {
+		when.Departure = *req.DepartureTime
+	}
+	if req.ArriveBy != nil {
+		when.ArriveBy = *req.ArriveBy
+	}
+
 	route, err := h.routeService.CalculateRoute(
+		c.Request.Context(),
 		req.StartLocation,
 		req.EndLocation,
-		req.Preferences,
+		prefs,
+		userID,
+		when,
 	)
+	if errors.Is(err, services.ErrNoRouteArrivesInTime) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -57,9 +108,211 @@ func (h *RouteHandler) CalculateRoute(c *gin.Context) {
 	c.JSON(http.StatusOK, route)
 }
 
-// GetRoute retrieves a previously calculated route
+// PlanDeparture recommends when to leave within a window and returns the
+// route for that departure with the predictions for every departure tried
+func (h *RouteHandler) PlanDeparture(c *gin.Context) {
+	var req DepartureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.DepartureTime != nil || req.ArriveBy != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "use the window instead of departure_time or arrive_by"})
+		return
+	}
+
+	prefs, userID, ok := h.resolveRequest(c, req.RouteRequest)
+	if !ok {
+		return
+	}
+
+	plan, err := h.routeService.PlanDeparture(
+		c.Request.Context(),
+		req.StartLocation,
+		req.EndLocation,
+		prefs,
+		userID,
+		req.Window,
+	)
+	if errors.Is(err, services.ErrInvalidDepartureWindow) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrNoDepartureInWindow) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// resolveRequest returns the preferences of a route request and the ID of the
+// user to link the routes to, empty for anonymous requests. It writes the
+// error response and returns false if the preferences cannot be resolved.
+func (h *RouteHandler) resolveRequest(c *gin.Context, req RouteRequest) (models.RoutePreferences, string, bool) {
+	// Anonymous requests are calculated but not linked to a user
+	callerID, authenticated := CurrentUserID(c)
+
+	prefs, err := h.preferenceService.ResolvePreferences(c.Request.Context(), callerID, req.Profile, req.Preferences)
+	if errors.Is(err, services.ErrProfileRequiresUser) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return models.RoutePreferences{}, "", false
+	}
+	if errors.Is(err, services.ErrProfileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return models.RoutePreferences{}, "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return models.RoutePreferences{}, "", false
+	}
+
+	var userID string
+	if authenticated {
+		userID = strconv.FormatUint(uint64(callerID), 10)
+	}
+	return prefs, userID, true
+}
+
+// GetRoute retrieves a previously calculated route. Routes of signed-in users
+// are only visible to them.
 func (h *RouteHandler) GetRoute(c *gin.Context) {
 	routeID := c.Param("id")
-	// TODO: Implement route retrieval from database
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not implemented yet"})
+	callerID, _ := CurrentUserID(c)
+
+	route, err := h.routeService.GetRoute(c.Request.Context(), routeID, callerID)
+	if errors.Is(err, services.ErrRouteNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, route)
+}
+
+// GetUserRoutes returns a page of a user's route history. It accepts from and to
+// dates, repeated or comma-separated mode values, a bbox of
+// min_lng,min_lat,max_lng,max_lat, sort=date|emission, order=asc|desc, limit,
+// cursor and alternatives=true to include routes that were not ranked first.
+func (h *RouteHandler) GetUserRoutes(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	query, err := parseHistoryQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.routeService.GetUserRoutes(c.Request.Context(), userID, query)
+	if errors.Is(err, services.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// parseHistoryQuery reads the route history filters from the query string
+func parseHistoryQuery(c *gin.Context) (services.RouteHistoryQuery, error) {
+	var query services.RouteHistoryQuery
+
+	for _, param := range []string{"from", "to"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := parseHistoryTime(value)
+		if err != nil {
+			return query, fmt.Errorf("invalid %s: %v", param, err)
+		}
+		if param == "from" {
+			query.From = &t
+		} else {
+			query.To = &t
+		}
+	}
+
+	for _, value := range c.QueryArray("mode") {
+		for _, mode := range strings.Split(value, ",") {
+			if mode = strings.TrimSpace(mode); mode != "" {
+				query.Modes = append(query.Modes, models.TransportMode(mode))
+			}
+		}
+	}
+
+	if value := c.Query("bbox"); value != "" {
+		parts := strings.Split(value, ",")
+		if len(parts) != 4 {
+			return query, errors.New("bbox must be min_lng,min_lat,max_lng,max_lat")
+		}
+		var coords [4]float64
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return query, fmt.Errorf("invalid bbox: %v", err)
+			}
+			coords[i] = v
+		}
+		query.BBox = &database.BoundingBox{
+			MinLng: coords[0],
+			MinLat: coords[1],
+			MaxLng: coords[2],
+			MaxLat: coords[3],
+		}
+	}
+
+	switch sort := c.DefaultQuery("sort", "date"); sort {
+	case "date":
+		query.SortBy = database.SortByDate
+	case "emission":
+		query.SortBy = database.SortByEmission
+		query.Ascending = true // lowest emission first
+	default:
+		return query, fmt.Errorf("invalid sort %q", sort)
+	}
+
+	switch order := c.Query("order"); order {
+	case "":
+	case "asc":
+		query.Ascending = true
+	case "desc":
+		query.Ascending = false
+	default:
+		return query, fmt.Errorf("invalid order %q", order)
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return query, errors.New("limit must be a positive integer")
+		}
+		query.Limit = limit
+	}
+
+	query.Cursor = c.Query("cursor")
+	query.IncludeAlternatives = c.Query("alternatives") == "true"
+
+	return query, nil
+}
+
+// parseHistoryTime accepts RFC 3339 timestamps and plain dates
+func parseHistoryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
 }
@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"errors"
+	"greenroute/internal/models"
+	"greenroute/internal/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PreferenceHandler handles HTTP requests for route preference profiles
+type PreferenceHandler struct {
+	preferenceService *services.PreferenceService
+}
+
+// NewPreferenceHandler creates a new instance of PreferenceHandler
+func NewPreferenceHandler(preferenceService *services.PreferenceService) *PreferenceHandler {
+	return &PreferenceHandler{
+		preferenceService: preferenceService,
+	}
+}
+
+// RegisterRoutes registers all preference profile endpoints
+func (h *PreferenceHandler) RegisterRoutes(router *gin.Engine) {
+	v1 := router.Group("/api/v1", RequireUser())
+	{
+		v1.GET("/users/:userId/preferences", h.ListProfiles)
+		v1.POST("/users/:userId/preferences", h.CreateProfile)
+		v1.GET("/users/:userId/preferences/:name", h.GetProfile)
+		v1.PUT("/users/:userId/preferences/:name", h.UpdateProfile)
+		v1.DELETE("/users/:userId/preferences/:name", h.DeleteProfile)
+	}
+}
+
+// ListProfiles returns all preference profiles of a user
+func (h *PreferenceHandler) ListProfiles(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	profiles, err := h.preferenceService.ListProfiles(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profiles)
+}
+
+// GetProfile returns one preference profile
+func (h *PreferenceHandler) GetProfile(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	profile, err := h.preferenceService.GetProfile(c.Request.Context(), userID, c.Param("name"))
+	if err != nil {
+		profileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// CreateProfile saves a new preference profile
+func (h *PreferenceHandler) CreateProfile(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var profile models.PreferenceProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(profile.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	created, err := h.preferenceService.CreateProfile(c.Request.Context(), userID, profile)
+	if err != nil {
+		profileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// UpdateProfile replaces the preferences of a profile
+func (h *PreferenceHandler) UpdateProfile(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var profile models.PreferenceProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.preferenceService.UpdateProfile(c.Request.Context(), userID, c.Param("name"), profile)
+	if err != nil {
+		profileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteProfile removes a preference profile
+func (h *PreferenceHandler) DeleteProfile(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.preferenceService.DeleteProfile(c.Request.Context(), userID, c.Param("name")); err != nil {
+		profileError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// profileError maps preference service errors to HTTP responses
+func profileError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrProfileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrProfileExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"errors"
+	"greenroute/internal/models"
+	"greenroute/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScheduledTripHandler handles HTTP requests for scheduled trips
+type ScheduledTripHandler struct {
+	tripService *services.ScheduledTripService
+}
+
+// NewScheduledTripHandler creates a new instance of ScheduledTripHandler
+func NewScheduledTripHandler(tripService *services.ScheduledTripService) *ScheduledTripHandler {
+	return &ScheduledTripHandler{
+		tripService: tripService,
+	}
+}
+
+// RegisterRoutes registers all scheduled trip endpoints
+func (h *ScheduledTripHandler) RegisterRoutes(router *gin.Engine) {
+	v1 := router.Group("/api/v1", RequireUser())
+	{
+		v1.GET("/trips", h.ListTrips)
+		v1.POST("/trips", h.CreateTrip)
+		v1.GET("/trips/:id", h.GetTrip)
+		v1.DELETE("/trips/:id", h.DeleteTrip)
+	}
+}
+
+// ListTrips returns the caller's scheduled trips
+func (h *ScheduledTripHandler) ListTrips(c *gin.Context) {
+	userID, _ := CurrentUserID(c)
+
+	trips, err := h.tripService.ListTrips(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, trips)
+}
+
+// GetTrip returns one of the caller's scheduled trips with its planning state
+func (h *ScheduledTripHandler) GetTrip(c *gin.Context) {
+	userID, _ := CurrentUserID(c)
+	tripID, ok := tripIDParam(c)
+	if !ok {
+		return
+	}
+
+	trip, err := h.tripService.GetTrip(c.Request.Context(), userID, tripID)
+	if err != nil {
+		tripError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, trip)
+}
+
+// CreateTrip saves a new scheduled trip for the caller
+func (h *ScheduledTripHandler) CreateTrip(c *gin.Context) {
+	userID, _ := CurrentUserID(c)
+
+	var trip models.ScheduledTrip
+	if err := c.ShouldBindJSON(&trip); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.tripService.CreateTrip(c.Request.Context(), userID, trip)
+	if err != nil {
+		tripError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// DeleteTrip removes one of the caller's scheduled trips
+func (h *ScheduledTripHandler) DeleteTrip(c *gin.Context) {
+	userID, _ := CurrentUserID(c)
+	tripID, ok := tripIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.tripService.DeleteTrip(c.Request.Context(), userID, tripID); err != nil {
+		tripError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// tripError maps scheduled trip service errors to HTTP responses
+func tripError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidTrip):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTripNotFound), errors.Is(err, services.ErrProfileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func tripIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid trip ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
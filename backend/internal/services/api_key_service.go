@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"greenroute/internal/database"
+	"greenroute/internal/models"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrInvalidAPIKey is returned for unknown or revoked API keys
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrRateLimited is returned when a key sends requests faster than its rate limit
+	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrQuotaExceeded is returned when a key has used up its monthly quota
+	ErrQuotaExceeded = errors.New("monthly quota exceeded")
+	// ErrAPIKeyNotFound is returned when a user has no key with the requested ID
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrCallerRequired is returned for anonymous requests when anonymous routing is disabled
+	ErrCallerRequired = errors.New("an API key or a user token is required")
+)
+
+const (
+	apiKeyPrefix       = "gr_"
+	apiKeyPrefixLength = 10 // characters kept to identify a key
+
+	defaultKeyRateLimit    = 60     // requests per minute
+	defaultKeyMonthlyQuota = 10_000 // requests per month
+
+	defaultUserRateLimit      = 30 // requests per minute for signed-in users without a key
+	defaultAnonymousRateLimit = 10 // requests per minute for each anonymous client IP
+
+	// maxCallerLimiters bounds the user and IP buckets kept in memory; all are
+	// dropped when it is reached, which only forgives some recent requests
+	maxCallerLimiters = 100_000
+)
+
+// APIKeyService manages API keys and enforces their rate limits and quotas,
+// and the default rate limits of callers without a key
+type APIKeyService struct {
+	keys               database.APIKeyRepository
+	maxRateLimit       int
+	maxQuota           int
+	userRateLimit      int
+	anonymousRateLimit int
+	allowAnonymous     bool
+
+	mu       sync.Mutex
+	limiters map[uint]*keyLimiter
+	callers  map[string]*rate.Limiter // by "user:<id>" or "ip:<address>"
+}
+
+// keyLimiter is the in-memory token bucket of one key
+type keyLimiter struct {
+	perMinute int
+	limiter   *rate.Limiter
+}
+
+// NewAPIKeyService creates a new instance of APIKeyService. API_KEY_RATE_LIMIT
+// (requests per minute) and API_KEY_MONTHLY_QUOTA set the limits of new keys;
+// users may only choose lower values. USER_RATE_LIMIT limits signed-in users
+// calling without a key, and ANONYMOUS_RATE_LIMIT limits anonymous callers
+// per IP; ALLOW_ANONYMOUS_ROUTING=false refuses them instead.
+func NewAPIKeyService(keys database.APIKeyRepository) (*APIKeyService, error) {
+	s := &APIKeyService{
+		keys:               keys,
+		maxRateLimit:       defaultKeyRateLimit,
+		maxQuota:           defaultKeyMonthlyQuota,
+		userRateLimit:      defaultUserRateLimit,
+		anonymousRateLimit: defaultAnonymousRateLimit,
+		allowAnonymous:     true,
+		limiters:           make(map[uint]*keyLimiter),
+		callers:            make(map[string]*rate.Limiter),
+	}
+	for key, limit := range map[string]*int{
+		"API_KEY_RATE_LIMIT":    &s.maxRateLimit,
+		"API_KEY_MONTHLY_QUOTA": &s.maxQuota,
+		"USER_RATE_LIMIT":       &s.userRateLimit,
+		"ANONYMOUS_RATE_LIMIT":  &s.anonymousRateLimit,
+	} {
+		if value := os.Getenv(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid %s: %q", key, value)
+			}
+			*limit = n
+		}
+	}
+	if s.maxRateLimit == 0 {
+		return nil, errors.New("API_KEY_RATE_LIMIT must be positive")
+	}
+	if s.userRateLimit == 0 {
+		return nil, errors.New("USER_RATE_LIMIT must be positive")
+	}
+	if value := os.Getenv("ALLOW_ANONYMOUS_ROUTING"); value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ALLOW_ANONYMOUS_ROUTING: %q", value)
+		}
+		s.allowAnonymous = allow
+	}
+	if s.allowAnonymous && s.anonymousRateLimit == 0 {
+		return nil, errors.New("ANONYMOUS_RATE_LIMIT must be positive")
+	}
+	return s, nil
+}
+
+// CreateKey creates a key for a user and returns it with its secret, which is
+// not stored and cannot be retrieved again. Zero limits select the maximum.
+func (s *APIKeyService) CreateKey(ctx context.Context, userID uint, name string, rateLimit, quota int) (*models.APIKey, string, error) {
+	if rateLimit <= 0 || rateLimit > s.maxRateLimit {
+		rateLimit = s.maxRateLimit
+	}
+	if quota <= 0 || (s.maxQuota > 0 && quota > s.maxQuota) {
+		quota = s.maxQuota
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %v", err)
+	}
+	secret := apiKeyPrefix + hex.EncodeToString(buf)
+
+	key := &database.APIKey{
+		UserID:             userID,
+		Name:               strings.TrimSpace(name),
+		Prefix:             secret[:apiKeyPrefixLength],
+		KeyHash:            hashAPIKey(secret),
+		RateLimitPerMinute: rateLimit,
+		MonthlyQuota:       quota,
+	}
+	if err := s.keys.CreateAPIKey(key); err != nil {
+		return nil, "", err
+	}
+	return toAPIKey(key), secret, nil
+}
+
+// ListKeys returns all keys of a user
+func (s *APIKeyService) ListKeys(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	keys, err := s.keys.ListAPIKeys(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.APIKey, len(keys))
+	for i := range keys {
+		result[i] = *toAPIKey(&keys[i])
+	}
+	return result, nil
+}
+
+// RevokeKey revokes a user's key; requests with it are refused from then on
+func (s *APIKeyService) RevokeKey(ctx context.Context, userID, keyID uint) error {
+	err := s.keys.RevokeAPIKey(userID, keyID)
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.limiters, keyID)
+	s.mu.Unlock()
+	return nil
+}
+
+// Usage returns the monthly request counts of a user's key
+func (s *APIKeyService) Usage(ctx context.Context, userID, keyID uint) ([]models.APIKeyUsage, error) {
+	key, err := s.keys.GetAPIKey(userID, keyID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := s.keys.GetAPIKeyUsage(key.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make([]models.APIKeyUsage, len(records))
+	for i, r := range records {
+		usage[i] = models.APIKeyUsage{
+			Month:    r.Month,
+			Requests: r.Requests,
+			Rejected: r.Rejected,
+			Quota:    key.MonthlyQuota,
+		}
+	}
+	return usage, nil
+}
+
+// Authorize checks a key and counts the request against its rate limit and
+// monthly quota. It returns the key's owner.
+func (s *APIKeyService) Authorize(ctx context.Context, secret string) (uint, error) {
+	key, err := s.keys.GetAPIKeyByHash(hashAPIKey(secret))
+	if errors.Is(err, database.ErrNotFound) {
+		return 0, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	month := time.Now().UTC().Format("2006-01")
+	if !s.limiter(key).Allow() {
+		if err := s.keys.RecordAPIKeyRejection(key.ID, month); err != nil {
+			return 0, err
+		}
+		return 0, ErrRateLimited
+	}
+
+	accepted, err := s.keys.ConsumeAPIKeyQuota(key.ID, month, key.MonthlyQuota)
+	if err != nil {
+		return 0, err
+	}
+	if !accepted {
+		return 0, ErrQuotaExceeded
+	}
+	return key.UserID, nil
+}
+
+// AuthorizeUser counts a request from a signed-in user without a key against
+// the default user rate limit
+func (s *APIKeyService) AuthorizeUser(ctx context.Context, userID uint) error {
+	if !s.callerLimiter(fmt.Sprintf("user:%d", userID), s.userRateLimit).Allow() {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// AuthorizeAnonymous counts a request from an anonymous client against the
+// rate limit of its IP address, or refuses it if anonymous routing is disabled
+func (s *APIKeyService) AuthorizeAnonymous(ctx context.Context, clientIP string) error {
+	if !s.allowAnonymous {
+		return ErrCallerRequired
+	}
+	if !s.callerLimiter("ip:"+clientIP, s.anonymousRateLimit).Allow() {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// callerLimiter returns the token bucket of a user or IP address, allowing a
+// burst of up to one minute's worth of requests
+func (s *APIKeyService) callerLimiter(caller string, perMinute int) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.callers[caller]
+	if !ok {
+		if len(s.callers) >= maxCallerLimiters {
+			s.callers = make(map[string]*rate.Limiter)
+		}
+		l = rate.NewLimiter(rate.Limit(float64(perMinute)/60), perMinute)
+		s.callers[caller] = l
+	}
+	return l
+}
+
+// limiter returns the token bucket of a key, allowing a burst of up to one
+// minute's worth of requests
+func (s *APIKeyService) limiter(key *database.APIKey) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.limiters[key.ID]
+	if !ok || l.perMinute != key.RateLimitPerMinute {
+		l = &keyLimiter{
+			perMinute: key.RateLimitPerMinute,
+			limiter:   rate.NewLimiter(rate.Limit(float64(key.RateLimitPerMinute)/60), key.RateLimitPerMinute),
+		}
+		s.limiters[key.ID] = l
+	}
+	return l.limiter
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func toAPIKey(key *database.APIKey) *models.APIKey {
+	return &models.APIKey{
+		ID:                 key.ID,
+		Name:               key.Name,
+		Prefix:             key.Prefix,
+		RateLimitPerMinute: key.RateLimitPerMinute,
+		MonthlyQuota:       key.MonthlyQuota,
+		CreatedAt:          key.CreatedAt,
+		LastUsedAt:         key.LastUsedAt,
+		RevokedAt:          key.RevokedAt,
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"greenroute/internal/auth"
+	"greenroute/internal/database"
+	"greenroute/internal/models"
+	"strings"
+)
+
+var (
+	// ErrEmailTaken is returned when registering an email that already has an account
+	ErrEmailTaken = errors.New("email is already registered")
+	// ErrInvalidCredentials is returned for an unknown email or a wrong password
+	ErrInvalidCredentials = errors.New("invalid email or password")
+)
+
+// dummyPasswordHash is checked against for unknown emails, so that a login
+// takes as long whether or not the account exists
+const dummyPasswordHash = "$2a$10$9DExAYL7SCWChOtUWOrg5ewfDNVfp9.5IFVtQsjsugKevDcP0N8WG"
+
+// AuthService registers and authenticates users
+type AuthService struct {
+	users  database.UserRepository
+	tokens *auth.TokenManager
+}
+
+// Session is a user with freshly issued tokens
+type Session struct {
+	User *models.User `json:"user"`
+	*auth.TokenPair
+}
+
+// NewAuthService creates a new instance of AuthService
+func NewAuthService(users database.UserRepository, tokens *auth.TokenManager) *AuthService {
+	return &AuthService{
+		users:  users,
+		tokens: tokens,
+	}
+}
+
+// Register creates an account and signs the user in
+func (s *AuthService) Register(ctx context.Context, email, name, password string) (*Session, error) {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &database.User{
+		Email:        normalizeEmail(email),
+		Name:         strings.TrimSpace(name),
+		PasswordHash: hash,
+	}
+	err = s.users.CreateUser(user)
+	if errors.Is(err, database.ErrAlreadyExists) {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.newSession(user)
+}
+
+// Login checks a user's credentials and issues new tokens
+func (s *AuthService) Login(ctx context.Context, email, password string) (*Session, error) {
+	user, err := s.users.GetUserByEmail(normalizeEmail(email))
+	if errors.Is(err, database.ErrNotFound) {
+		auth.CheckPassword(dummyPasswordHash, password)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !auth.CheckPassword(user.PasswordHash, password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	return s.newSession(user)
+}
+
+// Refresh exchanges a valid refresh token for a new token pair
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*Session, error) {
+	userID, err := s.tokens.VerifyRefresh(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deleted accounts cannot refresh
+	user, err := s.users.GetUser(userID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, auth.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.newSession(user)
+}
+
+// GetUser returns the public profile of a user
+func (s *AuthService) GetUser(ctx context.Context, userID uint) (*models.User, error) {
+	user, err := s.users.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return toUser(user), nil
+}
+
+func (s *AuthService) newSession(user *database.User) (*Session, error) {
+	tokens, err := s.tokens.Issue(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{User: toUser(user), TokenPair: tokens}, nil
+}
+
+func toUser(user *database.User) *models.User {
+	return &models.User{
+		ID:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
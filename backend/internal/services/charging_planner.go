@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"greenroute/internal/emissions"
+	"greenroute/internal/external"
+	"greenroute/internal/geo"
+	"greenroute/internal/models"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	defaultStartSoC      = 1.0
+	defaultMinArrivalSoC = 0.1
+
+	// Charging slows down above fastChargeLimitSoC to taperRate of full power
+	fastChargeLimitSoC = 0.8
+	taperRate          = 0.35
+
+	unknownStationPowerKW = 22.0
+	stopOverhead          = 5 * time.Minute // parking and plugging in
+
+	chargingCorridorKm = 5.0
+)
+
+// chargingCandidate is a station that can be reached from a driving segment
+type chargingCandidate struct {
+	station   external.ChargingStation
+	position  float64 // km from the segment start
+	detour    float64 // km between the route and the station, one way
+	powerKW   float64
+	connector models.ConnectorType
+}
+
+// batteryState holds the EV parameters used for planning, with defaults applied
+type batteryState struct {
+	vehicle    *models.VehicleProfile
+	capacity   float64 // kWh
+	reserve    float64 // minimum SoC on arrival, 0-1
+	maxPowerKW float64 // vehicle charging limit, 0 for none
+}
+
+// planChargingStops splits the driving segments of a battery EV journey at
+// charging stops chosen to minimise charging and detour time
+func (s *RouteService) planChargingStops(ctx context.Context, planner *legPlanner, j journey) journey {
+	v := planner.vehicle
+	if v == nil || v.FuelType != models.BEV || v.BatteryCapacityKWh <= 0 {
+		return j
+	}
+
+	battery := batteryState{
+		vehicle:    v,
+		capacity:   v.BatteryCapacityKWh,
+		reserve:    defaultMinArrivalSoC,
+		maxPowerKW: v.MaxChargePowerKW,
+	}
+	if v.MinArrivalSoC > 0 {
+		battery.reserve = v.MinArrivalSoC
+	}
+	soc := defaultStartSoC
+	if v.StartSoC > 0 {
+		soc = math.Min(v.StartSoC, 1)
+	}
+
+	planned := journey{warnings: j.warnings}
+	for _, seg := range j.segments {
+		if seg.Mode != models.Car {
+			planned.segments = append(planned.segments, seg)
+			continue
+		}
+
+		legs, stops, arrival, err := s.planSegmentCharging(ctx, planner, seg, battery, soc)
+		if err != nil {
+			planned.warnings = append(planned.warnings, err.Error())
+			planned.segments = append(planned.segments, seg)
+			soc = math.Max(0, soc-segmentEnergy(v, seg)/battery.capacity)
+			continue
+		}
+
+		planned.segments = append(planned.segments, legs...)
+		planned.stops = append(planned.stops, stops...)
+		soc = arrival
+	}
+
+	return planned
+}
+
+// planSegmentCharging returns the driving legs and charging stops for one segment
+// and the state of charge on arrival
+func (s *RouteService) planSegmentCharging(
+	ctx context.Context,
+	planner *legPlanner,
+	seg models.RouteSegment,
+	battery batteryState,
+	startSoC float64,
+) ([]models.RouteSegment, []models.ChargingStop, float64, error) {
+	// No stop needed if the battery covers the whole segment
+	needed := segmentEnergy(battery.vehicle, seg) / battery.capacity
+	if startSoC-needed >= battery.reserve {
+		return []models.RouteSegment{seg}, nil, startSoC - needed, nil
+	}
+
+	candidates := s.chargingCandidates(ctx, seg, battery)
+	path, arrivals, ok := chooseChargingStops(candidates, seg, battery, startSoC)
+	if !ok {
+		return nil, nil, 0, fmt.Errorf(
+			"no charging plan reaches %s with a %.0f%% reserve",
+			describeLocation(seg.EndLocation), battery.reserve*100,
+		)
+	}
+
+	var legs []models.RouteSegment
+	var stops []models.ChargingStop
+	from := seg.StartLocation
+	energyPerKm := segmentEnergyPerKm(battery.vehicle, seg)
+
+	for i, idx := range path {
+		c := candidates[idx]
+		location := models.Location{
+			Latitude:  c.station.AddressInfo.Latitude,
+			Longitude: c.station.AddressInfo.Longitude,
+			Address:   c.station.AddressInfo.Address,
+		}
+
+		leg := planner.leg(ctx, from, location, models.Car)
+		if leg == nil {
+			return nil, nil, 0, fmt.Errorf("failed to route to charging station %s", c.station.AddressInfo.Title)
+		}
+		legs = append(legs, *leg)
+
+		// Charge just enough to reach the next stop, or the destination, with the reserve
+		nextPosition, nextDetour := seg.Distance/1000.0, 0.0
+		if i+1 < len(path) {
+			next := candidates[path[i+1]]
+			nextPosition, nextDetour = next.position, next.detour
+		}
+		distance := nextPosition - c.position + c.detour + nextDetour
+		departure := math.Max(arrivals[i], battery.reserve+distance*energyPerKm/battery.capacity)
+
+		stops = append(stops, models.ChargingStop{
+			StationID:      c.station.ID,
+			Name:           c.station.AddressInfo.Title,
+			Location:       location,
+			ArrivalSoC:     arrivals[i],
+			DepartureSoC:   departure,
+			EnergyKWh:      (departure - arrivals[i]) * battery.capacity,
+			Connector:      c.connector,
+			PowerKW:        c.powerKW,
+			ChargeDuration: chargeDuration(arrivals[i], departure, battery.capacity, c.powerKW),
+		})
+		from = location
+	}
+
+	leg := planner.leg(ctx, from, seg.EndLocation, models.Car)
+	if leg == nil {
+		return nil, nil, 0, fmt.Errorf("failed to route from the last charging stop to %s", describeLocation(seg.EndLocation))
+	}
+	legs = append(legs, *leg)
+
+	return legs, stops, arrivals[len(arrivals)-1], nil
+}
+
+// chargingCandidates finds stations within the charging corridor of a driving segment
+func (s *RouteService) chargingCandidates(ctx context.Context, seg models.RouteSegment, battery batteryState) []chargingCandidate {
+	path := segmentPath(seg)
+	stations, err := external.FindStationsInCorridor(ctx, s.stationFinder, path, chargingCorridorKm, battery.vehicle.Connectors)
+	if err != nil {
+		return nil
+	}
+
+	// Scale positions to the routed distance, which the simplified geometry may not match
+	scale := 1.0
+	if length := geo.PathLength(path); length > 0 {
+		scale = seg.Distance / length
+	}
+
+	var candidates []chargingCandidate
+	for _, station := range stations {
+		connector, power, ok := station.CompatiblePower(battery.vehicle.Connectors)
+		if !ok {
+			continue
+		}
+		if power <= 0 {
+			power = unknownStationPowerKW
+		}
+		if battery.maxPowerKW > 0 {
+			power = math.Min(power, battery.maxPowerKW)
+		}
+
+		candidates = append(candidates, chargingCandidate{
+			station:   station.ChargingStation,
+			position:  station.DistanceAlongRouteKm * scale,
+			detour:    station.DetourKm,
+			powerKW:   power,
+			connector: connector,
+		})
+	}
+
+	return candidates
+}
+
+// chooseChargingStops finds the sequence of stations that minimises charging and
+// detour time, charging at each stop just enough to reach the next one. It
+// returns the chosen candidate indexes and the SoC on arrival at each stop and
+// at the destination. Stops are only made in order along the segment, so the
+// candidates are sorted by position in place first.
+func chooseChargingStops(
+	candidates []chargingCandidate,
+	seg models.RouteSegment,
+	battery batteryState,
+	startSoC float64,
+) ([]int, []float64, bool) {
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].position < candidates[b].position
+	})
+
+	n := len(candidates)
+	energyPerKm := segmentEnergyPerKm(battery.vehicle, seg)
+	speed := averageSpeed(seg)
+
+	// Node 0 is the start, nodes 1..n the candidates and n+1 the destination
+	position := func(node int) float64 {
+		switch {
+		case node == 0:
+			return 0
+		case node == n+1:
+			return seg.Distance / 1000.0
+		default:
+			return candidates[node-1].position
+		}
+	}
+	detour := func(node int) float64 {
+		if node == 0 || node == n+1 {
+			return 0
+		}
+		return candidates[node-1].detour
+	}
+
+	cost := make([]float64, n+2)
+	arrival := make([]float64, n+2)
+	prev := make([]int, n+2)
+	for i := range cost {
+		cost[i] = math.Inf(1)
+		prev[i] = -1
+	}
+	cost[0] = 0
+	arrival[0] = startSoC
+
+	for j := 1; j <= n+1; j++ {
+		for i := 0; i < j; i++ {
+			if math.IsInf(cost[i], 1) {
+				continue
+			}
+
+			distance := position(j) - position(i) + detour(i) + detour(j)
+			if distance < 0 {
+				continue
+			}
+			needed := distance * energyPerKm / battery.capacity
+
+			departure := arrival[i]
+			stepCost := cost[i]
+			if i > 0 {
+				departure = math.Max(arrival[i], battery.reserve+needed)
+				if departure > 1 {
+					continue // cannot reach j even with a full battery
+				}
+				stepCost += chargeDuration(arrival[i], departure, battery.capacity, candidates[i-1].powerKW).Seconds()
+			}
+			if departure-needed < battery.reserve-1e-9 {
+				continue
+			}
+			if j <= n && speed > 0 {
+				stepCost += 2 * detour(j) / speed * 3600
+			}
+
+			remaining := departure - needed
+			if stepCost < cost[j] || (stepCost == cost[j] && remaining > arrival[j]) {
+				cost[j] = stepCost
+				arrival[j] = remaining
+				prev[j] = i
+			}
+		}
+	}
+
+	if math.IsInf(cost[n+1], 1) {
+		return nil, nil, false
+	}
+
+	var nodes []int
+	for node := prev[n+1]; node > 0; node = prev[node] {
+		nodes = append([]int{node}, nodes...)
+	}
+
+	path := make([]int, len(nodes))
+	arrivals := make([]float64, 0, len(nodes)+1)
+	for i, node := range nodes {
+		path[i] = node - 1
+		arrivals = append(arrivals, arrival[node])
+	}
+	arrivals = append(arrivals, arrival[n+1])
+
+	return path, arrivals, true
+}
+
+// chargeDuration returns the dwell time to charge between two SoC levels,
+// including the fixed stop overhead
+func chargeDuration(from, to, capacityKWh, powerKW float64) time.Duration {
+	if to <= from || powerKW <= 0 {
+		return 0
+	}
+
+	fast := math.Max(0, math.Min(to, fastChargeLimitSoC)-from) * capacityKWh / powerKW
+	slow := math.Max(0, to-math.Max(from, fastChargeLimitSoC)) * capacityKWh / (powerKW * taperRate)
+
+	hours := fast + slow
+	return time.Duration(hours*float64(time.Hour)).Round(time.Minute) + stopOverhead
+}
+
+// segmentEnergy returns the battery energy in kWh needed to drive a segment,
+// including its climbs
+func segmentEnergy(vehicle *models.VehicleProfile, seg models.RouteSegment) float64 {
+	return emissions.BatteryEnergy(vehicle, seg.Distance, averageSpeed(seg), seg.Elevation)
+}
+
+// segmentEnergyPerKm returns the average battery energy per km over a segment,
+// spreading its climbs evenly along it
+func segmentEnergyPerKm(vehicle *models.VehicleProfile, seg models.RouteSegment) float64 {
+	if seg.Distance <= 0 {
+		return emissions.EnergyPerKm(vehicle, averageSpeed(seg))
+	}
+	return segmentEnergy(vehicle, seg) / (seg.Distance / 1000.0)
+}
+
+// averageSpeed returns the average speed of a segment in km/h, or 0 if unknown
+func averageSpeed(seg models.RouteSegment) float64 {
+	if seg.Duration <= 0 {
+		return 0
+	}
+	return seg.Distance / 1000.0 / seg.Duration.Hours()
+}
+
+// segmentPath returns the geometry of a segment, or the straight line between
+// its ends if the provider returned none
+func segmentPath(seg models.RouteSegment) []geo.Point {
+	if seg.Polyline != "" {
+		if path, err := geo.DecodePolyline(seg.Polyline); err == nil && len(path) > 1 {
+			return path
+		}
+	}
+	return []geo.Point{
+		{Lat: seg.StartLocation.Latitude, Lng: seg.StartLocation.Longitude},
+		{Lat: seg.EndLocation.Latitude, Lng: seg.EndLocation.Longitude},
+	}
+}
+
+// routePath joins the geometries of consecutive segments
+func routePath(segments []models.RouteSegment) []geo.Point {
+	var path []geo.Point
+	for _, seg := range segments {
+		path = append(path, segmentPath(seg)...)
+	}
+	return path
+}
+
+func describeLocation(loc models.Location) string {
+	if loc.Address != "" {
+		return loc.Address
+	}
+	return fmt.Sprintf("%.5f,%.5f", loc.Latitude, loc.Longitude)
+}
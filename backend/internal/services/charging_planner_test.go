@@ -0,0 +1,154 @@
+package services
+
+import (
+	"greenroute/internal/models"
+	"math"
+	"testing"
+	"time"
+)
+
+// testBattery is a 50 kWh car using 0.2 kWh/km at 50 km/h, so 250 km on a full charge
+func testBattery() batteryState {
+	return batteryState{
+		vehicle: &models.VehicleProfile{
+			FuelType:            models.BEV,
+			ConsumptionKWhPerKm: 0.2,
+			BatteryCapacityKWh:  50,
+		},
+		capacity: 50,
+		reserve:  0.1,
+	}
+}
+
+// testDrive is a driving segment of km kilometers at 50 km/h
+func testDrive(km float64) models.RouteSegment {
+	return models.RouteSegment{
+		Mode:     models.Car,
+		Distance: km * 1000,
+		Duration: time.Duration(km / 50 * float64(time.Hour)),
+	}
+}
+
+func TestChooseChargingStops(t *testing.T) {
+	tests := []struct {
+		name       string
+		km         float64
+		candidates []chargingCandidate
+		ok         bool
+		stops      []chargingCandidate
+		arrivals   []float64
+	}{
+		{
+			name:     "no stop needed",
+			km:       100,
+			ok:       true,
+			arrivals: []float64{0.6},
+		},
+		{
+			name:       "one stop",
+			km:         300,
+			candidates: []chargingCandidate{{position: 150, powerKW: 150}},
+			ok:         true,
+			stops:      []chargingCandidate{{position: 150, powerKW: 150}},
+			arrivals:   []float64{0.4, 0.1},
+		},
+		{
+			name: "unsorted candidates",
+			km:   500,
+			candidates: []chargingCandidate{
+				{position: 400, powerKW: 150},
+				{position: 200, powerKW: 150},
+			},
+			ok:       true,
+			stops:    []chargingCandidate{{position: 200, powerKW: 150}, {position: 400, powerKW: 150}},
+			arrivals: []float64{0.2, 0.1, 0.1},
+		},
+		{
+			name: "faster charger at the same place",
+			km:   300,
+			candidates: []chargingCandidate{
+				{position: 150, powerKW: 50},
+				{position: 150, powerKW: 150},
+			},
+			ok:       true,
+			stops:    []chargingCandidate{{position: 150, powerKW: 150}},
+			arrivals: []float64{0.4, 0.1},
+		},
+		{
+			name: "smaller detour",
+			km:   300,
+			candidates: []chargingCandidate{
+				{position: 150, detour: 4, powerKW: 150},
+				{position: 150, detour: 1, powerKW: 150},
+			},
+			ok:       true,
+			stops:    []chargingCandidate{{position: 150, detour: 1, powerKW: 150}},
+			arrivals: []float64{0.396, 0.1},
+		},
+		{
+			name:       "gap too long",
+			km:         500,
+			candidates: []chargingCandidate{{position: 100, powerKW: 150}},
+			ok:         false,
+		},
+		{
+			name:       "no candidates",
+			km:         300,
+			candidates: nil,
+			ok:         false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, arrivals, ok := chooseChargingStops(tt.candidates, testDrive(tt.km), testBattery(), 1)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+
+			if len(path) != len(tt.stops) {
+				t.Fatalf("chose %d stops, want %d", len(path), len(tt.stops))
+			}
+			for i, index := range path {
+				got, want := tt.candidates[index], tt.stops[i]
+				if got.position != want.position || got.detour != want.detour || got.powerKW != want.powerKW {
+					t.Errorf("stop %d at %v km, %v km off the route, %v kW; want %v km, %v km, %v kW",
+						i, got.position, got.detour, got.powerKW, want.position, want.detour, want.powerKW)
+				}
+			}
+
+			if len(arrivals) != len(tt.arrivals) {
+				t.Fatalf("arrivals = %v, want %v", arrivals, tt.arrivals)
+			}
+			for i := range arrivals {
+				if math.Abs(arrivals[i]-tt.arrivals[i]) > 1e-6 {
+					t.Errorf("arrivals = %v, want %v", arrivals, tt.arrivals)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestChargeDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to float64
+		powerKW  float64
+		want     time.Duration
+	}{
+		{name: "fast", from: 0.2, to: 0.8, powerKW: 100, want: 18*time.Minute + stopOverhead},
+		{name: "tapered", from: 0.8, to: 0.9, powerKW: 100, want: 9*time.Minute + stopOverhead},
+		{name: "nothing to charge", from: 0.5, to: 0.5, powerKW: 100, want: 0},
+		{name: "no power", from: 0.2, to: 0.8, powerKW: 0, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chargeDuration(tt.from, tt.to, 50, tt.powerKW); got != tt.want {
+				t.Errorf("chargeDuration(%v, %v) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"greenroute/internal/emissions"
+	"greenroute/internal/external"
+	"greenroute/internal/models"
+	"time"
+)
+
+const (
+	// liveDepartureMargin is how soon a departure must be for the provider's
+	// times to count as current traffic
+	liveDepartureMargin = 5 * time.Minute
+
+	defaultDepartureStep = 15 * time.Minute
+	minDepartureStep     = 5 * time.Minute
+	maxDepartureWindow   = 24 * time.Hour
+)
+
+var (
+	// ErrInvalidDepartureWindow is returned for a departure window that cannot be scanned
+	ErrInvalidDepartureWindow = errors.New("invalid departure window")
+	// ErrNoDepartureInWindow is returned when no departure arrives by the latest arrival
+	ErrNoDepartureInWindow = errors.New("no departure in the window arrives in time")
+)
+
+// DeparturePlan is the recommended departure with its route, and the predicted
+// trip for every departure that was tried
+type DeparturePlan struct {
+	Departure time.Time                 `json:"departure"`
+	Objective models.DepartureObjective `json:"objective"`
+	Route     *RouteWithCharging        `json:"route"`
+	Options   []models.DepartureOption  `json:"options"`
+}
+
+// PlanDeparture recommends when to leave within a window. The trip is planned
+// once with the provider's traffic at the start of the window; the driving
+// times at every later departure come from traffic history for its weekday and
+// hour, and timetabled segments wait for the next service. Time spent driving
+// slower than at the quietest departure adds idling emissions. The recommended
+// departure is then planned in full, with the provider's traffic for that time.
+func (s *RouteService) PlanDeparture(
+	ctx context.Context,
+	start models.Location,
+	end models.Location,
+	prefs models.RoutePreferences,
+	userID string,
+	window models.DepartureWindow,
+) (*DeparturePlan, error) {
+	if !s.validateLocations(start, end) {
+		return nil, errors.New("invalid locations provided")
+	}
+
+	departures, objective, err := departureTimes(window, prefs, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	opts := external.RouteOptions{
+		AvoidHighways: prefs.AvoidHighways,
+		DepartureTime: departures[0],
+	}
+	planner := s.newLegPlanner(prefs, opts)
+	candidates := s.planJourneys(ctx, planner, start, end, prefs)
+	if len(candidates) == 0 {
+		return nil, errors.New("no valid routes found for any preferred mode")
+	}
+	for i := range candidates {
+		candidates[i] = s.planChargingStops(ctx, planner, candidates[i])
+	}
+
+	// Predict every candidate at every departure
+	lookup := s.newTrafficLookup()
+	predicted := make([][]journey, len(departures))
+	for t, departure := range departures {
+		predicted[t] = make([]journey, len(candidates))
+		for i, j := range candidates {
+			j.segments = append([]models.RouteSegment(nil), j.segments...)
+			predicted[t][i] = j
+		}
+		if _, err := s.applyTrafficHistory(lookup, predicted[t], departure); err != nil {
+			return nil, err
+		}
+	}
+
+	// The quickest predicted time of each driving segment is taken as free flow
+	freeFlow := make([][]time.Duration, len(candidates))
+	for i, j := range candidates {
+		freeFlow[i] = make([]time.Duration, len(j.segments))
+		for k := range j.segments {
+			for t := range departures {
+				d := predicted[t][i].segments[k].Duration
+				if t == 0 || d < freeFlow[i][k] {
+					freeFlow[i][k] = d
+				}
+			}
+		}
+	}
+
+	// Ranking shares the segments of the journeys it orders, so the congestion
+	// emission of a segment is found by its address
+	options := make([]models.DepartureOption, len(departures))
+	congestion := make(map[*models.RouteSegment]float64)
+	best := -1
+	for t, departure := range departures {
+		for i := range predicted[t] {
+			// Timetabled segments wait for the next service after this departure
+			j := &predicted[t][i]
+			planner.timeForward(ctx, j, departure)
+
+			at := departure
+			for k := range j.segments {
+				seg := &j.segments[k]
+				if seg.Departure != nil && seg.Departure.After(at) {
+					at = *seg.Departure
+				}
+				segDeparture := at
+				at = at.Add(seg.Duration)
+				if seg.Mode != models.Car {
+					continue
+				}
+				// Energy use and grid intensity of electric cars depend on the time
+				s.emissions.Apply(ctx, seg, prefs.Vehicle, segDeparture)
+				extra := emissions.CongestionEmission(prefs.Vehicle, seg.Duration-freeFlow[i][k])
+				seg.CO2Emission += extra
+				congestion[seg] = extra
+			}
+		}
+
+		top := rankJourneys(predicted[t], prefs)[0]
+		option := models.DepartureOption{
+			Departure: departure,
+			Arrival:   top.arrival(),
+			Duration:  top.duration(),
+			Emission:  top.emission(),
+		}
+		for k := range top.segments {
+			seg := &top.segments[k]
+			option.CongestionEmission += congestion[seg]
+			option.FromHistory = option.FromHistory || seg.ETA != nil
+			if k == 0 || seg.Mode != top.segments[k-1].Mode {
+				option.Modes = append(option.Modes, seg.Mode)
+			}
+		}
+		options[t] = option
+
+		if window.LatestArrival != nil && option.Arrival.After(*window.LatestArrival) {
+			continue
+		}
+		if best < 0 || departureCost(option, objective) < departureCost(options[best], objective) {
+			best = t
+		}
+	}
+	if best < 0 {
+		return nil, ErrNoDepartureInWindow
+	}
+
+	route, err := s.CalculateRoute(ctx, start, end, prefs, userID, TripTime{Departure: departures[best]})
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeparturePlan{
+		Departure: departures[best],
+		Objective: objective,
+		Route:     route,
+		Options:   options,
+	}, nil
+}
+
+// departureTimes returns the departures to try in a window, starting no
+// earlier than now, and the objective to choose between them by
+func departureTimes(window models.DepartureWindow, prefs models.RoutePreferences, now time.Time) ([]time.Time, models.DepartureObjective, error) {
+	objective := window.Objective
+	switch objective {
+	case models.MinimiseDuration, models.MinimiseEmission:
+	case "":
+		objective = models.MinimiseDuration
+		if prefs.PrioritizeEmission {
+			objective = models.MinimiseEmission
+		}
+	default:
+		return nil, "", fmt.Errorf("%w: unknown objective %q", ErrInvalidDepartureWindow, objective)
+	}
+
+	earliest := window.Earliest
+	if earliest.Before(now) {
+		earliest = now
+	}
+	var latest time.Time
+	switch {
+	case window.Latest != nil:
+		latest = *window.Latest
+	case window.LatestArrival != nil:
+		latest = *window.LatestArrival
+	default:
+		return nil, "", fmt.Errorf("%w: a latest departure or arrival is required", ErrInvalidDepartureWindow)
+	}
+	if latest.Before(earliest) {
+		return nil, "", fmt.Errorf("%w: the window ends before it starts", ErrInvalidDepartureWindow)
+	}
+	if latest.Sub(earliest) > maxDepartureWindow {
+		return nil, "", fmt.Errorf("%w: the window is longer than %v", ErrInvalidDepartureWindow, maxDepartureWindow)
+	}
+
+	step := window.Step
+	if step == 0 {
+		step = defaultDepartureStep
+	}
+	if step < minDepartureStep {
+		return nil, "", fmt.Errorf("%w: the step is shorter than %v", ErrInvalidDepartureWindow, minDepartureStep)
+	}
+
+	var departures []time.Time
+	for at := earliest; !at.After(latest); at = at.Add(step) {
+		departures = append(departures, at)
+	}
+	return departures, objective, nil
+}
+
+// departureCost returns the value of an option that the objective minimises
+func departureCost(option models.DepartureOption, objective models.DepartureObjective) float64 {
+	if objective == models.MinimiseEmission {
+		return option.Emission
+	}
+	return option.Duration.Seconds()
+}
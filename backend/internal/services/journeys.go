@@ -0,0 +1,425 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"greenroute/internal/elevation"
+	"greenroute/internal/emissions"
+	"greenroute/internal/external"
+	"greenroute/internal/geo"
+	"greenroute/internal/models"
+	"time"
+)
+
+const (
+	// maxHubsPerEnd limits how many transit hubs are tried near the origin and destination
+	maxHubsPerEnd = 2
+
+	parkAndRideRadius = 10000.0 // in meters
+	bikeAndRideRadius = 5000.0  // in meters
+	lastMileRadius    = 1500.0  // in meters
+)
+
+// journey is a candidate door-to-door trip made of consecutive segments
+type journey struct {
+	segments  []models.RouteSegment
+	stops     []models.ChargingStop
+	warnings  []string
+	departure time.Time
+}
+
+// duration returns the door-to-door time including charging stops. Once the
+// journey is timed it runs from the departure to the arrival, so waits for
+// timetabled segments count too.
+func (j journey) duration() time.Duration {
+	if !j.departure.IsZero() {
+		return j.arrival().Sub(j.departure)
+	}
+
+	var total time.Duration
+	for _, seg := range j.segments {
+		total += seg.Duration
+	}
+	for _, stop := range j.stops {
+		total += stop.ChargeDuration
+	}
+	return total
+}
+
+// chargingAfter returns the charging time after each segment. A charging stop
+// ends the driving segment that leads to it.
+func (j journey) chargingAfter() []time.Duration {
+	charging := make([]time.Duration, len(j.segments))
+	next := 0
+	for i, seg := range j.segments {
+		if next < len(j.stops) && seg.Mode == models.Car && sameLocation(seg.EndLocation, j.stops[next].Location) {
+			charging[i] = j.stops[next].ChargeDuration
+			next++
+		}
+	}
+	return charging
+}
+
+// arrival returns when the journey arrives, waiting for timetabled segments
+func (j journey) arrival() time.Time {
+	charging := j.chargingAfter()
+	at := j.departure
+	for i, seg := range j.segments {
+		if seg.Departure != nil && seg.Departure.After(at) {
+			at = *seg.Departure
+		}
+		at = at.Add(seg.Duration + charging[i])
+	}
+	return at
+}
+
+// allWarnings returns the journey's warnings followed by the service alerts
+// about its transit rides
+func (j journey) allWarnings() []string {
+	warnings := append([]string(nil), j.warnings...)
+	seen := make(map[string]bool)
+	for _, seg := range j.segments {
+		for _, ride := range seg.Rides {
+			for _, text := range ride.Alerts {
+				warning := fmt.Sprintf("%s: %s", ride.Line, text)
+				if !seen[warning] {
+					seen[warning] = true
+					warnings = append(warnings, warning)
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+func (j journey) distance() float64 {
+	var total float64
+	for _, seg := range j.segments {
+		total += seg.Distance
+	}
+	return total
+}
+
+func (j journey) emission() float64 {
+	var total float64
+	for _, seg := range j.segments {
+		total += seg.CO2Emission
+	}
+	return total
+}
+
+// walkingDistance returns the distance covered by walking segments
+func (j journey) walkingDistance() float64 {
+	var total float64
+	for _, seg := range j.segments {
+		if seg.Mode == models.Walking {
+			total += seg.Distance
+		}
+	}
+	return total
+}
+
+// transfers returns the number of vehicles boarded after the first. Walking
+// boards nothing, and a transit segment boards each of its rides.
+func (j journey) transfers() int {
+	boardings := 0
+	for _, seg := range j.segments {
+		switch {
+		case seg.Mode == models.Walking:
+		case len(seg.Rides) > 1:
+			boardings += len(seg.Rides)
+		default:
+			boardings++
+		}
+	}
+	return max(0, boardings-1)
+}
+
+// satisfies reports whether the journey respects the walking and transfer limits
+func (j journey) satisfies(prefs models.RoutePreferences) bool {
+	if prefs.MaxTransfers > 0 && j.transfers() > prefs.MaxTransfers {
+		return false
+	}
+	if prefs.MaxWalkingDistance > 0 && j.walkingDistance() > prefs.MaxWalkingDistance {
+		return false
+	}
+	return true
+}
+
+// legPlanner requests legs from the routing provider, adds their terrain,
+// estimates their emissions and memoizes them per request
+type legPlanner struct {
+	provider      external.RoutingProvider
+	emissionModel *emissions.Model
+	terrain       *elevation.DEM
+	vehicle       *models.VehicleProfile
+	departure     time.Time
+	opts          external.RouteOptions
+	cache         map[string]*models.RouteSegment
+}
+
+func (s *RouteService) newLegPlanner(prefs models.RoutePreferences, opts external.RouteOptions) *legPlanner {
+	// The arrival stands in for the unknown departure of arrive-by trips
+	departure := opts.DepartureTime
+	if departure.IsZero() {
+		departure = opts.ArrivalTime
+	}
+	if departure.IsZero() {
+		departure = time.Now()
+	}
+
+	return &legPlanner{
+		provider:      s.routingProvider,
+		emissionModel: s.emissions,
+		terrain:       s.terrain,
+		vehicle:       prefs.Vehicle,
+		departure:     departure,
+		opts:          opts,
+		cache:         make(map[string]*models.RouteSegment),
+	}
+}
+
+// leg returns the segment between two points, or nil if the provider cannot route it
+func (p *legPlanner) leg(ctx context.Context, from, to models.Location, mode models.TransportMode) *models.RouteSegment {
+	return p.legWithOptions(ctx, from, to, mode, p.opts)
+}
+
+// timedLeg returns the segment between two points leaving after departure, or
+// arriving by arrival if it is set, or nil if the provider cannot route it
+func (p *legPlanner) timedLeg(ctx context.Context, from, to models.Location, mode models.TransportMode, departure, arrival time.Time) *models.RouteSegment {
+	opts := p.opts
+	opts.DepartureTime, opts.ArrivalTime = departure, arrival
+	return p.legWithOptions(ctx, from, to, mode, opts)
+}
+
+func (p *legPlanner) legWithOptions(ctx context.Context, from, to models.Location, mode models.TransportMode, opts external.RouteOptions) *models.RouteSegment {
+	key := fmt.Sprintf(
+		"%f,%f|%f,%f|%s|%d|%d",
+		from.Latitude, from.Longitude, to.Latitude, to.Longitude, mode,
+		opts.DepartureTime.Unix(), opts.ArrivalTime.Unix(),
+	)
+	if seg, ok := p.cache[key]; ok {
+		return seg
+	}
+
+	seg, err := p.provider.GetRoute(ctx, from, to, mode, opts)
+	if err != nil {
+		seg = nil // Skip this leg if calculation fails
+	} else {
+		p.applyTerrain(seg)
+		p.emissionModel.Apply(ctx, seg, p.vehicle, p.departure)
+	}
+	p.cache[key] = seg
+	return seg
+}
+
+// alternatives returns every route the provider suggests between two points
+func (p *legPlanner) alternatives(ctx context.Context, from, to models.Location, mode models.TransportMode) []models.RouteSegment {
+	segments, err := p.provider.GetRoutes(ctx, from, to, mode, p.opts)
+	if err != nil {
+		return nil // Skip this mode if calculation fails
+	}
+	for i := range segments {
+		p.applyTerrain(&segments[i])
+		p.emissionModel.Apply(ctx, &segments[i], p.vehicle, p.departure)
+	}
+	return segments
+}
+
+// timeForward times a journey leaving at departure. Timetabled segments after
+// the first are requested again if their service leaves before the traveller
+// gets there, so they wait for a later one.
+func (p *legPlanner) timeForward(ctx context.Context, j *journey, departure time.Time) {
+	j.departure = departure
+	charging := j.chargingAfter()
+	at := departure
+	for i := range j.segments {
+		seg := &j.segments[i]
+		if seg.Departure != nil && seg.Departure.Before(at) {
+			if leg := p.timedLeg(ctx, seg.StartLocation, seg.EndLocation, seg.Mode, at, time.Time{}); leg != nil {
+				*seg = *leg
+			}
+		}
+		if seg.Departure != nil && seg.Departure.After(at) {
+			at = *seg.Departure
+		}
+		at = at.Add(seg.Duration + charging[i])
+	}
+}
+
+// timeBackward times a journey to arrive by arriveBy, working back from the
+// end. Timetabled segments are requested again if they arrive after the next
+// segment has to start, and the traveller leaves just in time for their
+// service. Without a timetable a segment starts its duration before the next.
+func (p *legPlanner) timeBackward(ctx context.Context, j *journey, arriveBy time.Time) {
+	charging := j.chargingAfter()
+	at := arriveBy
+	for i := len(j.segments) - 1; i >= 0; i-- {
+		at = at.Add(-charging[i])
+		seg := &j.segments[i]
+		if seg.Departure != nil && seg.Departure.Add(seg.Duration).After(at) {
+			if leg := p.timedLeg(ctx, seg.StartLocation, seg.EndLocation, seg.Mode, time.Time{}, at); leg != nil {
+				*seg = *leg
+			}
+		}
+		if seg.Departure != nil && !seg.Departure.Add(seg.Duration).After(at) {
+			at = *seg.Departure
+			continue
+		}
+		at = at.Add(-seg.Duration)
+	}
+	j.departure = at
+}
+
+// feederRadius returns how far a transit hub may be from the trip end for a feeder mode
+func feederRadius(mode models.TransportMode, prefs models.RoutePreferences) float64 {
+	switch mode {
+	case models.Car:
+		return parkAndRideRadius
+	case models.Bicycle:
+		return bikeAndRideRadius
+	case models.Walking:
+		if prefs.MaxWalkingDistance > 0 && prefs.MaxWalkingDistance < lastMileRadius {
+			return prefs.MaxWalkingDistance
+		}
+		return lastMileRadius
+	default:
+		return 0
+	}
+}
+
+// hubConnection links a trip end to a transit hub; a nil segment means the
+// transit leg starts or ends at the trip end itself
+type hubConnection struct {
+	hub     models.Location
+	segment *models.RouteSegment
+}
+
+// planJourneys builds door-to-door candidates: every alternative of each preferred mode, plus
+// park-and-ride, bike-and-ride and last-mile walking chains around public transit, and
+// rides on shared bikes and scooters
+func (s *RouteService) planJourneys(
+	ctx context.Context,
+	planner *legPlanner,
+	start models.Location,
+	end models.Location,
+	prefs models.RoutePreferences,
+) []journey {
+	var candidates []journey
+	for _, mode := range prefs.PreferredModes {
+		if mode.Shared() {
+			if s.sharedVehicles != nil {
+				candidates = append(candidates, s.planSharedJourneys(ctx, planner, start, end, prefs, mode)...)
+			}
+			continue
+		}
+		for _, seg := range planner.alternatives(ctx, start, end, mode) {
+			candidates = append(candidates, journey{segments: []models.RouteSegment{seg}})
+		}
+	}
+
+	if s.hubFinder != nil && hasMode(prefs.PreferredModes, models.PublicTransit) {
+		candidates = append(candidates, s.planTransitChains(ctx, planner, start, end, prefs)...)
+	}
+
+	var valid []journey
+	for _, j := range candidates {
+		if j.satisfies(prefs) {
+			valid = append(valid, j)
+		}
+	}
+	if prefs.AvoidSteepClimbs {
+		valid = avoidSteepClimbs(valid)
+	}
+	return valid
+}
+
+// planTransitChains combines feeder legs to and from transit hubs with transit legs
+func (s *RouteService) planTransitChains(
+	ctx context.Context,
+	planner *legPlanner,
+	start models.Location,
+	end models.Location,
+	prefs models.RoutePreferences,
+) []journey {
+	// Drive or cycle to a hub near the origin
+	accesses := []hubConnection{{hub: start}}
+	for _, mode := range []models.TransportMode{models.Car, models.Bicycle} {
+		if !hasMode(prefs.PreferredModes, mode) {
+			continue
+		}
+		for _, hub := range s.nearbyHubs(ctx, start, feederRadius(mode, prefs)) {
+			if seg := planner.leg(ctx, start, hub.Location, mode); seg != nil {
+				accesses = append(accesses, hubConnection{hub: hub.Location, segment: seg})
+			}
+		}
+	}
+
+	// Walk the last mile from a hub near the destination
+	egresses := []hubConnection{{hub: end}}
+	if hasMode(prefs.PreferredModes, models.Walking) {
+		for _, hub := range s.nearbyHubs(ctx, end, feederRadius(models.Walking, prefs)) {
+			if seg := planner.leg(ctx, hub.Location, end, models.Walking); seg != nil {
+				egresses = append(egresses, hubConnection{hub: hub.Location, segment: seg})
+			}
+		}
+	}
+
+	var chains []journey
+	for _, access := range accesses {
+		for _, egress := range egresses {
+			if access.segment == nil && egress.segment == nil {
+				continue // door-to-door transit is already a candidate
+			}
+			if sameLocation(access.hub, egress.hub) {
+				continue
+			}
+
+			transit := planner.leg(ctx, access.hub, egress.hub, models.PublicTransit)
+			if transit == nil {
+				continue
+			}
+
+			var segments []models.RouteSegment
+			if access.segment != nil {
+				segments = append(segments, *access.segment)
+			}
+			segments = append(segments, *transit)
+			if egress.segment != nil {
+				segments = append(segments, *egress.segment)
+			}
+			chains = append(chains, journey{segments: segments})
+		}
+	}
+
+	return chains
+}
+
+// nearbyHubs returns up to maxHubsPerEnd transit hubs around a location
+func (s *RouteService) nearbyHubs(ctx context.Context, near models.Location, radiusMeters float64) []external.TransitHub {
+	hubs, err := s.hubFinder.FindTransitHubs(ctx, near, radiusMeters)
+	if err != nil {
+		return nil
+	}
+	if len(hubs) > maxHubsPerEnd {
+		hubs = hubs[:maxHubsPerEnd]
+	}
+	return hubs
+}
+
+func hasMode(modes []models.TransportMode, mode models.TransportMode) bool {
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// sameLocation reports whether two locations are within a few meters of each other
+func sameLocation(a, b models.Location) bool {
+	return geo.Haversine(
+		geo.Point{Lat: a.Latitude, Lng: a.Longitude},
+		geo.Point{Lat: b.Latitude, Lng: b.Longitude},
+	) < 10
+}
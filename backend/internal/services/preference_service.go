@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"greenroute/internal/database"
+	"greenroute/internal/models"
+	"strings"
+)
+
+var (
+	// ErrProfileNotFound is returned when a user has no profile with the requested name
+	ErrProfileNotFound = errors.New("preference profile not found")
+	// ErrProfileExists is returned when creating a profile whose name is taken
+	ErrProfileExists = errors.New("preference profile already exists")
+	// ErrProfileRequiresUser is returned when an anonymous request names a profile
+	ErrProfileRequiresUser = errors.New("authentication required to use a preference profile")
+)
+
+// PreferenceService manages users' named route preference profiles
+type PreferenceService struct {
+	preferences database.PreferenceRepository
+}
+
+// NewPreferenceService creates a new instance of PreferenceService
+func NewPreferenceService(preferences database.PreferenceRepository) *PreferenceService {
+	return &PreferenceService{
+		preferences: preferences,
+	}
+}
+
+// ListProfiles returns all profiles of a user
+func (s *PreferenceService) ListProfiles(ctx context.Context, userID uint) ([]models.PreferenceProfile, error) {
+	prefs, err := s.preferences.ListRoutePreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]models.PreferenceProfile, 0, len(prefs))
+	for i := range prefs {
+		profile, err := fromRoutePreference(&prefs[i])
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, *profile)
+	}
+	return profiles, nil
+}
+
+// GetProfile returns a user's profile by name, or the default profile if name is empty
+func (s *PreferenceService) GetProfile(ctx context.Context, userID uint, name string) (*models.PreferenceProfile, error) {
+	pref, err := s.preferences.GetRoutePreference(userID, name)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrProfileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromRoutePreference(pref)
+}
+
+// CreateProfile saves a new profile for a user
+func (s *PreferenceService) CreateProfile(ctx context.Context, userID uint, profile models.PreferenceProfile) (*models.PreferenceProfile, error) {
+	if strings.TrimSpace(profile.Name) == "" {
+		return nil, errors.New("profile name is required")
+	}
+
+	pref, err := toRoutePreference(userID, profile)
+	if err != nil {
+		return nil, err
+	}
+	err = s.preferences.CreateRoutePreference(pref)
+	if errors.Is(err, database.ErrAlreadyExists) {
+		return nil, ErrProfileExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromRoutePreference(pref)
+}
+
+// UpdateProfile replaces the preferences of an existing profile. The profile
+// cannot be renamed.
+func (s *PreferenceService) UpdateProfile(ctx context.Context, userID uint, name string, profile models.PreferenceProfile) (*models.PreferenceProfile, error) {
+	existing, err := s.preferences.GetRoutePreference(userID, name)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrProfileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	profile.Name = name
+	pref, err := toRoutePreference(userID, profile)
+	if err != nil {
+		return nil, err
+	}
+	pref.Model = existing.Model
+
+	if err := s.preferences.UpdateRoutePreference(pref); err != nil {
+		return nil, err
+	}
+	return fromRoutePreference(pref)
+}
+
+// DeleteProfile removes a user's profile by name
+func (s *PreferenceService) DeleteProfile(ctx context.Context, userID uint, name string) error {
+	err := s.preferences.DeleteRoutePreference(userID, name)
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrProfileNotFound
+	}
+	return err
+}
+
+// ResolvePreferences picks the preferences for a route calculation: those sent
+// with the request, else the named profile, else the user's default profile.
+// Without any of these it returns empty preferences. userID is 0 for
+// anonymous requests.
+func (s *PreferenceService) ResolvePreferences(
+	ctx context.Context,
+	userID uint,
+	profileName string,
+	requested *models.RoutePreferences,
+) (models.RoutePreferences, error) {
+	if requested != nil {
+		return *requested, nil
+	}
+	if userID == 0 {
+		if profileName != "" {
+			return models.RoutePreferences{}, ErrProfileRequiresUser
+		}
+		return models.RoutePreferences{}, nil
+	}
+
+	profile, err := s.GetProfile(ctx, userID, profileName)
+	if errors.Is(err, ErrProfileNotFound) && profileName == "" {
+		return models.RoutePreferences{}, nil // no default profile
+	}
+	if err != nil {
+		return models.RoutePreferences{}, err
+	}
+	return profile.Preferences, nil
+}
+
+// toRoutePreference converts a profile to its database representation
+func toRoutePreference(userID uint, profile models.PreferenceProfile) (*database.RoutePreference, error) {
+	prefs := profile.Preferences
+	pref := &database.RoutePreference{
+		UserID:             userID,
+		Name:               profile.Name,
+		IsDefault:          profile.IsDefault,
+		PreferredModes:     joinModes(prefs.PreferredModes),
+		AvoidHighways:      prefs.AvoidHighways,
+		MaxWalkingDistance: prefs.MaxWalkingDistance,
+		PrioritizeEmission: prefs.PrioritizeEmission,
+		MaxTransfers:       prefs.MaxTransfers,
+		AvoidSteepClimbs:   prefs.AvoidSteepClimbs,
+	}
+
+	if prefs.Weights != nil {
+		data, err := json.Marshal(prefs.Weights)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode ranking weights: %v", err)
+		}
+		pref.Weights = string(data)
+	}
+	if prefs.Vehicle != nil {
+		data, err := json.Marshal(prefs.Vehicle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode vehicle profile: %v", err)
+		}
+		pref.Vehicle = string(data)
+	}
+
+	return pref, nil
+}
+
+// fromRoutePreference converts a stored profile back to its API representation
+func fromRoutePreference(pref *database.RoutePreference) (*models.PreferenceProfile, error) {
+	profile := &models.PreferenceProfile{
+		Name:      pref.Name,
+		IsDefault: pref.IsDefault,
+		Preferences: models.RoutePreferences{
+			PreferredModes:     splitModes(pref.PreferredModes),
+			AvoidHighways:      pref.AvoidHighways,
+			MaxWalkingDistance: pref.MaxWalkingDistance,
+			PrioritizeEmission: pref.PrioritizeEmission,
+			MaxTransfers:       pref.MaxTransfers,
+			AvoidSteepClimbs:   pref.AvoidSteepClimbs,
+		},
+	}
+
+	if pref.Weights != "" {
+		var weights models.RankingWeights
+		if err := json.Unmarshal([]byte(pref.Weights), &weights); err != nil {
+			return nil, fmt.Errorf("failed to decode ranking weights: %v", err)
+		}
+		profile.Preferences.Weights = &weights
+	}
+	if pref.Vehicle != "" {
+		var vehicle models.VehicleProfile
+		if err := json.Unmarshal([]byte(pref.Vehicle), &vehicle); err != nil {
+			return nil, fmt.Errorf("failed to decode vehicle profile: %v", err)
+		}
+		profile.Preferences.Vehicle = &vehicle
+	}
+
+	return profile, nil
+}
+
+// joinModes converts modes to the comma-separated PreferredModes column
+func joinModes(modes []models.TransportMode) string {
+	values := make([]string, len(modes))
+	for i, mode := range modes {
+		values[i] = string(mode)
+	}
+	return strings.Join(values, ",")
+}
+
+// splitModes parses the comma-separated PreferredModes column
+func splitModes(value string) []models.TransportMode {
+	var modes []models.TransportMode
+	for _, mode := range strings.Split(value, ",") {
+		if mode = strings.TrimSpace(mode); mode != "" {
+			modes = append(modes, models.TransportMode(mode))
+		}
+	}
+	return modes
+}
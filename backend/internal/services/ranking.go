@@ -0,0 +1,130 @@
+package services
+
+import (
+	"greenroute/internal/models"
+	"sort"
+)
+
+// maxAlternatives limits how many ranked routes are returned
+const maxAlternatives = 5
+
+var (
+	// defaultWeights favour travel time when emissions are not prioritised
+	defaultWeights = models.RankingWeights{Duration: 0.6, Distance: 0.2, Emission: 0.2}
+	// emissionWeights favour low-carbon routes
+	emissionWeights = models.RankingWeights{Duration: 0.3, Distance: 0.1, Emission: 0.6}
+)
+
+// rankedJourney is a journey with its weighted score
+type rankedJourney struct {
+	journey
+	score float64
+}
+
+// rankingWeights returns the explicit user weights, or defaults derived from PrioritizeEmission
+func rankingWeights(prefs models.RoutePreferences) models.RankingWeights {
+	if w := prefs.Weights; w != nil && w.Duration >= 0 && w.Distance >= 0 && w.Emission >= 0 {
+		if sum := w.Duration + w.Distance + w.Emission; sum > 0 {
+			return models.RankingWeights{
+				Duration: w.Duration / sum,
+				Distance: w.Distance / sum,
+				Emission: w.Emission / sum,
+			}
+		}
+	}
+	if prefs.PrioritizeEmission {
+		return emissionWeights
+	}
+	return defaultWeights
+}
+
+// rankJourneys keeps the Pareto front over duration, distance and emission and
+// orders it by weighted score, best first
+func rankJourneys(candidates []journey, prefs models.RoutePreferences) []rankedJourney {
+	front := paretoFront(candidates)
+	weights := rankingWeights(prefs)
+
+	durations := make([]float64, len(front))
+	distances := make([]float64, len(front))
+	emissions := make([]float64, len(front))
+	for i, j := range front {
+		durations[i] = j.duration().Seconds()
+		distances[i] = j.distance()
+		emissions[i] = j.emission()
+	}
+
+	ranked := make([]rankedJourney, len(front))
+	for i, j := range front {
+		ranked[i] = rankedJourney{
+			journey: j,
+			score: weights.Duration*normalize(durations, i) +
+				weights.Distance*normalize(distances, i) +
+				weights.Emission*normalize(emissions, i),
+		}
+	}
+
+	sort.SliceStable(ranked, func(a, b int) bool {
+		if ranked[a].score != ranked[b].score {
+			return ranked[a].score < ranked[b].score
+		}
+		return ranked[a].duration() < ranked[b].duration()
+	})
+
+	if len(ranked) > maxAlternatives {
+		ranked = ranked[:maxAlternatives]
+	}
+	return ranked
+}
+
+// paretoFront returns the journeys not dominated on duration, distance and emission
+func paretoFront(candidates []journey) []journey {
+	var front []journey
+	for i, a := range candidates {
+		dominated := false
+		for k, b := range candidates {
+			if i != k && dominates(b, a) {
+				dominated = true
+				break
+			}
+		}
+		if !dominated && !containsEquivalent(front, a) {
+			front = append(front, a)
+		}
+	}
+	return front
+}
+
+// dominates reports whether a is at least as good as b on every criterion and better on one
+func dominates(a, b journey) bool {
+	if a.duration() > b.duration() || a.distance() > b.distance() || a.emission() > b.emission() {
+		return false
+	}
+	return a.duration() < b.duration() || a.distance() < b.distance() || a.emission() < b.emission()
+}
+
+// containsEquivalent reports whether the front already has a journey with identical totals
+func containsEquivalent(front []journey, j journey) bool {
+	for _, f := range front {
+		if f.duration() == j.duration() && f.distance() == j.distance() && f.emission() == j.emission() {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize scales values[i] to [0, 1] relative to the range of values
+func normalize(values []float64, i int) float64 {
+	min, max := values[0], values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	if max == min {
+		return 0
+	}
+	return (values[i] - min) / (max - min)
+}
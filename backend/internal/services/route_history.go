@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"greenroute/internal/database"
+	"greenroute/internal/models"
+	"time"
+)
+
+// ErrInvalidCursor is returned for a history cursor that was not issued by GetUserRoutes
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// RouteHistoryQuery filters and orders a user's route history
+type RouteHistoryQuery struct {
+	From                *time.Time
+	To                  *time.Time
+	Modes               []models.TransportMode
+	BBox                *database.BoundingBox
+	SortBy              database.RouteSort // date by default
+	Ascending           bool               // oldest or lowest emission first
+	IncludeAlternatives bool
+	Cursor              string
+	Limit               int
+}
+
+// RouteHistoryPage is one page of a user's route history
+type RouteHistoryPage struct {
+	Routes     []*models.Route `json:"routes"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// GetUserRoutes returns a page of the routes calculated for a user, newest first by default
+func (s *RouteService) GetUserRoutes(ctx context.Context, userID uint, query RouteHistoryQuery) (*RouteHistoryPage, error) {
+	filter := database.RouteFilter{
+		UserID:          userID,
+		From:            query.From,
+		To:              query.To,
+		BBox:            query.BBox,
+		RecommendedOnly: !query.IncludeAlternatives,
+		Sort:            query.SortBy,
+		Descending:      !query.Ascending,
+		Cursor:          query.Cursor,
+		Limit:           query.Limit,
+	}
+	for _, mode := range query.Modes {
+		filter.Modes = append(filter.Modes, string(mode))
+	}
+
+	saved, next, err := s.routes.GetUserRoutes(filter)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		return nil, ErrInvalidCursor
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	page := &RouteHistoryPage{
+		Routes:     make([]*models.Route, len(saved)),
+		NextCursor: next,
+	}
+	for i := range saved {
+		page.Routes[i] = fromSavedRoute(&saved[i])
+	}
+	return page, nil
+}
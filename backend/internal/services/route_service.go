@@ -2,40 +2,77 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"greenroute/internal/database"
+	"greenroute/internal/elevation"
+	"greenroute/internal/emissions"
 	"greenroute/internal/external"
 	"greenroute/internal/models"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrRouteNotFound is returned when no saved route has the requested ID
+	ErrRouteNotFound = errors.New("route not found")
+	// ErrNoRouteArrivesInTime is returned when no route leaving from now on arrives by the requested time
+	ErrNoRouteArrivesInTime = errors.New("no route arrives by the requested time")
 )
 
 // RouteService handles route calculation and optimization
 type RouteService struct {
-	mapsClient     *external.MapsClient
-	chargingClient *external.ChargingClient
-	postgres       *database.PostgresDB
-	mongodb        *database.MongoDB
+	routingProvider external.RoutingProvider
+	hubFinder       external.HubFinder
+	sharedVehicles  external.SharedVehicleFinder
+	terrain         *elevation.DEM
+	emissions       *emissions.Model
+	stationFinder   external.StationFinder
+	routes          database.RouteRepository
+	traffic         database.TrafficRepository
+	trafficHistory  *TrafficHistory
 }
 
 // NewRouteService creates a new instance of RouteService
 func NewRouteService(
-	mapsClient *external.MapsClient,
-	chargingClient *external.ChargingClient,
-	postgres *database.PostgresDB,
-	mongodb *database.MongoDB,
+	routingProvider external.RoutingProvider,
+	hubFinder external.HubFinder,
+	sharedVehicles external.SharedVehicleFinder,
+	terrain *elevation.DEM,
+	emissionModel *emissions.Model,
+	stationFinder external.StationFinder,
+	routes database.RouteRepository,
+	traffic database.TrafficRepository,
+	trafficHistory *TrafficHistory,
 ) *RouteService {
 	return &RouteService{
-		mapsClient:     mapsClient,
-		chargingClient: chargingClient,
-		postgres:       postgres,
-		mongodb:        mongodb,
+		routingProvider: routingProvider,
+		hubFinder:       hubFinder,
+		sharedVehicles:  sharedVehicles,
+		terrain:         terrain,
+		emissions:       emissionModel,
+		stationFinder:   stationFinder,
+		routes:          routes,
+		traffic:         traffic,
+		trafficHistory:  trafficHistory,
 	}
 }
 
 // RouteWithCharging represents a route with EV charging stations
 type RouteWithCharging struct {
-	Route           *models.Route
-	ChargingStations []external.ChargingStation
+	Route            *models.Route
+	Alternatives     []*models.Route
+	ChargingStations []external.CorridorStation
+}
+
+// TripTime is when a trip is planned for: arriving by ArriveBy if it is set,
+// else leaving at Departure, or now if that is zero or in the past
+type TripTime struct {
+	Departure time.Time
+	ArriveBy  time.Time
 }
 
 // CalculateRoute generates an optimized route based on user preferences
@@ -45,91 +82,114 @@ func (s *RouteService) CalculateRoute(
 	end models.Location,
 	prefs models.RoutePreferences,
 	userID string,
+	when TripTime,
 ) (*RouteWithCharging, error) {
 	if !s.validateLocations(start, end) {
 		return nil, errors.New("invalid locations provided")
 	}
 
-	// Get historical traffic data
 	now := time.Now()
-	pattern, err := s.mongodb.GetTrafficPattern(
-		start.Latitude, start.Longitude,
-		end.Latitude, end.Longitude,
-		int(now.Weekday()),
-		now.Hour(),
-	)
-	if err != nil {
-		return nil, err
+	arriveBy := !when.ArriveBy.IsZero()
+	if arriveBy && !when.ArriveBy.After(now) {
+		return nil, ErrNoRouteArrivesInTime
+	}
+	departure := when.Departure
+	if departure.Before(now) {
+		departure = now
+	}
+	opts := external.RouteOptions{
+		AvoidHighways: prefs.AvoidHighways,
+	}
+	if arriveBy {
+		opts.ArrivalTime = when.ArriveBy
+	} else {
+		opts.DepartureTime = departure
 	}
 
-	// Calculate routes for each preferred mode
-	var segments []models.RouteSegment
-	var totalDistance, totalEmission float64
-	var totalDuration time.Duration
-	var waypoints []struct{ Lat, Lng float64 }
+	// Build door-to-door and multimodal candidates
+	planner := s.newLegPlanner(prefs, opts)
+	candidates := s.planJourneys(ctx, planner, start, end, prefs)
+	if len(candidates) == 0 {
+		return nil, errors.New("no valid routes found for any preferred mode")
+	}
 
-	// Add start point to waypoints
-	waypoints = append(waypoints, struct{ Lat, Lng float64 }{
-		Lat: start.Latitude,
-		Lng: start.Longitude,
-	})
+	// Plan charging stops for electric vehicles
+	for i := range candidates {
+		candidates[i] = s.planChargingStops(ctx, planner, candidates[i])
+	}
 
-	for _, mode := range prefs.PreferredModes {
-		segment, err := s.mapsClient.GetRoute(ctx, start, end, mode)
+	// Adjust driving times based on historical data if available, and time the
+	// journeys forwards from the departure or backwards from the arrival
+	lookup := s.newTrafficLookup()
+	var samples map[database.TrafficKey]trafficSample
+	var err error
+	if arriveBy {
+		candidates, err = s.timeArrivals(ctx, planner, lookup, candidates, when.ArriveBy, now)
 		if err != nil {
-			continue // Skip this mode if calculation fails
+			return nil, err
 		}
-
-		// Adjust duration based on historical data if available
-		if pattern != nil {
-			segment.Duration = time.Duration(pattern.Duration) * time.Second
+		if len(candidates) == 0 {
+			return nil, ErrNoRouteArrivesInTime
+		}
+	} else {
+		samples, err = s.applyTrafficHistory(lookup, candidates, departure)
+		if err != nil {
+			return nil, err
+		}
+		for i := range candidates {
+			planner.timeForward(ctx, &candidates[i], departure)
 		}
-
-		segments = append(segments, *segment)
-		totalDistance += segment.Distance
-		totalEmission += segment.CO2Emission
-		totalDuration += segment.Duration
 	}
 
-	if len(segments) == 0 {
-		return nil, errors.New("no valid routes found for any preferred mode")
+	// Rank the Pareto-optimal candidates
+	ranked := rankJourneys(candidates, prefs)
+	routes := make([]*models.Route, len(ranked))
+	for i, r := range ranked {
+		routes[i] = &models.Route{
+			ID:            uuid.NewString(),
+			UserID:        userID,
+			StartLocation: start,
+			EndLocation:   end,
+			Segments:      r.segments,
+			TotalDistance: r.distance(),
+			TotalDuration: r.duration(),
+			TotalEmission: r.emission(),
+			DepartureTime: r.departure,
+			ArrivalTime:   r.arrival(),
+			Rank:          i + 1,
+			Score:         r.score,
+			ChargingStops: r.stops,
+			Warnings:      r.allWarnings(),
+			CreatedAt:     time.Now(),
+		}
 	}
+	route := routes[0]
 
-	// Add end point to waypoints
-	waypoints = append(waypoints, struct{ Lat, Lng float64 }{
-		Lat: end.Latitude,
-		Lng: end.Longitude,
-	})
-
-	// Create the complete route
-	route := &models.Route{
-		UserID:        userID,
-		StartLocation: start,
-		EndLocation:   end,
-		Segments:      segments,
-		TotalDistance: totalDistance,
-		TotalDuration: totalDuration,
-		TotalEmission: totalEmission,
-		CreatedAt:     time.Now(),
-	}
-
-	// Save the route for future reference
-	if err := s.saveRoute(route); err != nil {
+	// Save the routes so they can be retrieved exactly as returned
+	if err := s.saveRoutes(routes); err != nil {
 		return nil, err
 	}
 
-	// Update traffic pattern
-	s.updateTrafficPattern(start, end, segments[0].Duration)
+	// Update traffic patterns with the provider's driving estimates. Estimates
+	// for later departures are forecasts, not observations, and are not learned.
+	if !arriveBy && departure.Sub(now) < liveDepartureMargin {
+		s.recordTrafficSamples(samples)
+	}
 
 	// Find charging stations along the route
-	stations, err := s.chargingClient.FindStationsAlongRoute(waypoints, 2.0) // 2km corridor
+	var connectors *models.ConnectorProfile
+	if prefs.Vehicle != nil {
+		connectors = prefs.Vehicle.Connectors
+	}
+	stations, err := external.FindStationsInCorridor(ctx, s.stationFinder, routePath(route.Segments), 2.0, connectors) // 2km corridor
 	if err != nil {
 		// Don't fail the request if charging station lookup fails
-		stations = []external.ChargingStation{}
+		stations = []external.CorridorStation{}
 	}
 
 	return &RouteWithCharging{
-		Route:           route,
+		Route:            route,
+		Alternatives:     routes[1:],
 		ChargingStations: stations,
 	}, nil
 }
@@ -150,40 +210,372 @@ func isValidLongitude(lon float64) bool {
 	return lon >= -180 && lon <= 180
 }
 
-// saveRoute saves the route to PostgreSQL
-func (s *RouteService) saveRoute(route *models.Route) error {
-	savedRoute := &database.SavedRoute{
-		UserID:        route.UserID,
-		StartLat:      route.StartLocation.Latitude,
-		StartLng:      route.StartLocation.Longitude,
-		EndLat:        route.EndLocation.Latitude,
-		EndLng:        route.EndLocation.Longitude,
-		Distance:      route.TotalDistance,
-		Duration:      int64(route.TotalDuration.Seconds()),
-		CO2Emission:   route.TotalEmission,
-		TransportMode: string(route.Segments[0].Mode), // Use the primary mode
-		StartAddress:  route.StartLocation.Address,
-		EndAddress:    route.EndLocation.Address,
+// GetRoute retrieves a previously calculated route by ID. A route that belongs
+// to a user is only returned to that user; anonymous routes are returned to anyone.
+func (s *RouteService) GetRoute(ctx context.Context, id string, userID uint) (*models.Route, error) {
+	saved, err := s.routes.GetRoute(id)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrRouteNotFound
 	}
+	if err != nil {
+		return nil, err
+	}
+	if saved.UserID != nil && *saved.UserID != userID {
+		return nil, ErrRouteNotFound // don't reveal that the route exists
+	}
+	return fromSavedRoute(saved), nil
+}
 
-	return s.postgres.SaveRoute(savedRoute)
+// saveRoutes saves the ranked routes with their segments and charging stops
+func (s *RouteService) saveRoutes(routes []*models.Route) error {
+	saved := make([]*database.SavedRoute, len(routes))
+	for i, route := range routes {
+		saved[i] = toSavedRoute(route)
+	}
+	return s.routes.SaveRoutes(saved)
 }
 
-// updateTrafficPattern updates the traffic pattern in MongoDB
-func (s *RouteService) updateTrafficPattern(start, end models.Location, duration time.Duration) {
-	now := time.Now()
-	pattern := &database.TrafficPattern{
-		StartLat:    start.Latitude,
-		StartLng:    start.Longitude,
-		EndLat:      end.Latitude,
-		EndLng:      end.Longitude,
-		DayOfWeek:   int(now.Weekday()),
-		HourOfDay:   now.Hour(),
-		Duration:    duration.Seconds(),
-		Timestamp:   now,
-		SampleCount: 1,
-	}
-
-	// Ignore error as this is not critical
-	_ = s.mongodb.SaveTrafficPattern(pattern)
+// toSavedRoute converts a route to its database representation
+func toSavedRoute(route *models.Route) *database.SavedRoute {
+	saved := &database.SavedRoute{
+		ID:           route.ID,
+		StartLat:     route.StartLocation.Latitude,
+		StartLng:     route.StartLocation.Longitude,
+		EndLat:       route.EndLocation.Latitude,
+		EndLng:       route.EndLocation.Longitude,
+		StartAddress: route.StartLocation.Address,
+		EndAddress:   route.EndLocation.Address,
+		Distance:     route.TotalDistance,
+		Duration:     int64(route.TotalDuration.Seconds()),
+		CO2Emission:  route.TotalEmission,
+		Rank:         route.Rank,
+		Score:        route.Score,
+		Warnings:     strings.Join(route.Warnings, "\n"),
+		CreatedAt:    route.CreatedAt,
+	}
+	if !route.DepartureTime.IsZero() {
+		departure, arrival := route.DepartureTime, route.ArrivalTime
+		saved.DepartureTime, saved.ArrivalTime = &departure, &arrival
+	}
+	if id, err := strconv.ParseUint(route.UserID, 10, 64); err == nil {
+		userID := uint(id)
+		saved.UserID = &userID
+	}
+	if len(route.Segments) > 0 {
+		saved.TransportMode = string(route.Segments[0].Mode) // Use the primary mode
+	}
+
+	for i, seg := range route.Segments {
+		var eta string
+		if seg.ETA != nil {
+			data, _ := json.Marshal(seg.ETA) // cannot fail for this type
+			eta = string(data)
+		}
+		var rides string
+		if len(seg.Rides) > 0 {
+			data, _ := json.Marshal(seg.Rides) // cannot fail for this type
+			rides = string(data)
+		}
+		var shared string
+		if seg.Shared != nil {
+			data, _ := json.Marshal(seg.Shared) // cannot fail for this type
+			shared = string(data)
+		}
+		var terrain string
+		if seg.Elevation != nil {
+			data, _ := json.Marshal(seg.Elevation) // cannot fail for this type
+			terrain = string(data)
+		}
+		saved.Segments = append(saved.Segments, database.SavedRouteSegment{
+			Position:          i,
+			Mode:              string(seg.Mode),
+			StartLat:          seg.StartLocation.Latitude,
+			StartLng:          seg.StartLocation.Longitude,
+			EndLat:            seg.EndLocation.Latitude,
+			EndLng:            seg.EndLocation.Longitude,
+			StartAddress:      seg.StartLocation.Address,
+			EndAddress:        seg.EndLocation.Address,
+			Distance:          seg.Distance,
+			Duration:          int64(seg.Duration.Seconds()),
+			CO2Emission:       seg.CO2Emission,
+			EmissionFactorSet: seg.EmissionFactorSet,
+			Polyline:          seg.Polyline,
+			ETA:               eta,
+			Departure:         seg.Departure,
+			Rides:             rides,
+			Shared:            shared,
+			Elevation:         terrain,
+		})
+	}
+
+	for i, stop := range route.ChargingStops {
+		saved.ChargingStops = append(saved.ChargingStops, database.SavedChargingStop{
+			Position:       i,
+			StationID:      stop.StationID,
+			Name:           stop.Name,
+			Lat:            stop.Location.Latitude,
+			Lng:            stop.Location.Longitude,
+			Address:        stop.Location.Address,
+			ArrivalSoC:     stop.ArrivalSoC,
+			DepartureSoC:   stop.DepartureSoC,
+			EnergyKWh:      stop.EnergyKWh,
+			Connector:      string(stop.Connector),
+			PowerKW:        stop.PowerKW,
+			ChargeDuration: int64(stop.ChargeDuration.Seconds()),
+		})
+	}
+
+	return saved
+}
+
+// fromSavedRoute converts a saved route back to the route returned by CalculateRoute
+func fromSavedRoute(saved *database.SavedRoute) *models.Route {
+	route := &models.Route{
+		ID: saved.ID,
+		StartLocation: models.Location{
+			Latitude:  saved.StartLat,
+			Longitude: saved.StartLng,
+			Address:   saved.StartAddress,
+		},
+		EndLocation: models.Location{
+			Latitude:  saved.EndLat,
+			Longitude: saved.EndLng,
+			Address:   saved.EndAddress,
+		},
+		TotalDistance: saved.Distance,
+		TotalDuration: time.Duration(saved.Duration) * time.Second,
+		TotalEmission: saved.CO2Emission,
+		Rank:          saved.Rank,
+		Score:         saved.Score,
+		CreatedAt:     saved.CreatedAt,
+	}
+	if saved.UserID != nil {
+		route.UserID = strconv.FormatUint(uint64(*saved.UserID), 10)
+	}
+	if saved.DepartureTime != nil && saved.ArrivalTime != nil {
+		route.DepartureTime, route.ArrivalTime = *saved.DepartureTime, *saved.ArrivalTime
+	} else {
+		// Older routes were planned for leaving when they were calculated
+		route.DepartureTime = saved.CreatedAt
+		route.ArrivalTime = saved.CreatedAt.Add(route.TotalDuration)
+	}
+	if saved.Warnings != "" {
+		route.Warnings = strings.Split(saved.Warnings, "\n")
+	}
+
+	for _, seg := range saved.Segments {
+		var eta *models.TravelTimeEstimate
+		if seg.ETA != "" {
+			eta = &models.TravelTimeEstimate{}
+			if err := json.Unmarshal([]byte(seg.ETA), eta); err != nil {
+				eta = nil // Leave out an unreadable estimate rather than the route
+			}
+		}
+		var rides []models.TransitRide
+		if seg.Rides != "" {
+			if err := json.Unmarshal([]byte(seg.Rides), &rides); err != nil {
+				rides = nil // Leave out unreadable rides rather than the route
+			}
+		}
+		var shared *models.SharedRide
+		if seg.Shared != "" {
+			shared = &models.SharedRide{}
+			if err := json.Unmarshal([]byte(seg.Shared), shared); err != nil {
+				shared = nil // Leave out an unreadable rental rather than the route
+			}
+		}
+		var terrain *models.ElevationProfile
+		if seg.Elevation != "" {
+			terrain = &models.ElevationProfile{}
+			if err := json.Unmarshal([]byte(seg.Elevation), terrain); err != nil {
+				terrain = nil // Leave out an unreadable profile rather than the route
+			}
+		}
+		route.Segments = append(route.Segments, models.RouteSegment{
+			StartLocation: models.Location{
+				Latitude:  seg.StartLat,
+				Longitude: seg.StartLng,
+				Address:   seg.StartAddress,
+			},
+			EndLocation: models.Location{
+				Latitude:  seg.EndLat,
+				Longitude: seg.EndLng,
+				Address:   seg.EndAddress,
+			},
+			Mode:              models.TransportMode(seg.Mode),
+			Duration:          time.Duration(seg.Duration) * time.Second,
+			Distance:          seg.Distance,
+			CO2Emission:       seg.CO2Emission,
+			EmissionFactorSet: seg.EmissionFactorSet,
+			Polyline:          seg.Polyline,
+			ETA:               eta,
+			Departure:         seg.Departure,
+			Rides:             rides,
+			Shared:            shared,
+			Elevation:         terrain,
+		})
+	}
+
+	for _, stop := range saved.ChargingStops {
+		route.ChargingStops = append(route.ChargingStops, models.ChargingStop{
+			StationID: stop.StationID,
+			Name:      stop.Name,
+			Location: models.Location{
+				Latitude:  stop.Lat,
+				Longitude: stop.Lng,
+				Address:   stop.Address,
+			},
+			ArrivalSoC:     stop.ArrivalSoC,
+			DepartureSoC:   stop.DepartureSoC,
+			EnergyKWh:      stop.EnergyKWh,
+			Connector:      models.ConnectorType(stop.Connector),
+			PowerKW:        stop.PowerKW,
+			ChargeDuration: time.Duration(stop.ChargeDuration) * time.Second,
+		})
+	}
+
+	return route
+}
+
+// trafficSample is the provider's driving time for a trip
+type trafficSample struct {
+	start, end models.Location
+	departure  time.Time
+	duration   time.Duration
+}
+
+// trafficLookup caches the traffic history read while planning one request
+type trafficLookup struct {
+	service   *RouteService
+	baselines map[[2]string]time.Duration // provider time of the first route between two cells
+	estimates map[database.TrafficKey]*models.TravelTimeEstimate
+}
+
+func (s *RouteService) newTrafficLookup() *trafficLookup {
+	return &trafficLookup{
+		service:   s,
+		baselines: make(map[[2]string]time.Duration),
+		estimates: make(map[database.TrafficKey]*models.TravelTimeEstimate),
+	}
+}
+
+// estimate returns the key of a driving segment departing at a time and its
+// travel time estimate, or nil if there is no history. The history of a cell
+// pair describes the first route the provider suggests between them; other
+// routes are scaled by their provider time relative to it.
+func (l *trafficLookup) estimate(seg *models.RouteSegment, departure time.Time) (database.TrafficKey, *models.TravelTimeEstimate, error) {
+	key := l.service.trafficHistory.Key(seg.StartLocation, seg.EndLocation, departure)
+
+	cells := [2]string{key.StartCell, key.EndCell}
+	baseline, ok := l.baselines[cells]
+	if !ok {
+		baseline = seg.Duration
+		l.baselines[cells] = baseline
+	}
+
+	eta, ok := l.estimates[key]
+	if !ok {
+		pattern, err := l.service.traffic.GetTrafficPattern(key)
+		if err != nil {
+			return key, nil, err
+		}
+		eta = l.service.trafficHistory.Estimate(pattern)
+		l.estimates[key] = eta
+	}
+	if eta == nil {
+		return key, nil, nil
+	}
+	return key, scaleEstimate(eta, seg.Duration.Seconds()/baseline.Seconds()), nil
+}
+
+// applyTrafficHistory replaces the provider's time of each driving segment with
+// the one learned from traffic history, if there is any, and attaches the
+// travel time estimate. It returns the provider's times to learn from.
+func (s *RouteService) applyTrafficHistory(lookup *trafficLookup, candidates []journey, departure time.Time) (map[database.TrafficKey]trafficSample, error) {
+	samples := make(map[database.TrafficKey]trafficSample)
+
+	for _, j := range candidates {
+		at := departure
+		for i := range j.segments {
+			seg := &j.segments[i]
+			segDeparture := at
+			at = at.Add(seg.Duration)
+			if seg.Mode != models.Car || seg.Duration <= 0 {
+				continue
+			}
+
+			key, eta, err := lookup.estimate(seg, segDeparture)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := samples[key]; !ok {
+				samples[key] = trafficSample{
+					start:     seg.StartLocation,
+					end:       seg.EndLocation,
+					departure: segDeparture,
+					duration:  seg.Duration,
+				}
+			}
+
+			if eta != nil {
+				seg.ETA = eta
+				seg.Duration = eta.Mean
+			}
+		}
+	}
+	return samples, nil
+}
+
+// timeArrivals times each journey backwards to arrive by arriveBy and keeps
+// those that leave from now on and arrive in time. Driving times from traffic
+// history depend on when the journey leaves, so it is timed again once they
+// are applied.
+func (s *RouteService) timeArrivals(
+	ctx context.Context,
+	planner *legPlanner,
+	lookup *trafficLookup,
+	candidates []journey,
+	arriveBy time.Time,
+	now time.Time,
+) ([]journey, error) {
+	var timed []journey
+	for i := range candidates {
+		j := &candidates[i]
+		planner.timeBackward(ctx, j, arriveBy)
+		if _, err := s.applyTrafficHistory(lookup, candidates[i:i+1], j.departure); err != nil {
+			return nil, err
+		}
+		planner.timeBackward(ctx, j, arriveBy)
+
+		if j.departure.Before(now) || j.arrival().After(arriveBy) {
+			continue
+		}
+		timed = append(timed, *j)
+	}
+	return timed, nil
+}
+
+// scaleEstimate multiplies all times of an estimate by a ratio
+func scaleEstimate(eta *models.TravelTimeEstimate, ratio float64) *models.TravelTimeEstimate {
+	scale := func(d time.Duration) time.Duration {
+		return time.Duration(float64(d) * ratio).Round(time.Second)
+	}
+	return &models.TravelTimeEstimate{
+		Mean:    scale(eta.Mean),
+		P50:     scale(eta.P50),
+		P90:     scale(eta.P90),
+		Low:     scale(eta.Low),
+		High:    scale(eta.High),
+		Samples: eta.Samples,
+	}
+}
+
+// recordTrafficSamples adds the provider's driving times to the traffic history
+func (s *RouteService) recordTrafficSamples(samples map[database.TrafficKey]trafficSample) {
+	for key, sample := range samples {
+		// Ignore error as this is not critical
+		_ = s.traffic.UpdateTrafficPattern(key, func(pattern *database.TrafficPattern) {
+			s.trafficHistory.AddSample(pattern, sample.start, sample.end, sample.duration, sample.departure)
+		})
+	}
 }
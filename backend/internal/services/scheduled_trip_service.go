@@ -0,0 +1,392 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"greenroute/internal/database"
+	"greenroute/internal/models"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// minTripLead is how long before its arrival an occurrence is planned at the latest
+	minTripLead = time.Hour
+
+	defaultTripPlanTime      = "05:00"
+	defaultTripCheckInterval = time.Minute
+)
+
+var (
+	// ErrTripNotFound is returned when a user has no scheduled trip with the requested ID
+	ErrTripNotFound = errors.New("scheduled trip not found")
+	// ErrInvalidTrip is returned for a scheduled trip that cannot be planned
+	ErrInvalidTrip = errors.New("invalid scheduled trip")
+)
+
+// weekdays maps the day names of schedules to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ScheduledTripService manages users' recurring trips and plans them again
+// before every occurrence
+type ScheduledTripService struct {
+	trips       database.ScheduledTripRepository
+	routes      *RouteService
+	preferences *PreferenceService
+	planTime    clock
+	interval    time.Duration
+}
+
+// NewScheduledTripService creates a new instance of ScheduledTripService.
+// SCHEDULED_TRIP_PLAN_TIME is the local time of day, 05:00 by default, at which
+// trips are planned on the day they happen. SCHEDULED_TRIP_INTERVAL is how
+// often due trips are looked for, every minute by default; 0 disables planning.
+func NewScheduledTripService(
+	trips database.ScheduledTripRepository,
+	routes *RouteService,
+	preferences *PreferenceService,
+) (*ScheduledTripService, error) {
+	s := &ScheduledTripService{
+		trips:       trips,
+		routes:      routes,
+		preferences: preferences,
+		interval:    defaultTripCheckInterval,
+	}
+
+	planTime := os.Getenv("SCHEDULED_TRIP_PLAN_TIME")
+	if planTime == "" {
+		planTime = defaultTripPlanTime
+	}
+	var err error
+	if s.planTime, err = parseClock(planTime); err != nil {
+		return nil, fmt.Errorf("invalid SCHEDULED_TRIP_PLAN_TIME: %q", planTime)
+	}
+
+	if value := os.Getenv("SCHEDULED_TRIP_INTERVAL"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid SCHEDULED_TRIP_INTERVAL: %q", value)
+		}
+		s.interval = d
+	}
+	return s, nil
+}
+
+// ListTrips returns all scheduled trips of a user
+func (s *ScheduledTripService) ListTrips(ctx context.Context, userID uint) ([]models.ScheduledTrip, error) {
+	stored, err := s.trips.ListScheduledTrips(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	trips := make([]models.ScheduledTrip, 0, len(stored))
+	for i := range stored {
+		trip, err := fromScheduledTrip(&stored[i])
+		if err != nil {
+			return nil, err
+		}
+		trips = append(trips, *trip)
+	}
+	return trips, nil
+}
+
+// GetTrip returns a user's scheduled trip by ID
+func (s *ScheduledTripService) GetTrip(ctx context.Context, userID, id uint) (*models.ScheduledTrip, error) {
+	stored, err := s.trips.GetScheduledTrip(userID, id)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrTripNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromScheduledTrip(stored)
+}
+
+// CreateTrip saves a new scheduled trip for a user. Its first occurrence is
+// planned on the next check if the time to plan it has already passed.
+func (s *ScheduledTripService) CreateTrip(ctx context.Context, userID uint, trip models.ScheduledTrip) (*models.ScheduledTrip, error) {
+	if strings.TrimSpace(trip.Name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidTrip)
+	}
+	if !s.routes.validateLocations(trip.StartLocation, trip.EndLocation) {
+		return nil, fmt.Errorf("%w: invalid locations provided", ErrInvalidTrip)
+	}
+	if trip.TimeZone == "" {
+		trip.TimeZone = "UTC"
+	}
+	for i, day := range trip.Days {
+		trip.Days[i] = strings.ToLower(strings.TrimSpace(day))
+	}
+	sched, err := parseSchedule(trip.Days, trip.ArriveBy, trip.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check that the profile exists; later changes to it are picked up when planning
+	if trip.Preferences == nil && trip.Profile != "" {
+		if _, err := s.preferences.GetProfile(ctx, userID, trip.Profile); err != nil {
+			return nil, err
+		}
+	}
+
+	stored, err := toScheduledTrip(userID, trip)
+	if err != nil {
+		return nil, err
+	}
+	stored.NextPlanAt = sched.next(time.Now(), s.planTime).planAt
+	if err := s.trips.CreateScheduledTrip(stored); err != nil {
+		return nil, err
+	}
+	return fromScheduledTrip(stored)
+}
+
+// DeleteTrip removes a user's scheduled trip. Routes already planned for it are kept.
+func (s *ScheduledTripService) DeleteTrip(ctx context.Context, userID, id uint) error {
+	err := s.trips.DeleteScheduledTrip(userID, id)
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrTripNotFound
+	}
+	return err
+}
+
+// Start plans due trips every interval until ctx is cancelled. It does
+// nothing if the interval is 0.
+func (s *ScheduledTripService) Start(ctx context.Context) {
+	if s.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.PlanDueTrips(ctx, now)
+			}
+		}
+	}()
+}
+
+// PlanDueTrips plans every trip whose next plan is due at now
+func (s *ScheduledTripService) PlanDueTrips(ctx context.Context, now time.Time) {
+	trips, err := s.trips.GetDueScheduledTrips(now)
+	if err != nil {
+		log.Printf("Failed to load due scheduled trips: %v", err)
+		return
+	}
+
+	for i := range trips {
+		if err := s.planTrip(ctx, &trips[i], now); err != nil {
+			log.Printf("Failed to plan scheduled trip %d: %v", trips[i].ID, err)
+		}
+	}
+}
+
+// planTrip plans the occurrence a trip is due for, arriving by its time, and
+// moves the next plan on to the following occurrence. The route is saved for
+// the trip's owner. Occurrences missed while no server was running are skipped.
+func (s *ScheduledTripService) planTrip(ctx context.Context, trip *database.ScheduledTrip, now time.Time) error {
+	sched, err := parseSchedule(strings.Split(trip.Days, ","), trip.ArriveBy, trip.TimeZone)
+	if err != nil {
+		return err
+	}
+
+	due := sched.next(trip.NextPlanAt, s.planTime)
+	if !due.arrival.After(now) {
+		_, err := s.trips.ClaimScheduledTrip(trip, sched.next(now, s.planTime).planAt)
+		return err
+	}
+
+	// Claim the trip first so that only one server plans the occurrence
+	claimed, err := s.trips.ClaimScheduledTrip(trip, sched.next(due.arrival, s.planTime).planAt)
+	if err != nil || !claimed {
+		return err
+	}
+
+	var routeID, planErr string
+	route, err := s.planRoute(ctx, trip, due.arrival)
+	if err != nil {
+		planErr = err.Error()
+	} else {
+		routeID = route.Route.ID
+	}
+	return s.trips.RecordScheduledTripPlan(trip.ID, due.arrival, routeID, planErr)
+}
+
+// planRoute calculates the route of a trip arriving by arrival with its
+// preferences, or else its owner's profile
+func (s *ScheduledTripService) planRoute(ctx context.Context, trip *database.ScheduledTrip, arrival time.Time) (*RouteWithCharging, error) {
+	var requested *models.RoutePreferences
+	if trip.Preferences != "" {
+		requested = &models.RoutePreferences{}
+		if err := json.Unmarshal([]byte(trip.Preferences), requested); err != nil {
+			return nil, fmt.Errorf("failed to decode trip preferences: %v", err)
+		}
+	}
+	prefs, err := s.preferences.ResolvePreferences(ctx, trip.UserID, trip.Profile, requested)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.routes.CalculateRoute(
+		ctx,
+		models.Location{Latitude: trip.StartLat, Longitude: trip.StartLng, Address: trip.StartAddress},
+		models.Location{Latitude: trip.EndLat, Longitude: trip.EndLng, Address: trip.EndAddress},
+		prefs,
+		strconv.FormatUint(uint64(trip.UserID), 10),
+		TripTime{ArriveBy: arrival},
+	)
+}
+
+// clock is a time of day
+type clock struct {
+	hour, minute int
+}
+
+// parseClock parses a time of day written as HH:MM
+func parseClock(value string) (clock, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return clock{}, err
+	}
+	return clock{hour: t.Hour(), minute: t.Minute()}, nil
+}
+
+// on returns the time of day on a date in a location
+func (c clock) on(year int, month time.Month, day int, loc *time.Location) time.Time {
+	return time.Date(year, month, day, c.hour, c.minute, 0, 0, loc)
+}
+
+// schedule is the parsed timing of a scheduled trip
+type schedule struct {
+	days     map[time.Weekday]bool
+	arriveBy clock
+	location *time.Location
+}
+
+// occurrence is one trip of a schedule and when it is planned
+type occurrence struct {
+	arrival time.Time
+	planAt  time.Time
+}
+
+func parseSchedule(days []string, arriveBy, timeZone string) (schedule, error) {
+	sched := schedule{days: make(map[time.Weekday]bool)}
+	for _, day := range days {
+		weekday, ok := weekdays[day]
+		if !ok {
+			return schedule{}, fmt.Errorf("%w: unknown day %q", ErrInvalidTrip, day)
+		}
+		sched.days[weekday] = true
+	}
+	if len(sched.days) == 0 {
+		return schedule{}, fmt.Errorf("%w: at least one day is required", ErrInvalidTrip)
+	}
+
+	var err error
+	if sched.arriveBy, err = parseClock(arriveBy); err != nil {
+		return schedule{}, fmt.Errorf("%w: arrive_by must be HH:MM", ErrInvalidTrip)
+	}
+	if sched.location, err = time.LoadLocation(timeZone); err != nil {
+		return schedule{}, fmt.Errorf("%w: unknown time zone %q", ErrInvalidTrip, timeZone)
+	}
+	return sched, nil
+}
+
+// next returns the first occurrence arriving after t. It is planned at
+// planTime on its day, or minTripLead before it arrives if that is earlier.
+func (sched schedule) next(t time.Time, planTime clock) occurrence {
+	local := t.In(sched.location)
+	year, month, day := local.Date()
+	for i := 0; ; i++ {
+		arrival := sched.arriveBy.on(year, month, day+i, sched.location)
+		if !sched.days[arrival.Weekday()] || !arrival.After(t) {
+			continue
+		}
+
+		planAt := planTime.on(year, month, day+i, sched.location)
+		if latest := arrival.Add(-minTripLead); planAt.After(latest) {
+			planAt = latest
+		}
+		return occurrence{arrival: arrival, planAt: planAt}
+	}
+}
+
+// toScheduledTrip converts a trip to its database representation
+func toScheduledTrip(userID uint, trip models.ScheduledTrip) (*database.ScheduledTrip, error) {
+	stored := &database.ScheduledTrip{
+		UserID:       userID,
+		Name:         trip.Name,
+		StartLat:     trip.StartLocation.Latitude,
+		StartLng:     trip.StartLocation.Longitude,
+		EndLat:       trip.EndLocation.Latitude,
+		EndLng:       trip.EndLocation.Longitude,
+		StartAddress: trip.StartLocation.Address,
+		EndAddress:   trip.EndLocation.Address,
+		Days:         strings.Join(trip.Days, ","),
+		ArriveBy:     trip.ArriveBy,
+		TimeZone:     trip.TimeZone,
+		Profile:      trip.Profile,
+	}
+	if trip.Preferences != nil {
+		data, err := json.Marshal(trip.Preferences)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode trip preferences: %v", err)
+		}
+		stored.Preferences = string(data)
+	}
+	return stored, nil
+}
+
+// fromScheduledTrip converts a stored trip back to its API representation
+func fromScheduledTrip(stored *database.ScheduledTrip) (*models.ScheduledTrip, error) {
+	trip := &models.ScheduledTrip{
+		ID:   stored.ID,
+		Name: stored.Name,
+		StartLocation: models.Location{
+			Latitude:  stored.StartLat,
+			Longitude: stored.StartLng,
+			Address:   stored.StartAddress,
+		},
+		EndLocation: models.Location{
+			Latitude:  stored.EndLat,
+			Longitude: stored.EndLng,
+			Address:   stored.EndAddress,
+		},
+		Days:       strings.Split(stored.Days, ","),
+		ArriveBy:   stored.ArriveBy,
+		TimeZone:   stored.TimeZone,
+		Profile:    stored.Profile,
+		NextPlanAt: stored.NextPlanAt,
+		PlannedFor: stored.PlannedFor,
+		LastError:  stored.LastError,
+		CreatedAt:  stored.CreatedAt,
+	}
+	if stored.LastRouteID != nil {
+		trip.LastRouteID = *stored.LastRouteID
+	}
+	if stored.Preferences != "" {
+		trip.Preferences = &models.RoutePreferences{}
+		if err := json.Unmarshal([]byte(stored.Preferences), trip.Preferences); err != nil {
+			return nil, fmt.Errorf("failed to decode trip preferences: %v", err)
+		}
+	}
+	return trip, nil
+}
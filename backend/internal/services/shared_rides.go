@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"greenroute/internal/models"
+)
+
+const (
+	// maxSharedSpotsPerEnd limits how many pickups and docks are tried at each trip end
+	maxSharedSpotsPerEnd = 2
+
+	sharedWalkRadius = 500.0 // to a pickup or from a dock, in meters
+)
+
+// planSharedJourneys builds walk, ride and walk journeys on a shared bike or
+// scooter. Vehicles are picked up where one is available now, and docked
+// vehicles are returned to a station near the destination with a free dock;
+// dockless ones are left at the destination.
+func (s *RouteService) planSharedJourneys(
+	ctx context.Context,
+	planner *legPlanner,
+	start models.Location,
+	end models.Location,
+	prefs models.RoutePreferences,
+	mode models.TransportMode,
+) []journey {
+	radius := sharedWalkRadius
+	if prefs.MaxWalkingDistance > 0 && prefs.MaxWalkingDistance < radius {
+		radius = prefs.MaxWalkingDistance
+	}
+
+	pickups, err := s.sharedVehicles.FindPickups(ctx, start, radius, mode)
+	if err != nil {
+		return nil
+	}
+	if len(pickups) > maxSharedSpotsPerEnd {
+		pickups = pickups[:maxSharedSpotsPerEnd]
+	}
+
+	var journeys []journey
+	for _, pickup := range pickups {
+		walkTo, ok := planner.walk(ctx, start, pickup.Location)
+		if !ok {
+			continue
+		}
+		shared := models.SharedRide{
+			System:            pickup.System,
+			Pickup:            pickup.Name,
+			VehiclesAvailable: pickup.Available,
+		}
+
+		if !pickup.Docked {
+			ride := planner.sharedLeg(ctx, pickup.Location, end, mode, shared)
+			if ride == nil || (pickup.RangeMeters > 0 && ride.Distance > pickup.RangeMeters) {
+				continue
+			}
+			journeys = append(journeys, sharedJourney(walkTo, ride, nil))
+			continue
+		}
+
+		dropoffs, err := s.sharedVehicles.FindDropoffs(ctx, pickup.System, end, radius, mode)
+		if err != nil {
+			continue
+		}
+		if len(dropoffs) > maxSharedSpotsPerEnd {
+			dropoffs = dropoffs[:maxSharedSpotsPerEnd]
+		}
+		for _, dropoff := range dropoffs {
+			if sameLocation(pickup.Location, dropoff.Location) {
+				continue
+			}
+			walkFrom, ok := planner.walk(ctx, dropoff.Location, end)
+			if !ok {
+				continue
+			}
+			docked := shared
+			docked.Dropoff = dropoff.Name
+			docked.DocksAvailable = dropoff.Available
+			if ride := planner.sharedLeg(ctx, pickup.Location, dropoff.Location, mode, docked); ride != nil {
+				journeys = append(journeys, sharedJourney(walkTo, ride, walkFrom))
+			}
+		}
+	}
+	return journeys
+}
+
+// walk returns the walking leg between two points, or nil if they are the
+// same place. It reports false if the provider cannot route the walk.
+func (p *legPlanner) walk(ctx context.Context, from, to models.Location) (*models.RouteSegment, bool) {
+	if sameLocation(from, to) {
+		return nil, true
+	}
+	seg := p.leg(ctx, from, to, models.Walking)
+	return seg, seg != nil
+}
+
+// sharedLeg returns a ride on a shared vehicle, routed as cycling, or nil if
+// the provider cannot route it
+func (p *legPlanner) sharedLeg(ctx context.Context, from, to models.Location, mode models.TransportMode, shared models.SharedRide) *models.RouteSegment {
+	cycling := p.leg(ctx, from, to, models.Bicycle)
+	if cycling == nil {
+		return nil
+	}
+
+	ride := *cycling
+	ride.Mode = mode
+	ride.Shared = &shared
+	p.emissionModel.Apply(ctx, &ride, p.vehicle, p.departure)
+	return &ride
+}
+
+// sharedJourney joins a shared ride and the walks to and from it, if any
+func sharedJourney(walkTo, ride, walkFrom *models.RouteSegment) journey {
+	var j journey
+	if walkTo != nil {
+		j.segments = append(j.segments, *walkTo)
+	}
+	j.segments = append(j.segments, *ride)
+	if walkFrom != nil {
+		j.segments = append(j.segments, *walkFrom)
+	}
+	return j
+}
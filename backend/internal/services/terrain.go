@@ -0,0 +1,146 @@
+package services
+
+import (
+	"fmt"
+	"greenroute/internal/elevation"
+	"greenroute/internal/models"
+	"math"
+	"time"
+)
+
+const (
+	// steepClimbGrade is the steepest climb over 100 m kept when avoiding steep climbs
+	steepClimbGrade = 0.08
+
+	// Cyclist and bike, riding at a constant power set by the flat speed
+	cyclingMass        = 85.0 // kg
+	rollingResistance  = 0.006
+	dragArea           = 0.5 // CdA, in m^2
+	airDensity         = 1.2 // kg/m^3
+	gravity            = 9.81
+	maxDescentSpeed    = 35 / 3.6 // riders brake above this, in m/s
+	minClimbingSpeed   = 4 / 3.6  // riders get off and push below this, in m/s
+	defaultCyclingPace = 16 / 3.6 // when the provider's speed is implausible, in m/s
+)
+
+// applyTerrain adds the elevation profile of a segment from the DEM, and
+// adjusts walking and cycling times for its grades. Routing providers are
+// taken to time both as if the ground were flat.
+func (p *legPlanner) applyTerrain(seg *models.RouteSegment) {
+	if p.terrain == nil || seg.Mode == models.PublicTransit {
+		return
+	}
+	profile, err := p.terrain.Profile(segmentPath(*seg))
+	if err != nil {
+		return // Keep the segment without terrain outside the DEM
+	}
+	seg.Elevation = profile.Summary()
+
+	var factor float64
+	switch seg.Mode {
+	case models.Walking:
+		factor = terrainTimeFactor(profile, walkingSpeed)
+	case models.Bicycle:
+		flat := defaultCyclingPace
+		if seg.Duration > 0 {
+			if speed := seg.Distance / seg.Duration.Seconds(); speed >= 2 && speed <= 10 {
+				flat = speed
+			}
+		}
+		power := cyclingPower(flat)
+		factor = terrainTimeFactor(profile, func(grade float64) float64 {
+			return cyclingSpeed(power, grade)
+		})
+	default:
+		return
+	}
+	seg.Duration = time.Duration(float64(seg.Duration) * factor).Round(time.Second)
+}
+
+// terrainTimeFactor returns how much longer a profile takes to cover than
+// flat ground at the given speed for each grade
+func terrainTimeFactor(profile elevation.Profile, speed func(grade float64) float64) float64 {
+	var hilly, flat float64
+	for i := 1; i < len(profile.Distances); i++ {
+		length := profile.Distances[i] - profile.Distances[i-1]
+		if length <= 0 {
+			continue
+		}
+		grade := (profile.Elevations[i] - profile.Elevations[i-1]) / length
+		hilly += length / speed(grade)
+		flat += length / speed(0)
+	}
+	if flat == 0 {
+		return 1
+	}
+	return hilly / flat
+}
+
+// walkingSpeed returns the walking speed on a grade in m/s, from Tobler's
+// hiking function, fastest on a gentle descent
+func walkingSpeed(grade float64) float64 {
+	return 6 * math.Exp(-3.5*math.Abs(grade+0.05)) / 3.6
+}
+
+// cyclingPower returns the power in watts a cyclist needs to hold a speed in
+// m/s on flat ground
+func cyclingPower(speed float64) float64 {
+	return speed * (cyclingMass*gravity*rollingResistance + 0.5*airDensity*dragArea*speed*speed)
+}
+
+// cyclingSpeed returns the speed in m/s a cyclist riding at a constant power
+// reaches on a grade, between pushing the bike and braking on descents
+func cyclingSpeed(power, grade float64) float64 {
+	angle := math.Atan(grade)
+	resistance := cyclingMass * gravity * (rollingResistance*math.Cos(angle) + math.Sin(angle))
+	drag := 0.5 * airDensity * dragArea
+
+	// Power grows with speed past the single positive root, so bisect for it
+	low, high := 0.0, 30.0
+	for i := 0; i < 50; i++ {
+		speed := (low + high) / 2
+		if speed*(resistance+drag*speed*speed) < power {
+			low = speed
+		} else {
+			high = speed
+		}
+	}
+	return math.Max(minClimbingSpeed, math.Min(low, maxDescentSpeed))
+}
+
+// steepestClimb returns the steepest climb on the journey's walking and
+// pedalled segments, as a fraction
+func (j journey) steepestClimb() float64 {
+	var steepest float64
+	for _, seg := range j.segments {
+		if seg.Elevation == nil {
+			continue
+		}
+		switch seg.Mode {
+		case models.Walking, models.Bicycle, models.BikeShare:
+			steepest = math.Max(steepest, seg.Elevation.MaxGrade)
+		}
+	}
+	return steepest
+}
+
+// avoidSteepClimbs drops the journeys that walk or cycle up grades steeper
+// than steepClimbGrade. If every journey does, they are all kept with a warning.
+func avoidSteepClimbs(candidates []journey) []journey {
+	var gentle []journey
+	for _, j := range candidates {
+		if j.steepestClimb() <= steepClimbGrade {
+			gentle = append(gentle, j)
+		}
+	}
+	if len(gentle) > 0 {
+		return gentle
+	}
+
+	for i := range candidates {
+		candidates[i].warnings = append(candidates[i].warnings, fmt.Sprintf(
+			"No route avoids steep climbs; this one climbs a %.0f%% grade", candidates[i].steepestClimb()*100,
+		))
+	}
+	return candidates
+}
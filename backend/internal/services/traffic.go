@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"greenroute/internal/database"
+	"greenroute/internal/geo"
+	"greenroute/internal/models"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultTrafficPrecision keys traffic history by geohash cells of about 1.2 km by 0.6 km
+	defaultTrafficPrecision = 6
+	// defaultTrafficHalfLife halves the weight of a sample every four weeks
+	defaultTrafficHalfLife = 4 * 7 * 24 * time.Hour
+
+	// Durations are counted in log-spaced bins for percentiles: the first bin
+	// ends at histogramBase seconds, each further bin is histogramRatio times
+	// wider, and the last bin is open-ended (from about 45 hours)
+	histogramBase  = 30.0
+	histogramRatio = 1.1
+	histogramBins  = 90
+
+	// intervalZ is the z-score of a two-sided 90% interval
+	intervalZ = 1.645
+)
+
+// TrafficHistory learns driving times from past trips. Trips are grouped by
+// the geohash cells of their start and end and the hour of the week they depart
+// in, so nearby trips learn from each other. Older trips count for less.
+type TrafficHistory struct {
+	precision int
+	halfLife  time.Duration
+}
+
+// NewTrafficHistory creates the traffic history configured by
+// TRAFFIC_GEOHASH_PRECISION, the geohash length from 1 to 12, and
+// TRAFFIC_HALF_LIFE, the age at which a trip counts half. Changing the
+// precision starts a fresh history, since patterns of other lengths no longer
+// match.
+func NewTrafficHistory() (*TrafficHistory, error) {
+	h := &TrafficHistory{
+		precision: defaultTrafficPrecision,
+		halfLife:  defaultTrafficHalfLife,
+	}
+	if value := os.Getenv("TRAFFIC_GEOHASH_PRECISION"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > geo.MaxGeohashPrecision {
+			return nil, fmt.Errorf("invalid TRAFFIC_GEOHASH_PRECISION: %q", value)
+		}
+		h.precision = n
+	}
+	if value := os.Getenv("TRAFFIC_HALF_LIFE"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid TRAFFIC_HALF_LIFE: %q", value)
+		}
+		h.halfLife = d
+	}
+	return h, nil
+}
+
+// Key returns the bucket of a trip departing at the given time
+func (h *TrafficHistory) Key(start, end models.Location, departure time.Time) database.TrafficKey {
+	return database.TrafficKey{
+		StartCell: geo.Geohash(geo.Point{Lat: start.Latitude, Lng: start.Longitude}, h.precision),
+		EndCell:   geo.Geohash(geo.Point{Lat: end.Latitude, Lng: end.Longitude}, h.precision),
+		DayOfWeek: int(departure.Weekday()),
+		HourOfDay: departure.Hour(),
+	}
+}
+
+// AddSample adds a trip to a pattern. The existing statistics decay by the
+// time since the previous sample, then the trip is added with weight 1.
+func (h *TrafficHistory) AddSample(pattern *database.TrafficPattern, start, end models.Location, duration time.Duration, at time.Time) {
+	decay := 1.0
+	if pattern.Weight > 0 && at.After(pattern.Timestamp) {
+		decay = math.Exp2(-float64(at.Sub(pattern.Timestamp)) / float64(h.halfLife))
+	}
+	seconds := duration.Seconds()
+
+	// Weighted incremental mean and variance (West, 1979) over decayed weights
+	previous := pattern.Weight * decay
+	weight := previous + 1
+	delta := seconds - pattern.Mean
+	mean := pattern.Mean + delta/weight
+	pattern.Variance = (pattern.Variance*previous + delta*(seconds-mean)) / weight
+	pattern.Mean = mean
+	pattern.Weight = weight
+
+	if len(pattern.Histogram) != histogramBins {
+		pattern.Histogram = make([]float64, histogramBins)
+	}
+	for i := range pattern.Histogram {
+		pattern.Histogram[i] *= decay
+	}
+	pattern.Histogram[histogramBin(seconds)]++
+	pattern.P50 = histogramQuantile(pattern.Histogram, 0.5)
+	pattern.P90 = histogramQuantile(pattern.Histogram, 0.9)
+
+	pattern.StartLat, pattern.StartLng = start.Latitude, start.Longitude
+	pattern.EndLat, pattern.EndLng = end.Latitude, end.Longitude
+	pattern.SampleCount++
+	pattern.Timestamp = at
+}
+
+// Estimate returns the travel time estimate of a pattern, or nil if it has no samples
+func (h *TrafficHistory) Estimate(pattern *database.TrafficPattern) *models.TravelTimeEstimate {
+	if pattern == nil || pattern.Weight <= 0 {
+		return nil
+	}
+
+	spread := intervalZ * math.Sqrt(math.Max(pattern.Variance, 0))
+	return &models.TravelTimeEstimate{
+		Mean:    seconds(pattern.Mean),
+		P50:     seconds(pattern.P50),
+		P90:     seconds(pattern.P90),
+		Low:     seconds(math.Max(pattern.Mean-spread, 0)),
+		High:    seconds(pattern.Mean + spread),
+		Samples: pattern.Weight,
+	}
+}
+
+// histogramBin returns the bin of a duration in seconds
+func histogramBin(seconds float64) int {
+	if seconds < histogramBase {
+		return 0
+	}
+	bin := 1 + int(math.Log(seconds/histogramBase)/math.Log(histogramRatio))
+	if bin >= histogramBins {
+		return histogramBins - 1
+	}
+	return bin
+}
+
+// histogramBounds returns the range of durations counted in a bin
+func histogramBounds(bin int) (float64, float64) {
+	if bin == 0 {
+		return 0, histogramBase
+	}
+	lower := histogramBase * math.Pow(histogramRatio, float64(bin-1))
+	return lower, lower * histogramRatio
+}
+
+// histogramQuantile estimates a quantile of the durations counted in a
+// histogram, interpolating linearly within the bin it falls in
+func histogramQuantile(histogram []float64, q float64) float64 {
+	var total float64
+	for _, w := range histogram {
+		total += w
+	}
+	if total <= 0 {
+		return 0
+	}
+
+	target := q * total
+	var cumulative float64
+	for bin, w := range histogram {
+		if w <= 0 || cumulative+w < target {
+			cumulative += w
+			continue
+		}
+		lower, upper := histogramBounds(bin)
+		if bin == len(histogram)-1 {
+			return lower // open-ended
+		}
+		return lower + (upper-lower)*(target-cumulative)/w
+	}
+	lower, _ := histogramBounds(len(histogram) - 1)
+	return lower
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Second)
+}
@@ -14,6 +14,7 @@ const RouteForm: React.FC<RouteFormProps> = ({ onSubmit }) => {
         maxWalkingDistance: 1000,
         prioritizeEmission: true,
         maxTransfers: 2,
+        avoidSteepClimbs: false,
     });
 
     const handleSubmit = (e: React.FormEvent) => {
@@ -59,7 +60,7 @@ const RouteForm: React.FC<RouteFormProps> = ({ onSubmit }) => {
             <div>
                 <label className="block text-sm font-medium text-gray-700">Transport Modes</label>
                 <div className="mt-2 space-x-2">
-                    {(['car', 'bicycle', 'public_transit', 'walking'] as TransportMode[]).map(mode => (
+                    {(['car', 'bicycle', 'public_transit', 'walking', 'bike_share', 'e_scooter'] as TransportMode[]).map(mode => (
                         <button
                             key={mode}
                             type="button"
@@ -105,6 +106,23 @@ const RouteForm: React.FC<RouteFormProps> = ({ onSubmit }) => {
                         Prioritize Low Emissions
                     </label>
                 </div>
+
+                <div className="flex items-center">
+                    <input
+                        type="checkbox"
+                        checked={preferences.avoidSteepClimbs}
+                        onChange={e =>
+                            setPreferences(prev => ({
+                                ...prev,
+                                avoidSteepClimbs: e.target.checked,
+                            }))
+                        }
+                        className="h-4 w-4 text-green-600 focus:ring-green-500 border-gray-300 rounded"
+                    />
+                    <label className="ml-2 block text-sm text-gray-700">
+                        Avoid Steep Climbs
+                    </label>
+                </div>
             </div>
 
             <div>
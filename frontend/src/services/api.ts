@@ -1,7 +1,16 @@
-import { Location, RoutePreferences, RouteWithCharging } from '../types/types';
+import { Location, RouteHistoryPage, RouteHistoryQuery, RoutePreferences, RouteWithCharging } from '../types/types';
 
 const API_BASE_URL = process.env.REACT_APP_API_BASE_URL || 'http://localhost:8080/api/v1';
 
+let accessToken: string | null = null;
+
+export const setAccessToken = (token: string | null) => {
+    accessToken = token;
+};
+
+const authHeaders = (): Record<string, string> =>
+    accessToken ? { Authorization: `Bearer ${accessToken}` } : {};
+
 export const calculateRoute = async (
     start: Location,
     end: Location,
@@ -11,6 +20,7 @@ export const calculateRoute = async (
         method: 'POST',
         headers: {
             'Content-Type': 'application/json',
+            ...authHeaders(),
         },
         body: JSON.stringify({
             start_location: start,
@@ -26,8 +36,23 @@ export const calculateRoute = async (
     return response.json();
 };
 
-export const getUserRoutes = async (userId: string): Promise<RouteWithCharging[]> => {
-    const response = await fetch(`${API_BASE_URL}/routes/user/${userId}`);
+export const getUserRoutes = async (
+    userId: string,
+    query: RouteHistoryQuery = {}
+): Promise<RouteHistoryPage> => {
+    const params = new URLSearchParams();
+    if (query.from) params.set('from', query.from);
+    if (query.to) params.set('to', query.to);
+    query.modes?.forEach((mode) => params.append('mode', mode));
+    if (query.bbox) params.set('bbox', query.bbox.join(','));
+    if (query.sort) params.set('sort', query.sort);
+    if (query.order) params.set('order', query.order);
+    if (query.limit) params.set('limit', String(query.limit));
+    if (query.cursor) params.set('cursor', query.cursor);
+
+    const response = await fetch(`${API_BASE_URL}/routes/user/${userId}?${params}`, {
+        headers: authHeaders(),
+    });
 
     if (!response.ok) {
         throw new Error('Failed to fetch user routes');
@@ -49,7 +49,29 @@ export interface RouteWithCharging {
     chargingStations: ChargingStation[];
 }
 
-export type TransportMode = 'car' | 'bicycle' | 'public_transit' | 'walking';
+export interface PreferenceProfile {
+    name: string;
+    is_default: boolean;
+    preferences: RoutePreferences;
+}
+
+export interface RouteHistoryQuery {
+    from?: string; // RFC 3339 timestamp or YYYY-MM-DD
+    to?: string;
+    modes?: TransportMode[];
+    bbox?: [number, number, number, number]; // min lng, min lat, max lng, max lat
+    sort?: 'date' | 'emission';
+    order?: 'asc' | 'desc';
+    limit?: number;
+    cursor?: string;
+}
+
+export interface RouteHistoryPage {
+    routes: Route[];
+    next_cursor?: string;
+}
+
+export type TransportMode = 'car' | 'bicycle' | 'public_transit' | 'walking' | 'bike_share' | 'e_scooter';
 
 export interface RoutePreferences {
     preferredModes: TransportMode[];
@@ -57,4 +79,5 @@ export interface RoutePreferences {
     maxWalkingDistance: number; // in meters
     prioritizeEmission: boolean;
     maxTransfers: number;
+    avoidSteepClimbs: boolean;
 }